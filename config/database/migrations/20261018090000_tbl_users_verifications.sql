@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE tbl_users
+    ADD COLUMN email_verified_at TIMESTAMP NULL,
+    ADD COLUMN phone_verified_at TIMESTAMP NULL;
+
+ALTER TABLE tbl_roles
+    ADD COLUMN require_verified_email BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN require_verified_phone BOOLEAN NOT NULL DEFAULT false;
+
+-- OTP codes sent by SMS, only the HMAC of the code is stored
+CREATE TABLE tbl_users_verifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    channel VARCHAR NOT NULL,
+    target VARCHAR NOT NULL,
+    code_hash VARCHAR NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_users_verifications_user_channel ON tbl_users_verifications (user_id, channel, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS tbl_users_verifications;
+
+ALTER TABLE tbl_roles
+    DROP COLUMN IF EXISTS require_verified_email,
+    DROP COLUMN IF EXISTS require_verified_phone;
+
+ALTER TABLE tbl_users
+    DROP COLUMN IF EXISTS email_verified_at,
+    DROP COLUMN IF EXISTS phone_verified_at;
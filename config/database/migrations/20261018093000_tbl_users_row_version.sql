@@ -0,0 +1,8 @@
+-- +goose Up
+-- Incremented on every update, exposed to clients as the ETag of a user
+ALTER TABLE tbl_users
+    ADD COLUMN row_version INTEGER NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE tbl_users
+    DROP COLUMN IF EXISTS row_version;
@@ -0,0 +1,44 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Searchable text of an account, the same expression feeds the trigram and the full text index
+ALTER TABLE tbl_users
+    ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+        coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' || user_name || ' ' ||
+        coalesce(user_alias, '') || ' ' || email || ' ' || coalesce(phone_number, '')
+    ) STORED,
+    ADD COLUMN search_document TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple',
+            coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' || user_name || ' ' ||
+            coalesce(user_alias, '') || ' ' || email || ' ' || coalesce(phone_number, ''))
+    ) STORED;
+
+CREATE INDEX idx_users_search_document ON tbl_users USING GIN (search_document);
+CREATE INDEX idx_users_search_text_trgm ON tbl_users USING GIN (search_text gin_trgm_ops);
+
+ALTER TABLE tbl_players
+    ADD COLUMN search_text TEXT GENERATED ALWAYS AS (
+        first_name || ' ' || last_name || ' ' || user_name || ' ' ||
+        coalesce(user_alias, '') || ' ' || email || ' ' || coalesce(phone_number, '')
+    ) STORED,
+    ADD COLUMN search_document TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple',
+            first_name || ' ' || last_name || ' ' || user_name || ' ' ||
+            coalesce(user_alias, '') || ' ' || email || ' ' || coalesce(phone_number, ''))
+    ) STORED;
+
+CREATE INDEX idx_players_search_document ON tbl_players USING GIN (search_document);
+CREATE INDEX idx_players_search_text_trgm ON tbl_players USING GIN (search_text gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_players_search_text_trgm;
+DROP INDEX IF EXISTS idx_players_search_document;
+ALTER TABLE tbl_players
+    DROP COLUMN IF EXISTS search_document,
+    DROP COLUMN IF EXISTS search_text;
+
+DROP INDEX IF EXISTS idx_users_search_text_trgm;
+DROP INDEX IF EXISTS idx_users_search_document;
+ALTER TABLE tbl_users
+    DROP COLUMN IF EXISTS search_document,
+    DROP COLUMN IF EXISTS search_text;
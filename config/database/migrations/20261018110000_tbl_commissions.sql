@@ -0,0 +1,120 @@
+-- +goose Up
+-- Commission rates in percent, a rate applies from effective_from until the next one of the same account
+CREATE TABLE tbl_commission_rates (
+    id SERIAL PRIMARY KEY,
+    rate_uuid UUID NOT NULL UNIQUE,
+    subject_type VARCHAR(16) NOT NULL,
+    subject_id INTEGER NOT NULL,
+    rate DECIMAL(10,2) NOT NULL,
+    effective_from DATE NOT NULL,
+    note VARCHAR(255),
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT chk_commission_rates_subject_type CHECK (subject_type IN ('user', 'player')),
+    CONSTRAINT chk_commission_rates_rate CHECK (rate >= 0 AND rate <= 100),
+    CONSTRAINT uq_commission_rates_effective UNIQUE (subject_type, subject_id, effective_from)
+);
+
+-- Sales or turnover the commission is earned on, reference makes imports idempotent
+CREATE TABLE tbl_commission_turnovers (
+    id SERIAL PRIMARY KEY,
+    turnover_uuid UUID NOT NULL UNIQUE,
+    subject_type VARCHAR(16) NOT NULL,
+    subject_id INTEGER NOT NULL,
+    amount DECIMAL(14,2) NOT NULL,
+    turnover_date DATE NOT NULL,
+    reference VARCHAR(255),
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT chk_commission_turnovers_subject_type CHECK (subject_type IN ('user', 'player'))
+);
+
+CREATE INDEX idx_commission_turnovers_subject_date ON tbl_commission_turnovers (subject_type, subject_id, turnover_date);
+CREATE UNIQUE INDEX uq_commission_turnovers_reference ON tbl_commission_turnovers (subject_type, subject_id, reference)
+    WHERE reference IS NOT NULL;
+
+-- Payout statements, pending -> approved -> paid
+CREATE TABLE tbl_commission_payouts (
+    id SERIAL PRIMARY KEY,
+    payout_uuid UUID NOT NULL UNIQUE,
+    subject_type VARCHAR(16) NOT NULL,
+    subject_id INTEGER NOT NULL,
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL,
+    turnover DECIMAL(14,2) NOT NULL,
+    commission DECIMAL(14,2) NOT NULL,
+    lines JSONB NOT NULL DEFAULT '[]',
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    approved_by INTEGER,
+    approved_at TIMESTAMP,
+    paid_by INTEGER,
+    paid_at TIMESTAMP,
+    paid_reference VARCHAR(255),
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL,
+    updated_by INTEGER,
+    updated_at TIMESTAMP,
+    CONSTRAINT chk_commission_payouts_subject_type CHECK (subject_type IN ('user', 'player')),
+    CONSTRAINT chk_commission_payouts_status CHECK (status IN ('pending', 'approved', 'paid')),
+    CONSTRAINT chk_commission_payouts_period CHECK (period_from <= period_to)
+);
+
+CREATE INDEX idx_commission_payouts_subject_period ON tbl_commission_payouts (subject_type, subject_id, period_from, period_to);
+
+-- The current rate of every account starts the history
+INSERT INTO tbl_commission_rates (rate_uuid, subject_type, subject_id, rate, effective_from, note, created_by, created_at)
+SELECT uuid_generate_v4(), 'user', id, commission, COALESCE(created_at, LOCALTIMESTAMP)::date, 'Initial rate', created_by, LOCALTIMESTAMP
+FROM tbl_users WHERE commission IS NOT NULL;
+
+INSERT INTO tbl_commission_rates (rate_uuid, subject_type, subject_id, rate, effective_from, note, created_by, created_at)
+SELECT uuid_generate_v4(), 'player', id, commission, COALESCE(created_at, LOCALTIMESTAMP)::date, 'Initial rate', created_by, LOCALTIMESTAMP
+FROM tbl_players WHERE commission IS NOT NULL;
+
+-- Every change of the commission column is kept as a rate effective from the day of the change,
+-- unless the rate in effect that day already has the new value
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION fn_commission_rate_history() RETURNS TRIGGER AS $$
+DECLARE
+    v_subject_type VARCHAR := TG_ARGV[0];
+    v_effective_from DATE := COALESCE(NEW.updated_at, LOCALTIMESTAMP)::date;
+    v_current DECIMAL;
+BEGIN
+    IF NEW.commission IS NULL OR NEW.commission IS NOT DISTINCT FROM OLD.commission THEN
+        RETURN NEW;
+    END IF;
+
+    SELECT rate INTO v_current
+    FROM tbl_commission_rates
+    WHERE subject_type = v_subject_type AND subject_id = NEW.id AND effective_from <= v_effective_from
+    ORDER BY effective_from DESC
+    LIMIT 1;
+
+    IF v_current IS NOT DISTINCT FROM NEW.commission THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO tbl_commission_rates (rate_uuid, subject_type, subject_id, rate, effective_from, created_by, created_at)
+    VALUES (uuid_generate_v4(), v_subject_type, NEW.id, NEW.commission, v_effective_from, NEW.updated_by, LOCALTIMESTAMP)
+    ON CONFLICT (subject_type, subject_id, effective_from)
+    DO UPDATE SET rate = EXCLUDED.rate, created_by = EXCLUDED.created_by, created_at = EXCLUDED.created_at;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER trg_users_commission_history
+    AFTER UPDATE OF commission ON tbl_users
+    FOR EACH ROW EXECUTE FUNCTION fn_commission_rate_history('user');
+
+CREATE TRIGGER trg_players_commission_history
+    AFTER UPDATE OF commission ON tbl_players
+    FOR EACH ROW EXECUTE FUNCTION fn_commission_rate_history('player');
+
+-- +goose Down
+DROP TRIGGER IF EXISTS trg_players_commission_history ON tbl_players;
+DROP TRIGGER IF EXISTS trg_users_commission_history ON tbl_users;
+DROP FUNCTION IF EXISTS fn_commission_rate_history();
+DROP TABLE IF EXISTS tbl_commission_payouts;
+DROP TABLE IF EXISTS tbl_commission_turnovers;
+DROP TABLE IF EXISTS tbl_commission_rates;
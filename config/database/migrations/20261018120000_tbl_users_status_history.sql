@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE tbl_users
+    ADD COLUMN suspended_until TIMESTAMP NULL;
+
+-- Every status change of a user, a suspension may carry the time it ends
+CREATE TABLE tbl_users_status_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    from_status_id INTEGER NOT NULL,
+    to_status_id INTEGER NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    suspended_until TIMESTAMP NULL,
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_users_status_history_user ON tbl_users_status_history (user_id, created_at DESC);
+CREATE INDEX idx_users_suspended_until ON tbl_users (suspended_until) WHERE status_id = 3;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_suspended_until;
+DROP TABLE IF EXISTS tbl_users_status_history;
+
+ALTER TABLE tbl_users
+    DROP COLUMN IF EXISTS suspended_until;
@@ -0,0 +1,52 @@
+-- +goose Up
+-- Password policy of the users of a role, max age and history of 0 disable the check
+ALTER TABLE tbl_roles
+    ADD COLUMN password_min_length INTEGER NOT NULL DEFAULT 8,
+    ADD COLUMN password_require_upper BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN password_require_lower BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN password_require_digit BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN password_require_symbol BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN password_reject_common BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN password_history INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN password_max_age_days INTEGER NOT NULL DEFAULT 0;
+
+UPDATE tbl_roles SET
+    password_min_length = 12,
+    password_require_upper = true,
+    password_require_lower = true,
+    password_require_symbol = true,
+    password_history = 5,
+    password_max_age_days = 90
+WHERE user_role_name = 'admin';
+
+-- Existing passwords start their max age when the policy is introduced
+ALTER TABLE tbl_users
+    ADD COLUMN password_changed_at TIMESTAMP NULL;
+
+UPDATE tbl_users SET password_changed_at = NOW();
+
+-- Previous passwords of a user, only the HMAC of the password is stored
+CREATE TABLE tbl_users_password_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    password_hash VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_users_password_history_user ON tbl_users_password_history (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS tbl_users_password_history;
+
+ALTER TABLE tbl_users
+    DROP COLUMN IF EXISTS password_changed_at;
+
+ALTER TABLE tbl_roles
+    DROP COLUMN IF EXISTS password_min_length,
+    DROP COLUMN IF EXISTS password_require_upper,
+    DROP COLUMN IF EXISTS password_require_lower,
+    DROP COLUMN IF EXISTS password_require_digit,
+    DROP COLUMN IF EXISTS password_require_symbol,
+    DROP COLUMN IF EXISTS password_reject_common,
+    DROP COLUMN IF EXISTS password_history,
+    DROP COLUMN IF EXISTS password_max_age_days;
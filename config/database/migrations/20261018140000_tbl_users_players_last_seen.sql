@@ -0,0 +1,14 @@
+-- +goose Up
+-- Last time the account had a live WebSocket or event stream, written when it goes offline
+ALTER TABLE tbl_users
+    ADD COLUMN last_seen_at TIMESTAMP NULL;
+
+ALTER TABLE tbl_players
+    ADD COLUMN last_seen_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE tbl_players
+    DROP COLUMN IF EXISTS last_seen_at;
+
+ALTER TABLE tbl_users
+    DROP COLUMN IF EXISTS last_seen_at;
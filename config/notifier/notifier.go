@@ -0,0 +1,27 @@
+package notifier
+
+import (
+	"log"
+	"os"
+	pkg_notifier "snack-shop/pkg/notifier"
+	"sync"
+)
+
+var (
+	once     sync.Once
+	notifier pkg_notifier.Notifier
+)
+
+// NewNotifier initializes the notifier selected by NOTIFIER_DRIVER
+func NewNotifier() pkg_notifier.Notifier {
+	once.Do(func() {
+		driver := os.Getenv("NOTIFIER_DRIVER")
+		switch driver {
+		case "", "log":
+			notifier = pkg_notifier.NewLogNotifier()
+		default:
+			log.Fatalf("Unknown notifier driver: %s", driver)
+		}
+	})
+	return notifier
+}
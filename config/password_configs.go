@@ -0,0 +1,37 @@
+package configs
+
+import (
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+type PasswordConfig struct {
+	HistorySecret   string
+	ChallengeSecret string
+	CommonListFile  string
+}
+
+func InitPassword() *PasswordConfig {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf("No .env file found, using system environment variables")
+	}
+
+	history_secret := os.Getenv("PASSWORD_HISTORY_SECRET")
+	if history_secret == "" {
+		history_secret = os.Getenv("JWT_SECRET_KEY")
+	}
+	common_list_file := os.Getenv("PASSWORD_COMMON_LIST")
+	if common_list_file == "" {
+		common_list_file = "./config/password/common_passwords.txt"
+	}
+
+	// Challenge tokens are issued by login, which signs with the JWT secret
+	return &PasswordConfig{
+		HistorySecret:   history_secret,
+		ChallengeSecret: os.Getenv("JWT_SECRET_KEY"),
+		CommonListFile:  common_list_file,
+	}
+}
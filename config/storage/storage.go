@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"log"
+	config "snack-shop/config"
+	custom_log "snack-shop/pkg/logs"
+	pkg_storage "snack-shop/pkg/storage"
+	"sync"
+)
+
+var (
+	once  sync.Once
+	store pkg_storage.Storage
+)
+
+// NewStorage initializes the file storage backend selected by STORAGE_DRIVER
+func NewStorage() pkg_storage.Storage {
+	storage_config := config.InitStorage()
+
+	once.Do(func() {
+		var err error
+		switch storage_config.Driver {
+		case "s3":
+			store, err = pkg_storage.NewS3Storage(pkg_storage.S3Config{
+				Endpoint:     storage_config.S3Endpoint,
+				Region:       storage_config.S3Region,
+				Bucket:       storage_config.S3Bucket,
+				AccessKey:    storage_config.S3AccessKey,
+				SecretKey:    storage_config.S3SecretKey,
+				UsePathStyle: storage_config.S3UsePathStyle,
+			})
+		case "local":
+			store, err = pkg_storage.NewLocalStorage(storage_config.LocalPath)
+		default:
+			log.Fatalf("Unknown storage driver: %s", storage_config.Driver)
+		}
+		if err != nil {
+			custom_log.NewCustomLog("storage_init_failed", err.Error(), "error")
+			log.Fatalf("Could not initialize storage: %v", err)
+		}
+		log.Printf("Storage initialized with driver: %s", storage_config.Driver)
+	})
+	return store
+}
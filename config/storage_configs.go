@@ -0,0 +1,63 @@
+package configs
+
+import (
+	"log"
+	"os"
+	env "snack-shop/pkg/utils"
+
+	"github.com/joho/godotenv"
+)
+
+type StorageConfig struct {
+	Driver         string
+	LocalPath      string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3UsePathStyle bool
+	SigningKey     string
+	UrlExpire      int
+	MaxUploadSize  int
+	ThumbnailSizes string
+}
+
+func InitStorage() *StorageConfig {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf("No .env file found, using system environment variables")
+	}
+
+	driver := os.Getenv("STORAGE_DRIVER")
+	if driver == "" {
+		driver = "local"
+	}
+	local_path := os.Getenv("STORAGE_LOCAL_PATH")
+	if local_path == "" {
+		local_path = "./storage"
+	}
+	signing_key := os.Getenv("STORAGE_SIGNING_KEY")
+	if signing_key == "" {
+		signing_key = os.Getenv("JWT_SECRET_KEY")
+	}
+	thumbnail_sizes := os.Getenv("PHOTO_THUMBNAIL_SIZES")
+	if thumbnail_sizes == "" {
+		thumbnail_sizes = "64,256"
+	}
+
+	return &StorageConfig{
+		Driver:         driver,
+		LocalPath:      local_path,
+		S3Endpoint:     os.Getenv("STORAGE_S3_ENDPOINT"),
+		S3Region:       os.Getenv("STORAGE_S3_REGION"),
+		S3Bucket:       os.Getenv("STORAGE_S3_BUCKET"),
+		S3AccessKey:    os.Getenv("STORAGE_S3_ACCESS_KEY"),
+		S3SecretKey:    os.Getenv("STORAGE_S3_SECRET_KEY"),
+		S3UsePathStyle: os.Getenv("STORAGE_S3_USE_PATH_STYLE") == "true",
+		SigningKey:     signing_key,
+		UrlExpire:      env.GetenvInt("STORAGE_URL_EXPIRE", 900),
+		MaxUploadSize:  env.GetenvInt("PHOTO_MAX_UPLOAD_SIZE", 2*1024*1024),
+		ThumbnailSizes: thumbnail_sizes,
+	}
+}
@@ -0,0 +1,44 @@
+package configs
+
+import (
+	"fmt"
+	"log"
+	"os"
+	env "snack-shop/pkg/utils"
+
+	"github.com/joho/godotenv"
+)
+
+type VerificationConfig struct {
+	Secret         string
+	EmailLinkUrl   string
+	EmailExpire    int
+	OtpExpire      int
+	OtpMaxAttempts int
+	ResendCooldown int
+}
+
+func InitVerification() *VerificationConfig {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf("No .env file found, using system environment variables")
+	}
+
+	secret := os.Getenv("VERIFICATION_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET_KEY")
+	}
+	email_link_url := os.Getenv("VERIFY_EMAIL_URL")
+	if email_link_url == "" {
+		email_link_url = fmt.Sprintf("http://%s:%s/api/v1/auth/verify/email", os.Getenv("API_HOST"), os.Getenv("API_PORT"))
+	}
+
+	return &VerificationConfig{
+		Secret:         secret,
+		EmailLinkUrl:   email_link_url,
+		EmailExpire:    env.GetenvInt("VERIFY_EMAIL_EXPIRE", 1440),
+		OtpExpire:      env.GetenvInt("VERIFY_OTP_EXPIRE", 300),
+		OtpMaxAttempts: env.GetenvInt("VERIFY_OTP_MAX_ATTEMPTS", 5),
+		ResendCooldown: env.GetenvInt("VERIFY_RESEND_COOLDOWN", 60),
+	}
+}
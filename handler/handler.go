@@ -1,13 +1,26 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/redis/go-redis/v9"
 
 	auth "snack-shop/internal/auth"
+	commission "snack-shop/internal/commission"
+	photo "snack-shop/internal/photo"
+	player "snack-shop/internal/player"
 	user "snack-shop/internal/user"
+	verification "snack-shop/internal/verification"
+	websocket "snack-shop/internal/websocket"
 	middleware "snack-shop/pkg/middleware"
+	"snack-shop/pkg/notifier"
+	"snack-shop/pkg/storage"
 )
 
 type ServiceHandlers struct {
@@ -15,28 +28,99 @@ type ServiceHandlers struct {
 }
 
 type FrontService struct {
-	AuthHandler *auth.AuthRoute
-	UserHandler *user.UserRoute
+	AuthHandler         *auth.AuthRoute
+	UserHandler         *user.UserRoute
+	PhotoHandler        *photo.PhotoRoute
+	PlayerHandler       *player.PlayerRoute
+	CommissionHandler   *commission.CommissionRoute
+	VerificationHandler *verification.VerificationRoute
+	WebSocketHandler    *websocket.WebSocketRoute
+
+	app        *fiber.App
+	stop       context.CancelFunc // Stops the background work
+	background *sync.WaitGroup    // Done once the background work finished
 }
 
-func NewFrontService(app *fiber.App, db_pool *sqlx.DB, redis *redis.Client) *FrontService {
+func NewFrontService(app *fiber.App, db_pool *sqlx.DB, redis *redis.Client, store storage.Storage, n notifier.Notifier) *FrontService {
+
+	// Background work runs until Shutdown
+	ctx, stop := context.WithCancel(context.Background())
+	background := &sync.WaitGroup{}
 
 	// Authentication
 	auth := auth.NewAuthRoute(app, db_pool, redis).RegisterAuthRoute()
 
+	// Signed file downloads are authorized by their URL signature, not by JWT
+	photo := photo.NewPhotoRoute(app, db_pool, store).RegisterFileRoute()
+
+	// Verification links and codes must work for accounts that cannot log in yet
+	verification := verification.NewVerificationRoute(app, db_pool, n).RegisterPublicRoute()
+
+	// Expired passwords are changed with the challenge token of the login response
+	user := user.NewUserRoute(app, db_pool).RegisterPublicRoute()
+
+	// Suspensions that reached their end date are lifted once a minute
+	user.StartSuspensionExpiry(ctx, background, time.Minute)
+
 	// Middleware
 	middleware.NewJwtMinddleWare(app, db_pool, redis)
 
-	user := user.NewUserRoute(app, db_pool).RegisterUserRoute()
+	user.RegisterUserRoute()
+	player := player.NewPlayerRoute(app, db_pool).RegisterPlayerRoute()
+	commission := commission.NewCommissionRoute(app, db_pool).RegisterCommissionRoute()
+	websocket := websocket.NewWebSocketRoute(ctx, background, app, db_pool, redis).RegisterWebSocketRoute()
+	photo.RegisterPhotoRoute()
+	verification.RegisterVerificationRoute()
 	return &FrontService{
-		AuthHandler: auth,
-		UserHandler: user,
+		AuthHandler:         auth,
+		UserHandler:         user,
+		PhotoHandler:        photo,
+		PlayerHandler:       player,
+		CommissionHandler:   commission,
+		VerificationHandler: verification,
+		WebSocketHandler:    websocket,
+
+		app:        app,
+		stop:       stop,
+		background: background,
+	}
+}
+
+// Shutdown stops accepting connections and drains the in-flight requests, closes the WebSockets
+// and event streams, then stops the background work and waits for it, all within ctx. The
+// database and Redis are still open for the work that finishes, the caller closes them after.
+func (f *FrontService) Shutdown(ctx context.Context) error {
+	// Event streams are in-flight requests, the server drains once the hub closed them
+	errServer := make(chan error, 1)
+	go func() {
+		errServer <- f.app.ShutdownWithContext(ctx)
+	}()
+
+	var errs []error
+	if err := f.WebSocketHandler.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("websocket: %w", err))
+	}
+	if err := <-errServer; err != nil {
+		errs = append(errs, fmt.Errorf("http: %w", err))
+	}
+
+	f.stop()
+	done := make(chan struct{})
+	go func() {
+		f.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("background work: %w", ctx.Err()))
 	}
+	return errors.Join(errs...)
 }
 
-func NewServiceHandlers(app *fiber.App, db_pool *sqlx.DB, redis *redis.Client) *ServiceHandlers {
+func NewServiceHandlers(app *fiber.App, db_pool *sqlx.DB, redis *redis.Client, store storage.Storage, n notifier.Notifier) *ServiceHandlers {
 
 	return &ServiceHandlers{
-		Fronted: NewFrontService(app, db_pool, redis),
+		Fronted: NewFrontService(app, db_pool, redis, store, n),
 	}
 }
@@ -23,6 +23,14 @@ func NewAuthHandler(dbPool *sqlx.DB, redisClient *redis.Client) *AuthHandler {
 	}
 }
 
+// loginForbidden are the login errors of right credentials for an account that may not login, they
+// get 403 and their own status code so clients can tell them apart from wrong credentials
+var loginForbidden = map[string]int{
+	"contact_not_verified": constants.ContactNotVerified,
+	"account_suspended":    constants.AccountSuspended,
+	"account_inactive":     constants.AccountInactive,
+}
+
 // Login handles user login request
 func (a *AuthHandler) Login(c *fiber.Ctx) error {
 	v := custom_validator.NewValidator()
@@ -43,6 +51,13 @@ func (a *AuthHandler) Login(c *fiber.Ctx) error {
 
 	if err != nil {
 		msg := utils.Translate(err.MessageID, nil, c)
+		if code, ok := loginForbidden[err.MessageID]; ok {
+			return c.Status(fiber.StatusForbidden).JSON(response.NewResponseError(
+				msg,
+				code,
+				err.Err,
+			))
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(response.NewResponseError(
 			msg,
 			constants.LoginFailed,
@@ -50,6 +65,14 @@ func (a *AuthHandler) Login(c *fiber.Ctx) error {
 		))
 	}
 
+	if success.Challenge != nil {
+		return c.Status(fiber.StatusOK).JSON(response.NewResponse(
+			utils.Translate("password_change_required", nil, c),
+			constants.PasswordChangeRequired,
+			success,
+		))
+	}
+
 	msg := utils.Translate("login_success", nil, c)
 
 	return c.Status(fiber.StatusOK).JSON(response.NewResponse(
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"time"
+
 	custom_validator "snack-shop/pkg/validator"
 
 	"github.com/gofiber/fiber/v2"
@@ -31,15 +33,33 @@ type AuthResponse struct {
 		Token     string `json:"token"`
 		TokenType string `json:"token_type"`
 	} `json:"auths"`
+	Challenge *AuthChallenge `json:"challenge,omitempty"`
+}
+
+// AuthChallenge replaces the session token when the user must act before logging in,
+// the token is only accepted by the endpoint of the challenge
+type AuthChallenge struct {
+	Type      string    `json:"type"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type MemberData struct {
-	ID       int       `db:"id"`
-	Username string    `db:"user_name"`
-	UserUuid uuid.UUID `db:"user_uuid"`
-	RoleId   int       `db:"role_id"`
-	Email    string    `db:"email"`
-	Password string    `db:"password"`
+	ID                   int        `db:"id"`
+	Username             string     `db:"user_name"`
+	UserUuid             uuid.UUID  `db:"user_uuid"`
+	RoleId               int        `db:"role_id"`
+	Email                string     `db:"email"`
+	Password             string     `db:"password"`
+	EmailVerifiedAt      *time.Time `db:"email_verified_at"`
+	PhoneVerifiedAt      *time.Time `db:"phone_verified_at"`
+	RequireVerifiedEmail bool       `db:"require_verified_email"`
+	RequireVerifiedPhone bool       `db:"require_verified_phone"`
+	StatusId             int        `db:"status_id"`
+	SuspendedUntil       *time.Time `db:"suspended_until"`
+	SuspensionExpired    bool       `db:"suspension_expired"`
+	PasswordChangedAt    *time.Time `db:"password_changed_at"`
+	PasswordExpired      bool       `db:"password_expired"`
 }
 
 type RedisSession struct {
@@ -8,8 +8,10 @@ import (
 	"os"
 	"time"
 
+	"snack-shop/pkg/events"
 	custom_log "snack-shop/pkg/logs"
 	types "snack-shop/pkg/model"
+	password_policy "snack-shop/pkg/password"
 	redis_util "snack-shop/pkg/redis"
 	"snack-shop/pkg/responses"
 	util "snack-shop/pkg/utils"
@@ -43,24 +45,97 @@ func (a *authRepositoryImpl) Login(username, password string) (*AuthResponse, *r
 
 	query := `
 		SELECT
-			id, 
-			user_name,
-			user_uuid,
-			role_id,
-			email,
-			password
-		FROM tbl_users 
-		WHERE user_name = $1 AND password = $2 AND deleted_at IS NULL
+			u.id, 
+			u.user_name,
+			u.user_uuid,
+			u.role_id,
+			u.email,
+			u.password,
+			u.email_verified_at,
+			u.phone_verified_at,
+			COALESCE(r.require_verified_email, false) AS require_verified_email,
+			COALESCE(r.require_verified_phone, false) AS require_verified_phone,
+			u.status_id,
+			u.suspended_until,
+			(u.status_id = $3 AND COALESCE(u.suspended_until <= $4, false)) AS suspension_expired,
+			u.password_changed_at,
+			(COALESCE(r.password_max_age_days, 0) > 0 AND (
+				u.password_changed_at IS NULL OR
+				u.password_changed_at + make_interval(days => r.password_max_age_days) <= $4
+			)) AS password_expired
+		FROM tbl_users u
+		LEFT JOIN tbl_roles r ON u.role_id = r.id
+		WHERE u.user_name = $1 AND u.password = $2 AND u.deleted_at IS NULL
 	`
 
-	err := a.dbPool.Get(&member, query, username, password)
+	now, err := localNow()
+	if err != nil {
+		custom_log.NewCustomLog("login_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("login_failed", fmt.Errorf("cannot login. Please try again later"))
+	}
+
+	err = a.dbPool.Get(&member, query, username, password, types.StatusSuspended, now)
 	if err != nil {
 		custom_log.NewCustomLog("member_not_found", err.Error(), "error")
 		return nil, responses.NewErrorResponse("member_not_found", fmt.Errorf("user not found. Please check the provided information"))
 	}
 
+	// Only active accounts get a session, an ended suspension counts as active until the expiry job has run
+	switch {
+	case member.StatusId == types.StatusActive || member.SuspensionExpired:
+	case member.StatusId == types.StatusSuspended:
+		custom_log.NewCustomLog("account_suspended", fmt.Sprintf("suspended user %s tried to login", member.Username), "warn")
+		if member.SuspendedUntil != nil {
+			return nil, responses.NewErrorResponse("account_suspended", fmt.Errorf("account is suspended until %s", member.SuspendedUntil.Format("2006-01-02 15:04:05")))
+		}
+		return nil, responses.NewErrorResponse("account_suspended", fmt.Errorf("account is suspended"))
+	default:
+		custom_log.NewCustomLog("account_inactive", fmt.Sprintf("inactive user %s tried to login", member.Username), "warn")
+		return nil, responses.NewErrorResponse("account_inactive", fmt.Errorf("account is inactive"))
+	}
+
+	// Roles can require verified contact details before a session is issued
+	if member.RequireVerifiedEmail && member.EmailVerifiedAt == nil {
+		custom_log.NewCustomLog("contact_not_verified", fmt.Sprintf("user %s has not verified the email address", member.Username), "warn")
+		return nil, responses.NewErrorResponse("contact_not_verified", fmt.Errorf("email address must be verified before login"))
+	}
+	if member.RequireVerifiedPhone && member.PhoneVerifiedAt == nil {
+		custom_log.NewCustomLog("contact_not_verified", fmt.Sprintf("user %s has not verified the phone number", member.Username), "warn")
+		return nil, responses.NewErrorResponse("contact_not_verified", fmt.Errorf("phone number must be verified before login"))
+	}
+
+	_ = godotenv.Load() // Ignore error if .env file not found
+
+	secretKey := os.Getenv("JWT_SECRET_KEY")
+
 	var res AuthResponse
 
+	// An expired password gets a short lived challenge instead of a session
+	if member.PasswordExpired {
+		var changed_at int64
+		if member.PasswordChangedAt != nil {
+			changed_at = member.PasswordChangedAt.Unix()
+		}
+		challenge := password_policy.Challenge{
+			UserUUID:  member.UserUuid,
+			ChangedAt: changed_at,
+			ExpiresAt: time.Now().Add(time.Duration(util.GetenvInt("PASSWORD_CHALLENGE_EXPIRE", 600)) * time.Second),
+		}
+		challengeToken, err := password_policy.SignChallenge(secretKey, challenge)
+		if err != nil {
+			custom_log.NewCustomLog("jwt_failed", err.Error(), "error")
+			return nil, responses.NewErrorResponse("jwt_failed", fmt.Errorf("failed to get jwt"))
+		}
+
+		custom_log.NewCustomLog("password_change_required", fmt.Sprintf("password of user %s has expired", member.Username), "info")
+		res.Challenge = &AuthChallenge{
+			Type:      password_policy.ChallengePurpose,
+			Token:     challengeToken,
+			ExpiresAt: challenge.ExpiresAt,
+		}
+		return &res, nil
+	}
+
 	hours := util.GetenvInt("JWT_EXP_HOUR", 7)
 	expirationTime := time.Now().Add(time.Duration(hours) * time.Hour)
 	loginSession, err := uuid.NewV7()
@@ -84,10 +159,6 @@ func (a *authRepositoryImpl) Login(username, password string) (*AuthResponse, *r
 	redisUtil := redis_util.NewRedisUtil(a.redis)
 	redisUtil.SetCacheKey(key, claims, context.Background())
 
-	_ = godotenv.Load() // Ignore error if .env file not found
-
-	secretKey := os.Getenv("JWT_SECRET_KEY")
-
 	updateQuery := `	
 		UPDATE tbl_users
 		SET login_session = $1
@@ -99,6 +170,13 @@ func (a *authRepositoryImpl) Login(username, password string) (*AuthResponse, *r
 		return nil, responses.NewErrorResponse("session_update_failed", fmt.Errorf("cannot update session"))
 	}
 
+	// A new login replaces the session of the other devices
+	events.Emit(events.SessionInvalidated, events.Session{
+		Key:    fmt.Sprintf("user%d", member.ID),
+		Reason: events.ReasonSessionReplaced,
+		Keep:   loginSession.String(),
+	})
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(secretKey))
 	if err != nil {
@@ -150,10 +228,18 @@ func (a *authRepositoryImpl) CheckSession(loginSession string) (*types.UserSessi
             login_session
         FROM tbl_users
         WHERE login_session = $1 
+            AND deleted_at IS NULL
+            AND (status_id = $2 OR (status_id = $3 AND suspended_until <= $4))
         LIMIT 1
     `
 
-	err := a.dbPool.Get(&session, query, loginSession)
+	now, err := localNow()
+	if err != nil {
+		custom_log.NewCustomLog("query_data_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("query_data_failed", fmt.Errorf("cannot check login session"))
+	}
+
+	err = a.dbPool.Get(&session, query, loginSession, types.StatusActive, types.StatusSuspended, now)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			custom_log.NewCustomLog("invalid_session_id", "invalid login session: "+loginSession, "warn")
@@ -168,3 +254,12 @@ func (a *authRepositoryImpl) CheckSession(loginSession string) (*types.UserSessi
 
 	return &session, nil
 }
+
+// localNow is the wall clock of APP_TIMEZONE the timestamps are stored in
+func localNow() (time.Time, error) {
+	location, err := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load location: %w", err)
+	}
+	return time.Now().In(location), nil
+}
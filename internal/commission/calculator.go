@@ -0,0 +1,60 @@
+package commission
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var hundred = decimal.NewFromInt(100)
+
+// DailyTurnover is the turnover of an account summed per day
+type DailyTurnover struct {
+	Date   time.Time       `db:"turnover_date"`
+	Amount decimal.Decimal `db:"amount"`
+}
+
+// Calculate splits the period from..to (both inclusive) at every rate change and applies each rate
+// to the turnover of its days. rates must be ordered by EffectiveFrom, days before the first rate
+// earn nothing. The commission of each line is rounded to cents, the totals are the sum of the lines.
+func Calculate(rates []Rate, turnovers []DailyTurnover, from time.Time, to time.Time) (CommissionLines, decimal.Decimal, decimal.Decimal) {
+	// The rate in effect on the first day, later rates start new lines
+	current := decimal.Zero
+	next := 0
+	for next < len(rates) && !rates[next].EffectiveFrom.After(from) {
+		current = rates[next].Rate
+		next++
+	}
+
+	lines := CommissionLines{}
+	start := from
+	for {
+		end := to
+		if next < len(rates) && !rates[next].EffectiveFrom.After(to) {
+			end = rates[next].EffectiveFrom.AddDate(0, 0, -1)
+		}
+
+		line := CommissionLine{From: start, To: end, Rate: current, Turnover: decimal.Zero}
+		for _, turnover := range turnovers {
+			if !turnover.Date.Before(start) && !turnover.Date.After(end) {
+				line.Turnover = line.Turnover.Add(turnover.Amount)
+			}
+		}
+		line.Commission = line.Turnover.Mul(line.Rate).Div(hundred).Round(2)
+		lines = append(lines, line)
+
+		if end.Equal(to) {
+			break
+		}
+		start = rates[next].EffectiveFrom
+		current = rates[next].Rate
+		next++
+	}
+
+	totalTurnover, totalCommission := decimal.Zero, decimal.Zero
+	for _, line := range lines {
+		totalTurnover = totalTurnover.Add(line.Turnover)
+		totalCommission = totalCommission.Add(line.Commission)
+	}
+	return lines, totalTurnover, totalCommission
+}
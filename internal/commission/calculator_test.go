@@ -0,0 +1,153 @@
+package commission
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func day(value string) time.Time {
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func rate(effectiveFrom string, value string) Rate {
+	return Rate{EffectiveFrom: day(effectiveFrom), Rate: decimal.RequireFromString(value)}
+}
+
+func turnover(date string, amount string) DailyTurnover {
+	return DailyTurnover{Date: day(date), Amount: decimal.RequireFromString(amount)}
+}
+
+func formatLine(line CommissionLine) string {
+	return fmt.Sprintf("%s..%s %s%% of %s = %s", line.From.Format(time.DateOnly), line.To.Format(time.DateOnly),
+		line.Rate, line.Turnover, line.Commission)
+}
+
+func TestCalculate(t *testing.T) {
+	turnovers := []DailyTurnover{
+		turnover("2026-08-31", "1000"),
+		turnover("2026-09-01", "100"),
+		turnover("2026-09-15", "200"),
+		turnover("2026-09-16", "300"),
+		turnover("2026-09-30", "400"),
+		turnover("2026-10-01", "1000"),
+	}
+
+	tests := []struct {
+		name       string
+		rates      []Rate
+		turnovers  []DailyTurnover
+		lines      []string
+		turnover   string
+		commission string
+	}{
+		{
+			name:       "no rate",
+			turnovers:  turnovers,
+			lines:      []string{"2026-09-01..2026-09-30 0% of 1000 = 0"},
+			turnover:   "1000",
+			commission: "0",
+		},
+		{
+			name:       "rate before the period",
+			rates:      []Rate{rate("2026-01-01", "5")},
+			turnovers:  turnovers,
+			lines:      []string{"2026-09-01..2026-09-30 5% of 1000 = 50"},
+			turnover:   "1000",
+			commission: "50",
+		},
+		{
+			name:       "rate starting on the first day",
+			rates:      []Rate{rate("2026-01-01", "5"), rate("2026-09-01", "2")},
+			turnovers:  turnovers,
+			lines:      []string{"2026-09-01..2026-09-30 2% of 1000 = 20"},
+			turnover:   "1000",
+			commission: "20",
+		},
+		{
+			name:      "rate change inside the period",
+			rates:     []Rate{rate("2026-01-01", "5"), rate("2026-09-16", "7.5")},
+			turnovers: turnovers,
+			lines: []string{
+				"2026-09-01..2026-09-15 5% of 300 = 15",
+				"2026-09-16..2026-09-30 7.5% of 700 = 52.5",
+			},
+			turnover:   "1000",
+			commission: "67.5",
+		},
+		{
+			name:      "rate starting after from",
+			rates:     []Rate{rate("2026-09-16", "4")},
+			turnovers: turnovers,
+			lines: []string{
+				"2026-09-01..2026-09-15 0% of 300 = 0",
+				"2026-09-16..2026-09-30 4% of 700 = 28",
+			},
+			turnover:   "1000",
+			commission: "28",
+		},
+		{
+			name:      "rate starting on the last day",
+			rates:     []Rate{rate("2026-01-01", "5"), rate("2026-09-30", "10")},
+			turnovers: turnovers,
+			lines: []string{
+				"2026-09-01..2026-09-29 5% of 600 = 30",
+				"2026-09-30..2026-09-30 10% of 400 = 40",
+			},
+			turnover:   "1000",
+			commission: "70",
+		},
+		{
+			name:       "rate starting after the period",
+			rates:      []Rate{rate("2026-01-01", "5"), rate("2026-10-01", "10")},
+			turnovers:  turnovers,
+			lines:      []string{"2026-09-01..2026-09-30 5% of 1000 = 50"},
+			turnover:   "1000",
+			commission: "50",
+		},
+		{
+			name:      "rounding per line",
+			rates:     []Rate{rate("2026-01-01", "1.5"), rate("2026-09-16", "0.5")},
+			turnovers: []DailyTurnover{turnover("2026-09-01", "33.33"), turnover("2026-09-16", "1.01")},
+			lines: []string{
+				"2026-09-01..2026-09-15 1.5% of 33.33 = 0.5",
+				"2026-09-16..2026-09-30 0.5% of 1.01 = 0.01",
+			},
+			turnover:   "34.34",
+			commission: "0.51",
+		},
+		{
+			name:       "rounding down",
+			rates:      []Rate{rate("2026-01-01", "2.5")},
+			turnovers:  []DailyTurnover{turnover("2026-09-01", "0.19")},
+			lines:      []string{"2026-09-01..2026-09-30 2.5% of 0.19 = 0"},
+			turnover:   "0.19",
+			commission: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, totalTurnover, totalCommission := Calculate(tt.rates, tt.turnovers, day("2026-09-01"), day("2026-09-30"))
+			if len(lines) != len(tt.lines) {
+				t.Fatalf("expected %d lines, got %d", len(tt.lines), len(lines))
+			}
+			for i, line := range lines {
+				if got := formatLine(line); got != tt.lines[i] {
+					t.Fatalf("expected line %q, got %q", tt.lines[i], got)
+				}
+			}
+			if !totalTurnover.Equal(decimal.RequireFromString(tt.turnover)) {
+				t.Fatalf("expected turnover %s, got %s", tt.turnover, totalTurnover)
+			}
+			if !totalCommission.Equal(decimal.RequireFromString(tt.commission)) {
+				t.Fatalf("expected commission %s, got %s", tt.commission, totalCommission)
+			}
+		})
+	}
+}
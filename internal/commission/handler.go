@@ -0,0 +1,272 @@
+package commission
+
+import (
+	"net/http"
+
+	"snack-shop/pkg/constants"
+	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/postgres"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CommissionHandler struct
+type CommissionHandler struct {
+	db                *sqlx.DB
+	commissionService func(*fiber.Ctx) CommissionCreator
+}
+
+func NewHandler(db *sqlx.DB) *CommissionHandler {
+	return &CommissionHandler{
+		db: db,
+		commissionService: func(c *fiber.Ctx) CommissionCreator {
+			UserContext := c.Locals("UserContext")
+
+			var uCtx types.UserContext
+			if contextMap, ok := UserContext.(types.UserContext); ok {
+				uCtx = contextMap
+			} else {
+				custom_log.NewCustomLog("user_context_failed", "Failed to cast UserContext to map[string]interface{}", "warn")
+				uCtx = types.UserContext{}
+			}
+
+			return NewCommissionService(&uCtx, db)
+		},
+	}
+}
+
+func (h *CommissionHandler) ShowRates(c *fiber.Ctx) error {
+	subject, err_subject := ParseSubject(c)
+	var listRequest ListRequest
+	if err_subject == nil {
+		err_subject = listRequest.bind(c, utils.NewValidator())
+	}
+	if err_subject != nil {
+		return h.badRequest(c, "commission_rate_show_failed", constants.CommissionRateShowFailed, err_subject)
+	}
+
+	rates, err := h.commissionService(c).ShowRates(subject, listRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionRateShowFailed, err.Err)
+	}
+	return listResponse(c, listRequest.PageOptions, "commission_rate_show_success", constants.CommissionRateShowSuccess, rates, rates.Total, rates.Cursor)
+}
+
+func (h *CommissionHandler) CreateRate(c *fiber.Ctx) error {
+	subject, err_subject := ParseSubject(c)
+	var rateNewRequest RateNewRequest
+	if err_subject == nil {
+		err_subject = rateNewRequest.bind(c, utils.NewValidator())
+	}
+	if err_subject != nil {
+		return h.badRequest(c, "commission_rate_create_failed", constants.CommissionRateCreateFailed, err_subject)
+	}
+
+	rates, err := h.commissionService(c).CreateRate(subject, rateNewRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionRateCreateFailed, err.Err)
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("commission_rate_create_success", nil, c),
+		constants.CommissionRateCreateSuccess,
+		rates,
+	))
+}
+
+func (h *CommissionHandler) ShowTurnovers(c *fiber.Ctx) error {
+	subject, err_subject := ParseSubject(c)
+	var listRequest ListRequest
+	if err_subject == nil {
+		err_subject = listRequest.bind(c, utils.NewValidator())
+	}
+	if err_subject != nil {
+		return h.badRequest(c, "commission_turnover_show_failed", constants.CommissionTurnoverShowFailed, err_subject)
+	}
+
+	turnovers, err := h.commissionService(c).ShowTurnovers(subject, listRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionTurnoverShowFailed, err.Err)
+	}
+	return listResponse(c, listRequest.PageOptions, "commission_turnover_show_success", constants.CommissionTurnoverShowSuccess, turnovers, turnovers.Total, turnovers.Cursor)
+}
+
+func (h *CommissionHandler) CreateTurnover(c *fiber.Ctx) error {
+	subject, err_subject := ParseSubject(c)
+	var turnoverNewRequest TurnoverNewRequest
+	if err_subject == nil {
+		err_subject = turnoverNewRequest.bind(c, utils.NewValidator())
+	}
+	if err_subject != nil {
+		return h.badRequest(c, "commission_turnover_create_failed", constants.CommissionTurnoverCreateFailed, err_subject)
+	}
+
+	turnovers, err := h.commissionService(c).CreateTurnover(subject, turnoverNewRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionTurnoverCreateFailed, err.Err)
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("commission_turnover_create_success", nil, c),
+		constants.CommissionTurnoverCreateSuccess,
+		turnovers,
+	))
+}
+
+func (h *CommissionHandler) Calculate(c *fiber.Ctx) error {
+	subject, err_subject := ParseSubject(c)
+	var periodRequest PeriodRequest
+	if err_subject == nil {
+		err_subject = periodRequest.bind(c, utils.NewValidator())
+	}
+	if err_subject != nil {
+		return h.badRequest(c, "commission_calculate_failed", constants.CommissionCalculateFailed, err_subject)
+	}
+
+	statement, err := h.commissionService(c).Calculate(subject, periodRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionCalculateFailed, err.Err)
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("commission_calculate_success", nil, c),
+		constants.CommissionCalculateSuccess,
+		statement,
+	))
+}
+
+func (h *CommissionHandler) ShowPayouts(c *fiber.Ctx) error {
+	var listRequest ListRequest
+	if err := listRequest.bind(c, utils.NewValidator()); err != nil {
+		return h.badRequest(c, "commission_payout_show_failed", constants.CommissionPayoutShowFailed, err)
+	}
+
+	payouts, err := h.commissionService(c).ShowPayouts(listRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionPayoutShowFailed, err.Err)
+	}
+	return listResponse(c, listRequest.PageOptions, "commission_payout_show_success", constants.CommissionPayoutShowSuccess, payouts, payouts.Total, payouts.Cursor)
+}
+
+func (h *CommissionHandler) ShowPayout(c *fiber.Ctx) error {
+	payout_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return h.badRequest(c, "commission_payout_showone_failed", constants.CommissionPayoutShowOneFailed, err_uuid)
+	}
+
+	payouts, err := h.commissionService(c).ShowPayout(payout_uuid)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionPayoutShowOneFailed, err.Err)
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("commission_payout_showone_success", nil, c),
+		constants.CommissionPayoutShowOneSuccess,
+		payouts,
+	))
+}
+
+func (h *CommissionHandler) GeneratePayout(c *fiber.Ctx) error {
+	var payoutNewRequest PayoutNewRequest
+	if err := payoutNewRequest.bind(c, utils.NewValidator()); err != nil {
+		return h.badRequest(c, "commission_payout_create_failed", constants.CommissionPayoutCreateFailed, err)
+	}
+
+	payouts, err := h.commissionService(c).GeneratePayout(payoutNewRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionPayoutCreateFailed, err.Err)
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("commission_payout_create_success", nil, c),
+		constants.CommissionPayoutCreateSuccess,
+		payouts,
+	))
+}
+
+func (h *CommissionHandler) ApprovePayout(c *fiber.Ctx) error {
+	payout_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return h.badRequest(c, "commission_payout_approve_failed", constants.CommissionPayoutApproveFailed, err_uuid)
+	}
+
+	payouts, err := h.commissionService(c).ApprovePayout(payout_uuid)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionPayoutApproveFailed, err.Err)
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("commission_payout_approve_success", nil, c),
+		constants.CommissionPayoutApproveSuccess,
+		payouts,
+	))
+}
+
+func (h *CommissionHandler) PayPayout(c *fiber.Ctx) error {
+	payout_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	var payoutPaidRequest PayoutPaidRequest
+	if err_uuid == nil {
+		err_uuid = payoutPaidRequest.bind(c, utils.NewValidator())
+	}
+	if err_uuid != nil {
+		return h.badRequest(c, "commission_payout_pay_failed", constants.CommissionPayoutPayFailed, err_uuid)
+	}
+
+	payouts, err := h.commissionService(c).PayPayout(payout_uuid, payoutPaidRequest)
+	if err != nil {
+		return h.failed(c, err.MessageID, constants.CommissionPayoutPayFailed, err.Err)
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("commission_payout_pay_success", nil, c),
+		constants.CommissionPayoutPaySuccess,
+		payouts,
+	))
+}
+
+func (h *CommissionHandler) badRequest(c *fiber.Ctx, messageID string, code int, err error) error {
+	return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+		utils.Translate(messageID, nil, c),
+		code,
+		err,
+	))
+}
+
+func (h *CommissionHandler) failed(c *fiber.Ctx, messageID string, code int, err error) error {
+	status := http.StatusBadRequest
+	switch messageID {
+	case "commission_not_found":
+		status = http.StatusNotFound
+	case "commission_period_closed", "commission_payout_invalid_status", "commission_duplicate":
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(response.NewResponseError(
+		utils.Translate(messageID, nil, c),
+		code,
+		err,
+	))
+}
+
+func listResponse(c *fiber.Ctx, paging types.Paging, messageID string, code int, data interface{}, total int, cursor *postgres.CursorPage) error {
+	if paging.IsCursor() {
+		var count *int
+		if paging.CountTotal() {
+			count = &total
+		}
+		return c.Status(http.StatusOK).JSON(response.NewResponseWithCursor(
+			utils.Translate(messageID, nil, c),
+			code,
+			data,
+			paging.Perpage,
+			cursor.NextCursor,
+			cursor.PrevCursor,
+			count,
+		))
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponseWithPaging(
+		utils.Translate(messageID, nil, c),
+		code,
+		data,
+		paging.Page,
+		paging.Perpage,
+		total,
+	))
+}
@@ -0,0 +1,375 @@
+package commission
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/postgres"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Accounts a commission is paid to
+const (
+	SubjectUser   = "user"
+	SubjectPlayer = "player"
+)
+
+// Payout statuses, a statement moves from pending to approved to paid
+const (
+	PayoutPending  = "pending"
+	PayoutApproved = "approved"
+	PayoutPaid     = "paid"
+)
+
+const dateLayout = "2006-01-02"
+
+type subjectTable struct {
+	table      string
+	uuidColumn string
+	rowVersion bool // The ETag of the account is its row_version, every write must bump it
+}
+
+var subjectTables = map[string]subjectTable{
+	SubjectUser:   {table: "tbl_users", uuidColumn: "user_uuid", rowVersion: true},
+	SubjectPlayer: {table: "tbl_players", uuidColumn: "player_uuid"},
+}
+
+// Subject identifies the account of a rate, turnover or payout in a request path
+type Subject struct {
+	Type string
+	UUID uuid.UUID
+}
+
+func ParseSubject(c *fiber.Ctx) (Subject, error) {
+	subjectType := c.Params("type")
+	if _, ok := subjectTables[subjectType]; !ok {
+		return Subject{}, fmt.Errorf("unknown account type `%s`", subjectType)
+	}
+	subjectUUID, err := uuid.Parse(c.Params("id", ""))
+	if err != nil {
+		return Subject{}, err
+	}
+	return Subject{Type: subjectType, UUID: subjectUUID}, nil
+}
+
+// Rate is a commission rate in percent, it applies from EffectiveFrom until the next rate of the account
+type Rate struct {
+	ID            uint64          `json:"id" db:"id" repo:"pk"`
+	RateUUID      uuid.UUID       `json:"rate_uuid" db:"rate_uuid" repo:"uuid"`
+	SubjectType   string          `json:"subject_type" db:"subject_type"`
+	SubjectID     int             `json:"-" db:"subject_id"`
+	Rate          decimal.Decimal `json:"rate" db:"rate"`
+	EffectiveFrom time.Time       `json:"effective_from" db:"effective_from"`
+	Note          *string         `json:"note" db:"note"`
+	CreatedBy     *int            `json:"created_by" db:"created_by" repo:"created_by"`
+	Creator       *string         `json:"creator" db:"creator" repo:"readonly" expr:"creator.user_name"`
+	CreatedAt     *time.Time      `json:"created_at" db:"created_at" repo:"created_at"`
+}
+
+var rateFields = postgres.FieldRegistry{
+	"subject_type":   {Column: "r.subject_type", Type: postgres.FieldString, Operators: postgres.OpsIdentity},
+	"subject_id":     {Column: "r.subject_id", Type: postgres.FieldInt, Operators: postgres.OpsIdentity},
+	"rate":           {Column: "r.rate", Type: postgres.FieldDecimal, Operators: postgres.OpsNumber, Sortable: true},
+	"effective_from": {Column: "r.effective_from", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Key: "effective_from"},
+	"created_at":     {Column: "r.created_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true},
+}
+
+var rateModel = postgres.MustModel[Rate]()
+
+var rateTable = postgres.Table{
+	Name:         "tbl_commission_rates",
+	Alias:        "r",
+	Joins:        "LEFT JOIN tbl_users creator ON r.created_by = creator.id",
+	Fields:       rateFields,
+	DefaultOrder: "r.effective_from DESC",
+}
+
+// Turnover is the sales or turnover of an account on one day
+type Turnover struct {
+	ID           uint64          `json:"id" db:"id" repo:"pk"`
+	TurnoverUUID uuid.UUID       `json:"turnover_uuid" db:"turnover_uuid" repo:"uuid"`
+	SubjectType  string          `json:"subject_type" db:"subject_type"`
+	SubjectID    int             `json:"-" db:"subject_id"`
+	Amount       decimal.Decimal `json:"amount" db:"amount"`
+	TurnoverDate time.Time       `json:"turnover_date" db:"turnover_date"`
+	Reference    *string         `json:"reference" db:"reference"`
+	CreatedBy    *int            `json:"created_by" db:"created_by" repo:"created_by"`
+	Creator      *string         `json:"creator" db:"creator" repo:"readonly" expr:"creator.user_name"`
+	CreatedAt    *time.Time      `json:"created_at" db:"created_at" repo:"created_at"`
+}
+
+var turnoverFields = postgres.FieldRegistry{
+	"subject_type":  {Column: "t.subject_type", Type: postgres.FieldString, Operators: postgres.OpsIdentity},
+	"subject_id":    {Column: "t.subject_id", Type: postgres.FieldInt, Operators: postgres.OpsIdentity},
+	"amount":        {Column: "t.amount", Type: postgres.FieldDecimal, Operators: postgres.OpsNumber, Sortable: true},
+	"turnover_date": {Column: "t.turnover_date", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Key: "turnover_date"},
+	"reference":     {Column: "t.reference", Type: postgres.FieldString, Operators: postgres.OpsString, Nullable: true},
+	"created_at":    {Column: "t.created_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true},
+}
+
+var turnoverModel = postgres.MustModel[Turnover]()
+
+var turnoverTable = postgres.Table{
+	Name:         "tbl_commission_turnovers",
+	Alias:        "t",
+	Joins:        "LEFT JOIN tbl_users creator ON t.created_by = creator.id",
+	Fields:       turnoverFields,
+	DefaultOrder: "t.turnover_date DESC, t.id DESC",
+}
+
+// CommissionLine is the part of a period earned at one rate
+type CommissionLine struct {
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Rate       decimal.Decimal `json:"rate"`
+	Turnover   decimal.Decimal `json:"turnover"`
+	Commission decimal.Decimal `json:"commission"`
+}
+
+// CommissionLines is stored as JSONB on the payout so a statement keeps the rates it was built with
+type CommissionLines []CommissionLine
+
+func (l CommissionLines) Value() (driver.Value, error) {
+	if l == nil {
+		l = CommissionLines{}
+	}
+	return json.Marshal(l)
+}
+
+func (l *CommissionLines) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	case nil:
+		*l = CommissionLines{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into commission lines", src)
+	}
+	return json.Unmarshal(raw, l)
+}
+
+// Payout is a commission statement of an account over a period
+type Payout struct {
+	ID            uint64          `json:"id" db:"id" repo:"pk"`
+	PayoutUUID    uuid.UUID       `json:"payout_uuid" db:"payout_uuid" repo:"uuid"`
+	SubjectType   string          `json:"subject_type" db:"subject_type" repo:"noupdate"`
+	SubjectID     int             `json:"-" db:"subject_id" repo:"noupdate"`
+	SubjectUUID   *uuid.UUID      `json:"subject_uuid" db:"subject_uuid" repo:"readonly" expr:"COALESCE(su.user_uuid, sp.player_uuid)"`
+	SubjectName   *string         `json:"subject_name" db:"subject_name" repo:"readonly" expr:"COALESCE(su.user_name, sp.user_name)"`
+	PeriodFrom    time.Time       `json:"period_from" db:"period_from" repo:"noupdate"`
+	PeriodTo      time.Time       `json:"period_to" db:"period_to" repo:"noupdate"`
+	Turnover      decimal.Decimal `json:"turnover" db:"turnover" repo:"noupdate"`
+	Commission    decimal.Decimal `json:"commission" db:"commission" repo:"noupdate"`
+	Lines         CommissionLines `json:"lines" db:"lines" repo:"noupdate"`
+	Status        string          `json:"status" db:"status" repo:"noupdate"`
+	ApprovedBy    *int            `json:"approved_by" db:"approved_by" repo:"noupdate"`
+	ApprovedAt    *time.Time      `json:"approved_at" db:"approved_at" repo:"noupdate"`
+	PaidBy        *int            `json:"paid_by" db:"paid_by" repo:"noupdate"`
+	PaidAt        *time.Time      `json:"paid_at" db:"paid_at" repo:"noupdate"`
+	PaidReference *string         `json:"paid_reference" db:"paid_reference" repo:"noupdate"`
+	CreatedBy     *int            `json:"created_by" db:"created_by" repo:"created_by"`
+	Creator       *string         `json:"creator" db:"creator" repo:"readonly" expr:"creator.user_name"`
+	CreatedAt     *time.Time      `json:"created_at" db:"created_at" repo:"created_at"`
+	UpdatedBy     *int            `json:"updated_by" db:"updated_by" repo:"updated_by"`
+	UpdatedAt     *time.Time      `json:"updated_at" db:"updated_at" repo:"updated_at"`
+}
+
+var payoutFields = postgres.FieldRegistry{
+	"id":           {Column: "po.id", Type: postgres.FieldInt, Operators: postgres.OpsNumber, Sortable: true, Key: "id"},
+	"subject_type": {Column: "po.subject_type", Type: postgres.FieldString, Operators: postgres.OpsIdentity},
+	"subject_uuid": {Column: "COALESCE(su.user_uuid, sp.player_uuid)", Type: postgres.FieldUUID, Operators: postgres.OpsIdentity},
+	"period_from":  {Column: "po.period_from", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Key: "period_from"},
+	"period_to":    {Column: "po.period_to", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Key: "period_to"},
+	"turnover":     {Column: "po.turnover", Type: postgres.FieldDecimal, Operators: postgres.OpsNumber, Sortable: true, Key: "turnover"},
+	"commission":   {Column: "po.commission", Type: postgres.FieldDecimal, Operators: postgres.OpsNumber, Sortable: true, Key: "commission"},
+	"status":       {Column: "po.status", Type: postgres.FieldString, Operators: postgres.OpsIdentity, Sortable: true, Key: "status"},
+	"created_at":   {Column: "po.created_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true},
+}
+
+var payoutModel = postgres.MustModel[Payout]()
+
+var payoutTable = postgres.Table{
+	Name:  "tbl_commission_payouts",
+	Alias: "po",
+	Joins: "LEFT JOIN tbl_users su ON po.subject_type = 'user' AND po.subject_id = su.id " +
+		"LEFT JOIN tbl_players sp ON po.subject_type = 'player' AND po.subject_id = sp.id " +
+		"LEFT JOIN tbl_users creator ON po.created_by = creator.id",
+	Fields:       payoutFields,
+	DefaultOrder: "po.id DESC",
+}
+
+// ListRequest is the paging, sorting and filtering of the rate, turnover and payout lists
+type ListRequest struct {
+	PageOptions types.Paging   `json:"paging_options" query:"paging_options" validate:"required"`
+	Sorts       []types.Sort   `json:"sorts,omitempty" query:"sorts"`
+	Filters     []types.Filter `json:"filters,omitempty" query:"filters"`
+}
+
+func (r *ListRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.QueryParser(r); err != nil {
+		return err
+	}
+
+	// The raw value is kept, the field registry converts it to the field type
+	for i := range r.Filters {
+		r.Filters[i].Value = c.Query(fmt.Sprintf("filters[%d][value]", i))
+	}
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ListRequest) options() postgres.ListOptions {
+	return postgres.ListOptions{Paging: r.PageOptions, Sorts: r.Sorts, Filters: r.Filters}
+}
+
+type RateNewRequest struct {
+	Rate          decimal.Decimal `json:"rate"`
+	EffectiveFrom string          `json:"effective_from" validate:"required,datetime=2006-01-02"`
+	Note          *string         `json:"note" validate:"omitnil,max=255"`
+
+	effectiveFrom time.Time
+}
+
+func (r *RateNewRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.EffectiveFrom = strings.TrimSpace(r.EffectiveFrom)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	if r.Rate.IsNegative() || r.Rate.GreaterThan(decimal.NewFromInt(100)) {
+		return fmt.Errorf("rate must be between 0 and 100")
+	}
+	r.effectiveFrom, _ = time.Parse(dateLayout, r.EffectiveFrom)
+	return nil
+}
+
+type TurnoverNewRequest struct {
+	Amount       decimal.Decimal `json:"amount"`
+	TurnoverDate string          `json:"turnover_date" validate:"required,datetime=2006-01-02"`
+	Reference    *string         `json:"reference" validate:"omitnil,max=255"`
+
+	turnoverDate time.Time
+}
+
+func (r *TurnoverNewRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.TurnoverDate = strings.TrimSpace(r.TurnoverDate)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	if r.Amount.IsZero() {
+		return fmt.Errorf("amount is required")
+	}
+	r.turnoverDate, _ = time.Parse(dateLayout, r.TurnoverDate)
+	return nil
+}
+
+// PeriodRequest is an inclusive range of days
+type PeriodRequest struct {
+	From string `json:"from" query:"from" validate:"required,datetime=2006-01-02"`
+	To   string `json:"to" query:"to" validate:"required,datetime=2006-01-02"`
+
+	from time.Time
+	to   time.Time
+}
+
+func (r *PeriodRequest) parse() error {
+	r.from, _ = time.Parse(dateLayout, r.From)
+	r.to, _ = time.Parse(dateLayout, r.To)
+	if r.to.Before(r.from) {
+		return fmt.Errorf("from must not be after to")
+	}
+	return nil
+}
+
+func (r *PeriodRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.QueryParser(r); err != nil {
+		return err
+	}
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return r.parse()
+}
+
+type PayoutNewRequest struct {
+	SubjectType string    `json:"subject_type" validate:"required,oneof=user player"`
+	SubjectUUID uuid.UUID `json:"subject_uuid" validate:"required"`
+	PeriodRequest
+}
+
+func (r *PayoutNewRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return r.parse()
+}
+
+type PayoutPaidRequest struct {
+	Reference string `json:"reference" validate:"required,max=255"`
+}
+
+func (r *PayoutPaidRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.Reference = strings.TrimSpace(r.Reference)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type RateResponse struct {
+	Rates  []Rate               `json:"rates"`
+	Total  int                  `json:"-"`
+	Cursor *postgres.CursorPage `json:"-"`
+}
+
+type TurnoverResponse struct {
+	Turnovers []Turnover           `json:"turnovers"`
+	Total     int                  `json:"-"`
+	Cursor    *postgres.CursorPage `json:"-"`
+}
+
+type PayoutResponse struct {
+	Payouts []Payout             `json:"payouts"`
+	Total   int                  `json:"-"`
+	Cursor  *postgres.CursorPage `json:"-"`
+}
+
+// Statement is the commission of an account over a period, it is not stored
+type Statement struct {
+	SubjectType string          `json:"subject_type"`
+	SubjectUUID uuid.UUID       `json:"subject_uuid"`
+	PeriodFrom  time.Time       `json:"period_from"`
+	PeriodTo    time.Time       `json:"period_to"`
+	Turnover    decimal.Decimal `json:"turnover"`
+	Commission  decimal.Decimal `json:"commission"`
+	Lines       CommissionLines `json:"lines"`
+}
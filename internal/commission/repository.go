@@ -0,0 +1,443 @@
+package commission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"snack-shop/internal/user"
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/postgres"
+	"snack-shop/pkg/responses"
+	utils "snack-shop/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Payout specific audit actions, the generic ones come from postgres.Audit*
+const (
+	auditApprove = "approve"
+	auditPay     = "pay"
+)
+
+var (
+	errPeriodClosed = errors.New("the date is covered by a payout statement")
+	errPayoutStatus = errors.New("the payout statement is not in the required status")
+)
+
+type CommissionRepo interface {
+	ShowRates(subject Subject, req ListRequest) (*RateResponse, *responses.ErrorResponse)
+	CreateRate(subject Subject, req RateNewRequest) (*RateResponse, *responses.ErrorResponse)
+	ShowTurnovers(subject Subject, req ListRequest) (*TurnoverResponse, *responses.ErrorResponse)
+	CreateTurnover(subject Subject, req TurnoverNewRequest) (*TurnoverResponse, *responses.ErrorResponse)
+	Calculate(subject Subject, period PeriodRequest) (*Statement, *responses.ErrorResponse)
+	ShowPayouts(req ListRequest) (*PayoutResponse, *responses.ErrorResponse)
+	ShowPayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse)
+	GeneratePayout(req PayoutNewRequest) (*PayoutResponse, *responses.ErrorResponse)
+	ApprovePayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse)
+	PayPayout(payout_uuid uuid.UUID, req PayoutPaidRequest) (*PayoutResponse, *responses.ErrorResponse)
+}
+
+type CommissionRepoImpl struct {
+	userCtx   *types.UserContext
+	db        *sqlx.DB
+	rates     *postgres.Repository[Rate]
+	turnovers *postgres.Repository[Turnover]
+	payouts   *postgres.Repository[Payout]
+}
+
+func NewCommissionRepoImpl(u *types.UserContext, db *sqlx.DB) *CommissionRepoImpl {
+	c := &CommissionRepoImpl{
+		userCtx: u,
+		db:      db,
+	}
+
+	rates, turnovers, payouts := rateTable, turnoverTable, payoutTable
+	rates.Audit = c.auditRate
+	turnovers.Audit = c.auditTurnover
+	payouts.Audit = c.auditPayout
+
+	c.rates = rateModel.Repository(db, rates, u)
+	c.turnovers = turnoverModel.Repository(db, turnovers, u)
+	c.payouts = payoutModel.Repository(db, payouts, u)
+	return c
+}
+
+func (c *CommissionRepoImpl) ShowRates(subject Subject, req ListRequest) (*RateResponse, *responses.ErrorResponse) {
+	ctx := context.Background()
+	subjectID, err := c.subjectID(ctx, subject, false)
+	if err != nil {
+		return nil, c.commissionError("commission_rate_show_failed", err)
+	}
+
+	opts := req.options()
+	opts.Filters = append(opts.Filters, subjectFilters(subject.Type, subjectID)...)
+	page, err := c.rates.List(ctx, opts)
+	if err != nil {
+		return nil, c.commissionError("commission_rate_show_failed", err)
+	}
+	return &RateResponse{Rates: page.Rows, Total: page.Total, Cursor: page.Cursor}, nil
+}
+
+// CreateRate adds a rate to the history. A rate that is already in effect also becomes the
+// commission shown on the account.
+func (c *CommissionRepoImpl) CreateRate(subject Subject, req RateNewRequest) (*RateResponse, *responses.ErrorResponse) {
+	rate := &Rate{
+		SubjectType:   subject.Type,
+		Rate:          req.Rate,
+		EffectiveFrom: req.effectiveFrom,
+		Note:          req.Note,
+	}
+
+	changed := false
+	err := c.rates.Transaction(context.Background(), func(ctx context.Context) error {
+		actorID, now, err := c.rates.Actor(ctx)
+		if err != nil {
+			return err
+		}
+		if rate.SubjectID, err = c.subjectID(ctx, subject, true); err != nil {
+			return err
+		}
+
+		// A settled period must keep the rates its statements were built with
+		if err := c.checkOpen(ctx, subject.Type, rate.SubjectID, rate.EffectiveFrom, "period_to >= $3"); err != nil {
+			return err
+		}
+		if err := c.rates.Insert(ctx, rate); err != nil {
+			return err
+		}
+
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		if rate.EffectiveFrom.After(today) {
+			return nil
+		}
+		table := subjectTables[subject.Type]
+		set := "commission = $1, updated_by = $2, updated_at = $3"
+		if table.rowVersion {
+			set += ", row_version = row_version + 1"
+		}
+		query := fmt.Sprintf(`
+			UPDATE %s SET %s
+			WHERE id = $4 AND commission IS DISTINCT FROM $1
+				AND NOT EXISTS (
+					SELECT 1 FROM tbl_commission_rates
+					WHERE subject_type = $5 AND subject_id = $4 AND effective_from > $6 AND effective_from <= $7
+				)`, table.table, set)
+		err = c.rates.Exec(ctx, query, rate.Rate, actorID, now, rate.SubjectID, subject.Type, rate.EffectiveFrom, today)
+		if errors.Is(err, postgres.ErrNotFound) {
+			// Unchanged or superseded by a later rate that is already in effect
+			return nil
+		}
+		changed = err == nil
+		return err
+	})
+	if err != nil {
+		return nil, c.commissionError("commission_rate_create_failed", err)
+	}
+	if changed && subject.Type == SubjectUser {
+		user.EmitUpdated(c.db, subject.UUID)
+	}
+
+	created, err := c.rates.Get(context.Background(), rate.RateUUID)
+	if err != nil {
+		return nil, c.commissionError("commission_rate_create_failed", err)
+	}
+	return &RateResponse{Rates: []Rate{*created}}, nil
+}
+
+func (c *CommissionRepoImpl) ShowTurnovers(subject Subject, req ListRequest) (*TurnoverResponse, *responses.ErrorResponse) {
+	ctx := context.Background()
+	subjectID, err := c.subjectID(ctx, subject, false)
+	if err != nil {
+		return nil, c.commissionError("commission_turnover_show_failed", err)
+	}
+
+	opts := req.options()
+	opts.Filters = append(opts.Filters, subjectFilters(subject.Type, subjectID)...)
+	page, err := c.turnovers.List(ctx, opts)
+	if err != nil {
+		return nil, c.commissionError("commission_turnover_show_failed", err)
+	}
+	return &TurnoverResponse{Turnovers: page.Rows, Total: page.Total, Cursor: page.Cursor}, nil
+}
+
+func (c *CommissionRepoImpl) CreateTurnover(subject Subject, req TurnoverNewRequest) (*TurnoverResponse, *responses.ErrorResponse) {
+	turnover := &Turnover{
+		SubjectType:  subject.Type,
+		Amount:       req.Amount,
+		TurnoverDate: req.turnoverDate,
+		Reference:    req.Reference,
+	}
+
+	err := c.turnovers.Transaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		if turnover.SubjectID, err = c.subjectID(ctx, subject, true); err != nil {
+			return err
+		}
+		// A statement must keep matching the turnover it was built from
+		if err := c.checkOpen(ctx, subject.Type, turnover.SubjectID, turnover.TurnoverDate, "$3 BETWEEN period_from AND period_to"); err != nil {
+			return err
+		}
+		return c.turnovers.Insert(ctx, turnover)
+	})
+	if err != nil {
+		return nil, c.commissionError("commission_turnover_create_failed", err)
+	}
+
+	created, err := c.turnovers.Get(context.Background(), turnover.TurnoverUUID)
+	if err != nil {
+		return nil, c.commissionError("commission_turnover_create_failed", err)
+	}
+	return &TurnoverResponse{Turnovers: []Turnover{*created}}, nil
+}
+
+func (c *CommissionRepoImpl) Calculate(subject Subject, period PeriodRequest) (*Statement, *responses.ErrorResponse) {
+	var statement *Statement
+	err := c.rates.Transaction(context.Background(), func(ctx context.Context) error {
+		subjectID, err := c.subjectID(ctx, subject, false)
+		if err != nil {
+			return err
+		}
+		statement, err = c.statement(ctx, subject, subjectID, period)
+		return err
+	})
+	if err != nil {
+		return nil, c.commissionError("commission_calculate_failed", err)
+	}
+	return statement, nil
+}
+
+func (c *CommissionRepoImpl) ShowPayouts(req ListRequest) (*PayoutResponse, *responses.ErrorResponse) {
+	page, err := c.payouts.List(context.Background(), req.options())
+	if err != nil {
+		return nil, c.commissionError("commission_payout_show_failed", err)
+	}
+	return &PayoutResponse{Payouts: page.Rows, Total: page.Total, Cursor: page.Cursor}, nil
+}
+
+func (c *CommissionRepoImpl) ShowPayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse) {
+	payout, err := c.payouts.Get(context.Background(), payout_uuid)
+	if err != nil {
+		return nil, c.commissionError("commission_payout_showone_failed", err)
+	}
+	return &PayoutResponse{Payouts: []Payout{*payout}}, nil
+}
+
+// GeneratePayout builds a pending statement of the period from the current rates and turnover,
+// periods of one account cannot overlap
+func (c *CommissionRepoImpl) GeneratePayout(req PayoutNewRequest) (*PayoutResponse, *responses.ErrorResponse) {
+	subject := Subject{Type: req.SubjectType, UUID: req.SubjectUUID}
+	payout := &Payout{SubjectType: subject.Type, Status: PayoutPending}
+
+	err := c.payouts.Transaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		if payout.SubjectID, err = c.subjectID(ctx, subject, true); err != nil {
+			return err
+		}
+
+		var overlaps bool
+		err = c.payouts.SelectOne(ctx, &overlaps, `
+			SELECT EXISTS (
+				SELECT 1 FROM tbl_commission_payouts
+				WHERE subject_type = $1 AND subject_id = $2 AND period_from <= $4 AND period_to >= $3
+			)`, subject.Type, payout.SubjectID, req.from, req.to)
+		if err != nil {
+			return err
+		}
+		if overlaps {
+			return errPeriodClosed
+		}
+
+		statement, err := c.statement(ctx, subject, payout.SubjectID, req.PeriodRequest)
+		if err != nil {
+			return err
+		}
+		payout.PeriodFrom, payout.PeriodTo = statement.PeriodFrom, statement.PeriodTo
+		payout.Turnover, payout.Commission, payout.Lines = statement.Turnover, statement.Commission, statement.Lines
+		return c.payouts.Insert(ctx, payout)
+	})
+	if err != nil {
+		return nil, c.commissionError("commission_payout_create_failed", err)
+	}
+	return c.ShowPayout(payout.PayoutUUID)
+}
+
+func (c *CommissionRepoImpl) ApprovePayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse) {
+	err := c.transition(payout_uuid, PayoutPending, PayoutApproved, auditApprove, `
+		UPDATE tbl_commission_payouts SET
+			status = $1, approved_by = $2, approved_at = $3, updated_by = $2, updated_at = $3
+		WHERE payout_uuid = $4`)
+	if err != nil {
+		return nil, c.commissionError("commission_payout_approve_failed", err)
+	}
+	return c.ShowPayout(payout_uuid)
+}
+
+func (c *CommissionRepoImpl) PayPayout(payout_uuid uuid.UUID, req PayoutPaidRequest) (*PayoutResponse, *responses.ErrorResponse) {
+	err := c.transition(payout_uuid, PayoutApproved, PayoutPaid, auditPay, `
+		UPDATE tbl_commission_payouts SET
+			status = $1, paid_by = $2, paid_at = $3, paid_reference = $5, updated_by = $2, updated_at = $3
+		WHERE payout_uuid = $4`, req.Reference)
+	if err != nil {
+		return nil, c.commissionError("commission_payout_pay_failed", err)
+	}
+	return c.ShowPayout(payout_uuid)
+}
+
+// transition moves a payout from one status to the next, query gets the new status, the actor,
+// the time and the payout uuid as $1 to $4 followed by args
+func (c *CommissionRepoImpl) transition(payout_uuid uuid.UUID, from string, to string, action string, query string, args ...interface{}) error {
+	return c.payouts.Transaction(context.Background(), func(ctx context.Context) error {
+		actorID, now, err := c.payouts.Actor(ctx)
+		if err != nil {
+			return err
+		}
+		payout, err := c.payouts.GetForUpdate(ctx, payout_uuid)
+		if err != nil {
+			return err
+		}
+		if payout.Status != from {
+			return errPayoutStatus
+		}
+
+		if err := c.payouts.Exec(ctx, query, append([]interface{}{to, actorID, now, payout_uuid}, args...)...); err != nil {
+			return err
+		}
+		payout.Status = to
+		c.payouts.Audit(ctx, action, actorID, payout, "")
+		return nil
+	})
+}
+
+func (c *CommissionRepoImpl) statement(ctx context.Context, subject Subject, subjectID int, period PeriodRequest) (*Statement, error) {
+	var rates []Rate
+	err := c.rates.Select(ctx, &rates, `
+		SELECT rate, effective_from FROM tbl_commission_rates
+		WHERE subject_type = $1 AND subject_id = $2 AND effective_from <= $3
+		ORDER BY effective_from`, subject.Type, subjectID, period.to)
+	if err != nil {
+		return nil, err
+	}
+
+	var turnovers []DailyTurnover
+	err = c.rates.Select(ctx, &turnovers, `
+		SELECT turnover_date, SUM(amount) AS amount FROM tbl_commission_turnovers
+		WHERE subject_type = $1 AND subject_id = $2 AND turnover_date BETWEEN $3 AND $4
+		GROUP BY turnover_date`, subject.Type, subjectID, period.from, period.to)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, turnover, commission := Calculate(rates, turnovers, period.from, period.to)
+	return &Statement{
+		SubjectType: subject.Type,
+		SubjectUUID: subject.UUID,
+		PeriodFrom:  period.from,
+		PeriodTo:    period.to,
+		Turnover:    turnover,
+		Commission:  commission,
+		Lines:       lines,
+	}, nil
+}
+
+// subjectID resolves the account of a request, lock serializes the changes of one account
+func (c *CommissionRepoImpl) subjectID(ctx context.Context, subject Subject, lock bool) (int, error) {
+	table := subjectTables[subject.Type]
+	query := fmt.Sprintf("SELECT id FROM %s WHERE %s = $1 AND deleted_at IS NULL", table.table, table.uuidColumn)
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var id int
+	if err := c.rates.SelectOne(ctx, &id, query, subject.UUID); err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return 0, fmt.Errorf("%s not found", subject.Type)
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// checkOpen fails when a payout of the account matches condition, the date is passed as $3
+func (c *CommissionRepoImpl) checkOpen(ctx context.Context, subjectType string, subjectID int, date time.Time, condition string) error {
+	var closed bool
+	err := c.payouts.SelectOne(ctx, &closed, `
+		SELECT EXISTS (
+			SELECT 1 FROM tbl_commission_payouts
+			WHERE subject_type = $1 AND subject_id = $2 AND `+condition+`
+		)`, subjectType, subjectID, date)
+	if err != nil {
+		return err
+	}
+	if closed {
+		return errPeriodClosed
+	}
+	return nil
+}
+
+func subjectFilters(subjectType string, subjectID int) []types.Filter {
+	return []types.Filter{
+		{Property: "subject_type", Value: subjectType},
+		{Property: "subject_id", Value: fmt.Sprint(subjectID)},
+	}
+}
+
+func (c *CommissionRepoImpl) commissionError(messageID string, err error) *responses.ErrorResponse {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return responses.NewErrorResponse("commission_not_found", fmt.Errorf("record not found"))
+	case errors.Is(err, errPeriodClosed):
+		return responses.NewErrorResponse("commission_period_closed", err)
+	case errors.Is(err, errPayoutStatus):
+		return responses.NewErrorResponse("commission_payout_invalid_status", err)
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		return responses.NewErrorResponse("commission_duplicate", fmt.Errorf("the record already exists"))
+	case errors.As(err, &pqErr):
+		custom_log.NewCustomLog(messageID, err.Error(), "error")
+		return responses.NewErrorResponse(messageID, fmt.Errorf("database error"))
+	}
+	custom_log.NewCustomLog(messageID, err.Error(), "warn")
+	return responses.NewErrorResponse(messageID, err)
+}
+
+func (c *CommissionRepoImpl) auditRate(ctx context.Context, action string, actorID int, row interface{}, detail string) {
+	rate := row.(*Rate)
+	c.audit(actorID, "New Commission Rate", fmt.Sprintf("Commission rate %s%% of %s #%d is effective from %s",
+		rate.Rate.StringFixed(2), rate.SubjectType, rate.SubjectID, rate.EffectiveFrom.Format(dateLayout)))
+}
+
+func (c *CommissionRepoImpl) auditTurnover(ctx context.Context, action string, actorID int, row interface{}, detail string) {
+	turnover := row.(*Turnover)
+	c.audit(actorID, "New Commission Turnover", fmt.Sprintf("Turnover %s of %s #%d on %s has been recorded",
+		turnover.Amount.StringFixed(2), turnover.SubjectType, turnover.SubjectID, turnover.TurnoverDate.Format(dateLayout)))
+}
+
+func (c *CommissionRepoImpl) auditPayout(ctx context.Context, action string, actorID int, row interface{}, detail string) {
+	payout := row.(*Payout)
+	period := payout.PeriodFrom.Format(dateLayout) + " - " + payout.PeriodTo.Format(dateLayout)
+
+	switch action {
+	case postgres.AuditInsert:
+		c.audit(actorID, "Generate Payout", fmt.Sprintf("Payout statement of %s #%d for %s has been generated: commission %s",
+			payout.SubjectType, payout.SubjectID, period, payout.Commission.StringFixed(2)))
+	case auditApprove:
+		c.audit(actorID, "Approve Payout", fmt.Sprintf("Payout statement %s for %s has been approved", payout.PayoutUUID, period))
+	case auditPay:
+		c.audit(actorID, "Pay Payout", fmt.Sprintf("Payout statement %s for %s has been marked paid", payout.PayoutUUID, period))
+	}
+}
+
+func (c *CommissionRepoImpl) audit(actorID int, auditContext string, auditDesc string) {
+	_, err := utils.AddUserAuditLog(
+		actorID, auditContext, auditDesc, 1, c.userCtx.UserAgent,
+		c.userCtx.UserName, c.userCtx.Ip, actorID, c.db)
+	if err != nil {
+		custom_log.NewCustomLog("commission_audit_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+}
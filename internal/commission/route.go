@@ -0,0 +1,38 @@
+package commission
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// CommissionRoute struct
+type CommissionRoute struct {
+	app     *fiber.App
+	db      *sqlx.DB
+	handler *CommissionHandler
+}
+
+func NewCommissionRoute(app *fiber.App, db *sqlx.DB) *CommissionRoute {
+	return &CommissionRoute{
+		app:     app,
+		db:      db,
+		handler: NewHandler(db),
+	}
+}
+
+func (r *CommissionRoute) RegisterCommissionRoute() *CommissionRoute {
+	v1 := r.app.Group("/api/v1/")
+	commission := v1.Group("/commission")
+	commission.Get("/payouts", r.handler.ShowPayouts)
+	commission.Post("/payouts", r.handler.GeneratePayout)
+	commission.Get("/payouts/:id", r.handler.ShowPayout)
+	commission.Put("/payouts/:id/approve", r.handler.ApprovePayout)
+	commission.Put("/payouts/:id/paid", r.handler.PayPayout)
+	commission.Get("/:type/:id/rates", r.handler.ShowRates)
+	commission.Post("/:type/:id/rates", r.handler.CreateRate)
+	commission.Get("/:type/:id/turnovers", r.handler.ShowTurnovers)
+	commission.Post("/:type/:id/turnovers", r.handler.CreateTurnover)
+	commission.Get("/:type/:id/calculate", r.handler.Calculate)
+
+	return r
+}
@@ -0,0 +1,74 @@
+package commission
+
+import (
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/responses"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type CommissionCreator interface {
+	ShowRates(subject Subject, req ListRequest) (*RateResponse, *responses.ErrorResponse)
+	CreateRate(subject Subject, req RateNewRequest) (*RateResponse, *responses.ErrorResponse)
+	ShowTurnovers(subject Subject, req ListRequest) (*TurnoverResponse, *responses.ErrorResponse)
+	CreateTurnover(subject Subject, req TurnoverNewRequest) (*TurnoverResponse, *responses.ErrorResponse)
+	Calculate(subject Subject, period PeriodRequest) (*Statement, *responses.ErrorResponse)
+	ShowPayouts(req ListRequest) (*PayoutResponse, *responses.ErrorResponse)
+	ShowPayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse)
+	GeneratePayout(req PayoutNewRequest) (*PayoutResponse, *responses.ErrorResponse)
+	ApprovePayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse)
+	PayPayout(payout_uuid uuid.UUID, req PayoutPaidRequest) (*PayoutResponse, *responses.ErrorResponse)
+}
+
+type CommissionService struct {
+	userCtx        *types.UserContext
+	commissionRepo CommissionRepo
+}
+
+func NewCommissionService(u *types.UserContext, db *sqlx.DB) *CommissionService {
+	return &CommissionService{
+		userCtx:        u,
+		commissionRepo: NewCommissionRepoImpl(u, db),
+	}
+}
+
+func (s *CommissionService) ShowRates(subject Subject, req ListRequest) (*RateResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.ShowRates(subject, req)
+}
+
+func (s *CommissionService) CreateRate(subject Subject, req RateNewRequest) (*RateResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.CreateRate(subject, req)
+}
+
+func (s *CommissionService) ShowTurnovers(subject Subject, req ListRequest) (*TurnoverResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.ShowTurnovers(subject, req)
+}
+
+func (s *CommissionService) CreateTurnover(subject Subject, req TurnoverNewRequest) (*TurnoverResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.CreateTurnover(subject, req)
+}
+
+func (s *CommissionService) Calculate(subject Subject, period PeriodRequest) (*Statement, *responses.ErrorResponse) {
+	return s.commissionRepo.Calculate(subject, period)
+}
+
+func (s *CommissionService) ShowPayouts(req ListRequest) (*PayoutResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.ShowPayouts(req)
+}
+
+func (s *CommissionService) ShowPayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.ShowPayout(payout_uuid)
+}
+
+func (s *CommissionService) GeneratePayout(req PayoutNewRequest) (*PayoutResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.GeneratePayout(req)
+}
+
+func (s *CommissionService) ApprovePayout(payout_uuid uuid.UUID) (*PayoutResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.ApprovePayout(payout_uuid)
+}
+
+func (s *CommissionService) PayPayout(payout_uuid uuid.UUID, req PayoutPaidRequest) (*PayoutResponse, *responses.ErrorResponse) {
+	return s.commissionRepo.PayPayout(payout_uuid, req)
+}
@@ -0,0 +1,206 @@
+package photo
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"snack-shop/pkg/constants"
+	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/storage"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// PhotoHandler struct
+type PhotoHandler struct {
+	db           *sqlx.DB
+	store        storage.Storage
+	signer       *storage.URLSigner
+	options      PhotoOptions
+	photoService func(*fiber.Ctx) PhotoCreator
+}
+
+func NewHandler(db *sqlx.DB, store storage.Storage, signer *storage.URLSigner, options PhotoOptions) *PhotoHandler {
+	return &PhotoHandler{
+		db:      db,
+		store:   store,
+		signer:  signer,
+		options: options,
+		photoService: func(c *fiber.Ctx) PhotoCreator {
+			UserContext := c.Locals("UserContext")
+
+			var uCtx types.UserContext
+			if contextMap, ok := UserContext.(types.UserContext); ok {
+				uCtx = contextMap
+			} else {
+				custom_log.NewCustomLog("user_context_failed", "Failed to cast UserContext to map[string]interface{}", "warn")
+				uCtx = types.UserContext{}
+			}
+
+			return NewPhotoService(&uCtx, db, store, signer, options)
+		},
+	}
+}
+
+func (h *PhotoHandler) ShowUserPhoto(c *fiber.Ctx) error {
+	user_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("photo_show_failed", nil, c),
+			constants.PhotoShowFailed,
+			err_uuid,
+		))
+	}
+
+	photo, err := h.photoService(c).ShowUserPhoto(user_uuid)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PhotoShowFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("photo_show_success", nil, c),
+		constants.PhotoShowSuccess,
+		photo,
+	))
+}
+
+func (h *PhotoHandler) ShowPlayerPhoto(c *fiber.Ctx) error {
+	player_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("photo_show_failed", nil, c),
+			constants.PhotoShowFailed,
+			err_uuid,
+		))
+	}
+
+	photo, err := h.photoService(c).ShowPlayerPhoto(player_uuid)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PhotoShowFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("photo_show_success", nil, c),
+		constants.PhotoShowSuccess,
+		photo,
+	))
+}
+
+func (h *PhotoHandler) UploadUserPhoto(c *fiber.Ctx) error {
+	user_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("photo_upload_failed", nil, c),
+			constants.PhotoUploadFailed,
+			err_uuid,
+		))
+	}
+
+	var photoUploadRequest PhotoUploadRequest
+	if err := photoUploadRequest.bind(c, h.options.MaxUploadSize); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			utils.Translate("photo_invalid_file", nil, c),
+			constants.PhotoUploadFailed,
+			err,
+		))
+	}
+
+	photo, err := h.photoService(c).UploadUserPhoto(user_uuid, photoUploadRequest)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PhotoUploadFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("photo_upload_success", nil, c),
+		constants.PhotoUploadSuccess,
+		photo,
+	))
+}
+
+func (h *PhotoHandler) UploadPlayerPhoto(c *fiber.Ctx) error {
+	player_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("photo_upload_failed", nil, c),
+			constants.PhotoUploadFailed,
+			err_uuid,
+		))
+	}
+
+	var photoUploadRequest PhotoUploadRequest
+	if err := photoUploadRequest.bind(c, h.options.MaxUploadSize); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			utils.Translate("photo_invalid_file", nil, c),
+			constants.PhotoUploadFailed,
+			err,
+		))
+	}
+
+	photo, err := h.photoService(c).UploadPlayerPhoto(player_uuid, photoUploadRequest)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PhotoUploadFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("photo_upload_success", nil, c),
+		constants.PhotoUploadSuccess,
+		photo,
+	))
+}
+
+// ServeFile streams a stored file to the client when the signed URL is valid. It is mounted
+// before the JWT middleware so <img> tags can load it without an Authorization header.
+func (h *PhotoHandler) ServeFile(c *fiber.Ctx) error {
+	key := c.Params("*")
+	if err := h.signer.Verify(key, c.Query("expires"), c.Query("signature")); err != nil {
+		return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+			utils.Translate("file_signature_invalid", nil, c),
+			constants.FileServeFailed,
+			err,
+		))
+	}
+
+	body, obj, err := h.store.Get(c.Context(), key)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		} else {
+			custom_log.NewCustomLog("file_serve_failed", err.Error(), "error")
+		}
+		return c.Status(status).JSON(response.NewResponseError(
+			utils.Translate("file_not_found", nil, c),
+			constants.FileServeFailed,
+			err,
+		))
+	}
+
+	if obj.ContentType != "" {
+		c.Set(fiber.HeaderContentType, obj.ContentType)
+	}
+	// Objects are content addressed, so they never change once written
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(int(h.signer.TTL().Seconds())))
+	return c.SendStream(body, int(obj.Size))
+}
@@ -0,0 +1,130 @@
+package photo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Maximum width/height accepted before decoding, protects against decompression bombs
+const maxImageDimension = 8000
+
+// Sniffed MIME type -> stored file extension
+var allowedImageTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+type ProcessedImage struct {
+	Key         string
+	ContentType string
+	Data        []byte
+	Thumbnails  []Thumbnail
+}
+
+type Thumbnail struct {
+	Size        int
+	Key         string
+	ContentType string
+	Data        []byte
+}
+
+// processImage sniffs, decodes and resizes an uploaded image. The stored key is derived from the
+// SHA-256 of the original bytes so identical uploads share the same objects.
+func processImage(prefix string, data []byte, sizes []int) (*ProcessedImage, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type `%s`", contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image: %w", err)
+	}
+	if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension {
+		return nil, fmt.Errorf("image dimensions %dx%d exceed the %dpx limit", cfg.Width, cfg.Height, maxImageDimension)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key := fmt.Sprintf("%s/%s/%s.%s", prefix, hash[:2], hash, ext)
+
+	result := &ProcessedImage{
+		Key:         key,
+		ContentType: contentType,
+		Data:        data,
+	}
+
+	for _, size := range sizes {
+		thumbData, thumbType, err := resizeImage(src, size, contentType)
+		if err != nil {
+			return nil, err
+		}
+		result.Thumbnails = append(result.Thumbnails, Thumbnail{
+			Size:        size,
+			Key:         ThumbnailKey(key, size),
+			ContentType: thumbType,
+			Data:        thumbData,
+		})
+	}
+
+	return result, nil
+}
+
+// resizeImage scales src down to fit in a size x size box, keeping the aspect ratio
+func resizeImage(src image.Image, size int, contentType string) ([]byte, string, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			height = max(1, height*size/width)
+			width = size
+		} else {
+			width = max(1, width*size/height)
+			height = size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// ThumbnailKey returns the storage key of the thumbnail of the given size for an original key.
+// JPEG thumbnails stay JPEG, everything else is stored as PNG.
+func ThumbnailKey(key string, size int) string {
+	ext := path.Ext(key)
+	base := strings.TrimSuffix(key, ext)
+	if ext != ".jpg" {
+		ext = ".png"
+	}
+	return fmt.Sprintf("%s_%d%s", base, size, ext)
+}
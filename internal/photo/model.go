@@ -0,0 +1,83 @@
+package photo
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Owner describes whose profile photo is being changed
+type Owner struct {
+	ID        uint64 `db:"id"`
+	FirstName string `db:"first_name"`
+	LastName  string `db:"last_name"`
+	UserName  string `db:"user_name"`
+	RoleId    int    `db:"role_id"`
+}
+
+type PhotoUploadRequest struct {
+	FileName string
+	Data     []byte
+}
+
+func (r *PhotoUploadRequest) bind(c *fiber.Ctx, maxSize int64) error {
+	fileHeader, err := c.FormFile("photo")
+	if err != nil {
+		return fmt.Errorf("multipart field `photo` is required")
+	}
+	if fileHeader.Size > maxSize {
+		return fmt.Errorf("file size %d bytes exceeds the %d bytes limit", fileHeader.Size, maxSize)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Never trust the multipart header alone, cap the bytes actually read as well
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > maxSize {
+		return fmt.Errorf("file size exceeds the %d bytes limit", maxSize)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("uploaded file is empty")
+	}
+
+	r.FileName = fileHeader.Filename
+	r.Data = data
+	return nil
+}
+
+type PhotoOptions struct {
+	MaxUploadSize  int64
+	ThumbnailSizes []int
+}
+
+// ParseThumbnailSizes parses a comma separated list such as "64,256"
+func ParseThumbnailSizes(value string) []int {
+	var sizes []int
+	for _, part := range strings.Split(value, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil && size > 0 {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+type PhotoInfo struct {
+	Key        string            `json:"key"`
+	Url        string            `json:"url"`
+	Thumbnails map[string]string `json:"thumbnails"`
+}
+
+type PhotoResponse struct {
+	Photo PhotoInfo `json:"photo"`
+}
@@ -0,0 +1,241 @@
+package photo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/postgres"
+	"snack-shop/pkg/responses"
+	utils "snack-shop/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type PhotoRepo interface {
+	GetUserPhoto(user_uuid uuid.UUID) (*string, *responses.ErrorResponse)
+	GetPlayerPhoto(player_uuid uuid.UUID) (*string, *responses.ErrorResponse)
+	CheckUserPhoto(user_uuid uuid.UUID) *responses.ErrorResponse
+	CheckPlayerPhoto(player_uuid uuid.UUID) *responses.ErrorResponse
+	UpdateUserPhoto(user_uuid uuid.UUID, key string) *responses.ErrorResponse
+	UpdatePlayerPhoto(player_uuid uuid.UUID, key string) *responses.ErrorResponse
+}
+
+type PhotoRepoImpl struct {
+	userCtx *types.UserContext
+	db      *sqlx.DB
+}
+
+func NewPhotoRepoImpl(u *types.UserContext, db *sqlx.DB) *PhotoRepoImpl {
+	return &PhotoRepoImpl{
+		userCtx: u,
+		db:      db,
+	}
+}
+
+func (p *PhotoRepoImpl) GetUserPhoto(user_uuid uuid.UUID) (*string, *responses.ErrorResponse) {
+	var photo *string
+	err := p.db.Get(&photo, `SELECT profile_photo FROM tbl_users WHERE user_uuid = $1 AND deleted_at IS NULL`, user_uuid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, responses.NewErrorResponse("photo_show_failed", fmt.Errorf("user uuid:`%s` not found", user_uuid))
+		}
+		custom_log.NewCustomLog("photo_show_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("photo_show_failed", fmt.Errorf("cannot select photo: database error"))
+	}
+	return photo, nil
+}
+
+func (p *PhotoRepoImpl) GetPlayerPhoto(player_uuid uuid.UUID) (*string, *responses.ErrorResponse) {
+	var photo *string
+	err := p.db.Get(&photo, `SELECT profile_photo FROM tbl_players WHERE player_uuid = $1 AND deleted_at IS NULL`, player_uuid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, responses.NewErrorResponse("photo_show_failed", fmt.Errorf("player uuid:`%s` not found", player_uuid))
+		}
+		custom_log.NewCustomLog("photo_show_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("photo_show_failed", fmt.Errorf("cannot select photo: database error"))
+	}
+	return photo, nil
+}
+
+// CheckUserPhoto and CheckPlayerPhoto run before the upload is stored, so a refused upload leaves
+// no files behind. UpdateUserPhoto checks again in its transaction.
+func (p *PhotoRepoImpl) CheckUserPhoto(user_uuid uuid.UUID) *responses.ErrorResponse {
+	_, err := p.userOwner(p.db, user_uuid)
+	return err
+}
+
+func (p *PhotoRepoImpl) CheckPlayerPhoto(player_uuid uuid.UUID) *responses.ErrorResponse {
+	var exists bool
+	err := p.db.Get(&exists, `SELECT EXISTS (SELECT 1 FROM tbl_players WHERE player_uuid = $1 AND deleted_at IS NULL)`, player_uuid)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot select player: database error"))
+	}
+	if !exists {
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("player uuid:`%s` not found", player_uuid))
+	}
+	return nil
+}
+
+// userOwner loads the user of a photo and refuses users the admin may not change
+func (p *PhotoRepoImpl) userOwner(db sqlx.Queryer, user_uuid uuid.UUID) (*Owner, *responses.ErrorResponse) {
+	var owner Owner
+	err := sqlx.Get(db, &owner, `
+		SELECT id, COALESCE(first_name, '') AS first_name, COALESCE(last_name, '') AS last_name, user_name, role_id
+		FROM tbl_users
+		WHERE user_uuid = $1 AND deleted_at IS NULL`, user_uuid)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "warn")
+		return nil, responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("user uuid:`%s` not found", user_uuid))
+	}
+
+	// Admins can change their own photo, but not the photo of a user with a higher role
+	if owner.UserName != p.userCtx.UserName && p.userCtx.RoleId > uint64(owner.RoleId) {
+		return nil, responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("permission denied: this user has a higher role than you"))
+	}
+	return &owner, nil
+}
+
+func (p *PhotoRepoImpl) UpdateUserPhoto(user_uuid uuid.UUID, key string) *responses.ErrorResponse {
+	tx, err := p.db.BeginTxx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot begin transaction"))
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	owner, errOwner := p.userOwner(tx, user_uuid)
+	if errOwner != nil {
+		err = errOwner.Err
+		return errOwner
+	}
+
+	by_id, err := postgres.GetIdByUuid("tbl_users", "user_uuid", p.userCtx.UserUuid, tx)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot get current user ID"))
+	}
+
+	now, err := localNow()
+	if err != nil {
+		return responses.NewErrorResponse("photo_upload_failed", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tbl_users SET
+			profile_photo = $1,
+			updated_by = $2,
+			updated_at = $3,
+			row_version = row_version + 1
+		WHERE user_uuid = $4`,
+		key, *by_id, now, user_uuid)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot update photo"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot commit transaction"))
+	}
+
+	// Add Audit
+	var audit_des = fmt.Sprintf("Updating `%s %s`'s profile photo has been successful", owner.FirstName, owner.LastName)
+	_, err = utils.AddUserAuditLog(
+		int(owner.ID), "Update User's photo", audit_des, 1, p.userCtx.UserAgent,
+		p.userCtx.UserName, p.userCtx.Ip, *by_id, p.db)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+
+	return nil
+}
+
+func (p *PhotoRepoImpl) UpdatePlayerPhoto(player_uuid uuid.UUID, key string) *responses.ErrorResponse {
+	tx, err := p.db.BeginTxx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot begin transaction"))
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var owner Owner
+	err = tx.Get(&owner, `
+		SELECT id, first_name, last_name, user_name, 0 AS role_id
+		FROM tbl_players
+		WHERE player_uuid = $1 AND deleted_at IS NULL`, player_uuid)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "warn")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("player uuid:`%s` not found", player_uuid))
+	}
+
+	by_id, err := postgres.GetIdByUuid("tbl_users", "user_uuid", p.userCtx.UserUuid, tx)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot get current user ID"))
+	}
+
+	now, err := localNow()
+	if err != nil {
+		return responses.NewErrorResponse("photo_upload_failed", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tbl_players SET
+			profile_photo = $1,
+			updated_by = $2,
+			updated_at = $3
+		WHERE player_uuid = $4`,
+		key, *by_id, now, player_uuid)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot update photo"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+		return responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot commit transaction"))
+	}
+
+	// Add Audit
+	var audit_des = fmt.Sprintf("Updating player `%s`'s profile photo has been successful", owner.UserName)
+	_, err = utils.AddUserAuditLog(
+		*by_id, "Update Player's photo", audit_des, 1, p.userCtx.UserAgent,
+		p.userCtx.UserName, p.userCtx.Ip, *by_id, p.db)
+	if err != nil {
+		custom_log.NewCustomLog("photo_upload_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+
+	return nil
+}
+
+func localNow() (time.Time, error) {
+	app_timezone := os.Getenv("APP_TIMEZONE")
+	location, err := time.LoadLocation(app_timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load location: %w", err)
+	}
+	return time.Now().In(location), nil
+}
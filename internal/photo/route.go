@@ -0,0 +1,52 @@
+package photo
+
+import (
+	"time"
+
+	config "snack-shop/config"
+	"snack-shop/pkg/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+const filesPath = "/api/v1/files"
+
+// PhotoRoute struct
+type PhotoRoute struct {
+	app     *fiber.App
+	db      *sqlx.DB
+	handler *PhotoHandler
+}
+
+func NewPhotoRoute(app *fiber.App, db *sqlx.DB, store storage.Storage) *PhotoRoute {
+	storage_config := config.InitStorage()
+	signer := storage.NewURLSigner(storage_config.SigningKey, filesPath, time.Duration(storage_config.UrlExpire)*time.Second)
+	options := PhotoOptions{
+		MaxUploadSize:  int64(storage_config.MaxUploadSize),
+		ThumbnailSizes: ParseThumbnailSizes(storage_config.ThumbnailSizes),
+	}
+
+	return &PhotoRoute{
+		app:     app,
+		db:      db,
+		handler: NewHandler(db, store, signer, options),
+	}
+}
+
+// RegisterFileRoute mounts the signed file download route, it must be registered before the JWT middleware
+func (p *PhotoRoute) RegisterFileRoute() *PhotoRoute {
+	p.app.Get(filesPath+"/*", p.handler.ServeFile)
+
+	return p
+}
+
+func (p *PhotoRoute) RegisterPhotoRoute() *PhotoRoute {
+	v1 := p.app.Group("/api/v1/")
+	v1.Get("/user/:id/photo", p.handler.ShowUserPhoto)
+	v1.Post("/user/:id/photo", p.handler.UploadUserPhoto)
+	v1.Get("/player/:id/photo", p.handler.ShowPlayerPhoto)
+	v1.Post("/player/:id/photo", p.handler.UploadPlayerPhoto)
+
+	return p
+}
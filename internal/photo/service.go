@@ -0,0 +1,147 @@
+package photo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/responses"
+	"snack-shop/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type PhotoCreator interface {
+	ShowUserPhoto(user_uuid uuid.UUID) (*PhotoResponse, *responses.ErrorResponse)
+	ShowPlayerPhoto(player_uuid uuid.UUID) (*PhotoResponse, *responses.ErrorResponse)
+	UploadUserPhoto(user_uuid uuid.UUID, req PhotoUploadRequest) (*PhotoResponse, *responses.ErrorResponse)
+	UploadPlayerPhoto(player_uuid uuid.UUID, req PhotoUploadRequest) (*PhotoResponse, *responses.ErrorResponse)
+}
+
+type PhotoService struct {
+	userCtx   *types.UserContext
+	photoRepo PhotoRepo
+	store     storage.Storage
+	signer    *storage.URLSigner
+	options   PhotoOptions
+}
+
+func NewPhotoService(u *types.UserContext, db *sqlx.DB, store storage.Storage, signer *storage.URLSigner, options PhotoOptions) *PhotoService {
+	return &PhotoService{
+		userCtx:   u,
+		photoRepo: NewPhotoRepoImpl(u, db),
+		store:     store,
+		signer:    signer,
+		options:   options,
+	}
+}
+
+func (p *PhotoService) ShowUserPhoto(user_uuid uuid.UUID) (*PhotoResponse, *responses.ErrorResponse) {
+	key, err := p.photoRepo.GetUserPhoto(user_uuid)
+	if err != nil {
+		return nil, err
+	}
+	return p.photoResponse(key)
+}
+
+func (p *PhotoService) ShowPlayerPhoto(player_uuid uuid.UUID) (*PhotoResponse, *responses.ErrorResponse) {
+	key, err := p.photoRepo.GetPlayerPhoto(player_uuid)
+	if err != nil {
+		return nil, err
+	}
+	return p.photoResponse(key)
+}
+
+func (p *PhotoService) UploadUserPhoto(user_uuid uuid.UUID, req PhotoUploadRequest) (*PhotoResponse, *responses.ErrorResponse) {
+	if err := p.photoRepo.CheckUserPhoto(user_uuid); err != nil {
+		return nil, err
+	}
+	img, stored, err := p.saveImage(fmt.Sprintf("users/%s", user_uuid), req)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.photoRepo.UpdateUserPhoto(user_uuid, img.Key); err != nil {
+		p.removeObjects(stored)
+		return nil, err
+	}
+	return p.photoResponse(&img.Key)
+}
+
+func (p *PhotoService) UploadPlayerPhoto(player_uuid uuid.UUID, req PhotoUploadRequest) (*PhotoResponse, *responses.ErrorResponse) {
+	if err := p.photoRepo.CheckPlayerPhoto(player_uuid); err != nil {
+		return nil, err
+	}
+	img, stored, err := p.saveImage(fmt.Sprintf("players/%s", player_uuid), req)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.photoRepo.UpdatePlayerPhoto(player_uuid, img.Key); err != nil {
+		p.removeObjects(stored)
+		return nil, err
+	}
+	return p.photoResponse(&img.Key)
+}
+
+// saveImage processes the upload and writes the original and its thumbnails, skipping objects that
+// already exist. It returns the keys it wrote, on failure they are removed again.
+func (p *PhotoService) saveImage(prefix string, req PhotoUploadRequest) (*ProcessedImage, []string, *responses.ErrorResponse) {
+	img, err := processImage(prefix, req.Data, p.options.ThumbnailSizes)
+	if err != nil {
+		custom_log.NewCustomLog("photo_invalid_file", err.Error(), "warn")
+		return nil, nil, responses.NewErrorResponse("photo_invalid_file", err)
+	}
+
+	ctx := context.Background()
+	// The original is written alongside its thumbnails, they all share the same shape
+	objects := append([]Thumbnail{{Key: img.Key, ContentType: img.ContentType, Data: img.Data}}, img.Thumbnails...)
+	var stored []string
+	for _, obj := range objects {
+		exists, err := p.store.Exists(ctx, obj.Key)
+		if err != nil {
+			custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+			p.removeObjects(stored)
+			return nil, nil, responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot access file storage"))
+		}
+		if exists {
+			continue
+		}
+		if err := p.store.Put(ctx, obj.Key, bytes.NewReader(obj.Data), int64(len(obj.Data)), obj.ContentType); err != nil {
+			custom_log.NewCustomLog("photo_upload_failed", err.Error(), "error")
+			p.removeObjects(stored)
+			return nil, nil, responses.NewErrorResponse("photo_upload_failed", fmt.Errorf("cannot store file"))
+		}
+		stored = append(stored, obj.Key)
+	}
+
+	return img, stored, nil
+}
+
+// removeObjects deletes the files of an upload that was not saved, objects that existed before are
+// never in keys since another photo may use them
+func (p *PhotoService) removeObjects(keys []string) {
+	for _, key := range keys {
+		if err := p.store.Delete(context.Background(), key); err != nil {
+			custom_log.NewCustomLog("photo_cleanup_failed", err.Error(), "warn")
+		}
+	}
+}
+
+func (p *PhotoService) photoResponse(key *string) (*PhotoResponse, *responses.ErrorResponse) {
+	info := PhotoInfo{Thumbnails: map[string]string{}}
+	// Legacy rows only hold a bare file name such as "user2.png", which is not a storage key
+	if key != nil && strings.Contains(*key, "/") && storage.ValidateKey(*key) == nil {
+		info.Key = *key
+		info.Url = p.signer.SignedURL(*key)
+		for _, size := range p.options.ThumbnailSizes {
+			info.Thumbnails[strconv.Itoa(size)] = p.signer.SignedURL(ThumbnailKey(*key, size))
+		}
+	} else if key != nil {
+		info.Key = *key
+	}
+	return &PhotoResponse{Photo: info}, nil
+}
@@ -0,0 +1,285 @@
+package player
+
+import (
+	"net/http"
+
+	"snack-shop/pkg/constants"
+	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// PlayerHandler struct
+type PlayerHandler struct {
+	db            *sqlx.DB
+	playerService func(*fiber.Ctx) PlayerCreator
+}
+
+func NewHandler(db *sqlx.DB) *PlayerHandler {
+	return &PlayerHandler{
+		db: db,
+		playerService: func(c *fiber.Ctx) PlayerCreator {
+			UserContext := c.Locals("UserContext")
+
+			var uCtx types.UserContext
+			if contextMap, ok := UserContext.(types.UserContext); ok {
+				uCtx = contextMap
+			} else {
+				custom_log.NewCustomLog("user_context_failed", "Failed to cast UserContext to map[string]interface{}", "warn")
+				uCtx = types.UserContext{}
+			}
+
+			return NewPlayerService(&uCtx, db)
+		},
+	}
+}
+
+func (h *PlayerHandler) Show(c *fiber.Ctx) error {
+	var playerRequest PlayerShowRequest
+
+	v := utils.NewValidator()
+	if err := playerRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_show_failed", nil, c),
+			constants.PlayerShowFailed,
+			err,
+		))
+	}
+
+	players, err := h.playerService(c).Show(playerRequest)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PlayerShowFailed,
+			err.Err,
+		))
+	}
+
+	paging := playerRequest.PageOptions
+	if paging.IsCursor() {
+		var total *int
+		if paging.CountTotal() {
+			total = &players.Total
+		}
+		return c.Status(http.StatusOK).JSON(response.NewResponseWithCursor(
+			utils.Translate("player_show_success", nil, c),
+			constants.PlayerShowSuccess,
+			players,
+			paging.Perpage,
+			players.Cursor.NextCursor,
+			players.Cursor.PrevCursor,
+			total,
+		))
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponseWithPaging(
+		utils.Translate("player_show_success", nil, c),
+		constants.PlayerShowSuccess,
+		players,
+		paging.Page,
+		paging.Perpage,
+		players.Total,
+	))
+}
+
+func (h *PlayerHandler) ShowOne(c *fiber.Ctx) error {
+	player_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_showone_failed", nil, c),
+			constants.PlayerShowOneFailed,
+			err_uuid,
+		))
+	}
+
+	players, err := h.playerService(c).ShowOne(player_uuid)
+	if err != nil {
+		return c.Status(playerErrorStatus(err.MessageID)).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PlayerShowOneFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("player_showone_success", nil, c),
+		constants.PlayerShowOneSuccess,
+		players,
+	))
+}
+
+func (h *PlayerHandler) Create(c *fiber.Ctx) error {
+	var playerNewRequest PlayerNewRequest
+
+	v := utils.NewValidator()
+	if err := playerNewRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_create_failed", nil, c),
+			constants.PlayerCreateFailed,
+			err,
+		))
+	}
+
+	players, err := h.playerService(c).Create(playerNewRequest)
+	if err != nil {
+		return c.Status(playerErrorStatus(err.MessageID)).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PlayerCreateFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("player_create_success", nil, c),
+		constants.PlayerCreateSuccess,
+		players,
+	))
+}
+
+func (h *PlayerHandler) Update(c *fiber.Ctx) error {
+	player_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_update_failed", nil, c),
+			constants.PlayerUpdateFailed,
+			err_uuid,
+		))
+	}
+
+	var playerUpdateRequest PlayerUpdateRequest
+	v := utils.NewValidator()
+	if err := playerUpdateRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_update_failed", nil, c),
+			constants.PlayerUpdateFailed,
+			err,
+		))
+	}
+
+	players, err := h.playerService(c).Update(player_uuid, playerUpdateRequest)
+	if err != nil {
+		return c.Status(playerErrorStatus(err.MessageID)).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PlayerUpdateFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("player_update_success", nil, c),
+		constants.PlayerUpdateSuccess,
+		players,
+	))
+}
+
+func (h *PlayerHandler) Suspend(c *fiber.Ctx) error {
+	player_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_suspend_failed", nil, c),
+			constants.PlayerSuspendFailed,
+			err_uuid,
+		))
+	}
+
+	var playerSuspendRequest PlayerSuspendRequest
+	v := utils.NewValidator()
+	if err := playerSuspendRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_suspend_failed", nil, c),
+			constants.PlayerSuspendFailed,
+			err,
+		))
+	}
+
+	players, err := h.playerService(c).Suspend(player_uuid, playerSuspendRequest)
+	if err != nil {
+		return c.Status(playerErrorStatus(err.MessageID)).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PlayerSuspendFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("player_suspend_success", nil, c),
+		constants.PlayerSuspendSuccess,
+		players,
+	))
+}
+
+func (h *PlayerHandler) Delete(c *fiber.Ctx) error {
+	player_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_delete_failed", nil, c),
+			constants.PlayerDeleteFailed,
+			err_uuid,
+		))
+	}
+
+	deleted, err := h.playerService(c).Delete(player_uuid)
+	if err != nil {
+		return c.Status(playerErrorStatus(err.MessageID)).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PlayerDeleteFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("player_delete_success", nil, c),
+		constants.PlayerDeleteSuccess,
+		deleted,
+	))
+}
+
+func (h *PlayerHandler) ResetPassword(c *fiber.Ctx) error {
+	player_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_password_reset_failed", nil, c),
+			constants.PlayerPasswordResetFailed,
+			err_uuid,
+		))
+	}
+
+	var playerPasswordResetRequest PlayerPasswordResetRequest
+	v := utils.NewValidator()
+	if err := playerPasswordResetRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("player_password_reset_failed", nil, c),
+			constants.PlayerPasswordResetFailed,
+			err,
+		))
+	}
+
+	reset, err := h.playerService(c).ResetPassword(player_uuid, playerPasswordResetRequest)
+	if err != nil {
+		return c.Status(playerErrorStatus(err.MessageID)).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PlayerPasswordResetFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("player_password_reset_success", nil, c),
+		constants.PlayerPasswordResetSuccess,
+		reset,
+	))
+}
+
+func playerErrorStatus(messageID string) int {
+	switch messageID {
+	case "player_not_found":
+		return http.StatusNotFound
+	case "player_user_name_exists":
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
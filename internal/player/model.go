@@ -0,0 +1,223 @@
+package player
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/postgres"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	StatusActive    = 1
+	StatusInactive  = 2
+	StatusSuspended = 3
+)
+
+type Player struct {
+	ID           uint64              `json:"id" db:"id" repo:"pk"`
+	PlayerUUID   uuid.UUID           `json:"player_uuid" db:"player_uuid" repo:"uuid"`
+	FirstName    string              `json:"first_name" db:"first_name"`
+	LastName     string              `json:"last_name" db:"last_name"`
+	UserName     string              `json:"user_name" db:"user_name" repo:"noupdate"`
+	Password     string              `json:"-" db:"password" repo:"noselect,noupdate"`
+	Email        string              `json:"email" db:"email"`
+	ProfilePhoto *string             `json:"profile_photo" db:"profile_photo" repo:"readonly"`
+	UserAlias    *string             `json:"user_alias" db:"user_alias"`
+	PhoneNumber  *string             `json:"phone_number" db:"phone_number"`
+	Commission   decimal.NullDecimal `json:"commission" db:"commission"`
+	LastAccess   *time.Time          `json:"last_access" db:"last_access" repo:"readonly"`
+	StatusId     int                 `json:"status_id" db:"status_id" repo:"noupdate"`
+	Order        int                 `json:"order" db:"order"`
+	CreatedBy    *int                `json:"created_by" db:"created_by" repo:"created_by"`
+	Creator      *string             `json:"creator" db:"creator" repo:"readonly" expr:"creator.user_name"`
+	CreatedAt    *time.Time          `json:"created_at" db:"created_at" repo:"created_at"`
+	UpdatedBy    *int                `json:"updated_by" db:"updated_by" repo:"updated_by"`
+	UpdatedAt    *time.Time          `json:"updated_at" db:"updated_at" repo:"updated_at"`
+	DeletedBy    *int                `json:"-" db:"deleted_by" repo:"deleted_by"`
+	DeletedAt    *time.Time          `json:"-" db:"deleted_at" repo:"deleted_at"`
+}
+
+// playerFields are the public fields of the player list
+var playerFields = postgres.FieldRegistry{
+	"id":           {Column: "p.id", Type: postgres.FieldInt, Operators: postgres.OpsNumber, Sortable: true, Key: "id"},
+	"player_uuid":  {Column: "p.player_uuid", Type: postgres.FieldUUID, Operators: postgres.OpsIdentity},
+	"first_name":   {Column: "p.first_name", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Key: "first_name"},
+	"last_name":    {Column: "p.last_name", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Key: "last_name"},
+	"user_name":    {Column: "p.user_name", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Key: "user_name"},
+	"user_alias":   {Column: "p.user_alias", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Nullable: true},
+	"email":        {Column: "p.email", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Key: "email"},
+	"phone_number": {Column: "p.phone_number", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Nullable: true},
+	"commission":   {Column: "p.commission", Type: postgres.FieldDecimal, Operators: postgres.OpsNumber, Sortable: true, Nullable: true},
+	"status_id":    {Column: "p.status_id", Type: postgres.FieldInt, Operators: postgres.OpsNumber, Sortable: true, Nullable: true},
+	"last_access":  {Column: "p.last_access", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Nullable: true},
+	"created_at":   {Column: "p.created_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Nullable: true},
+}
+
+var playerModel = postgres.MustModel[Player]()
+
+var playerTable = postgres.Table{
+	Name:   "tbl_players",
+	Alias:  "p",
+	Joins:  "LEFT JOIN tbl_users creator ON p.created_by = creator.id",
+	Fields: playerFields,
+	Search: &postgres.Search{Document: "p.search_document", Text: "p.search_text"},
+}
+
+type PlayerShowRequest struct {
+	PageOptions types.Paging   `json:"paging_options" query:"paging_options" validate:"required"`
+	Sorts       []types.Sort   `json:"sorts,omitempty" query:"sorts"`
+	Filters     []types.Filter `json:"filters,omitempty" query:"filters"`
+	Query       string         `json:"q,omitempty" query:"q" validate:"max=100"`
+}
+
+func (r *PlayerShowRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.QueryParser(r); err != nil {
+		return err
+	}
+	r.Query = strings.TrimSpace(r.Query)
+
+	// The raw value is kept, the field registry converts it to the field type
+	for i := range r.Filters {
+		r.Filters[i].Value = c.Query(fmt.Sprintf("filters[%d][value]", i))
+	}
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type PlayerNewRequest struct {
+	FirstName       string          `json:"first_name" validate:"required"`
+	LastName        string          `json:"last_name" validate:"required"`
+	UserName        string          `json:"user_name" validate:"required"`
+	Password        string          `json:"password" validate:"required,min=6"`
+	PasswordConfirm string          `json:"password_confirm" validate:"required,min=6"`
+	Email           string          `json:"email" validate:"required,email"`
+	UserAlias       *string         `json:"user_alias"`
+	PhoneNumber     *string         `json:"phone_number"`
+	Commission      decimal.Decimal `json:"commission"`
+}
+
+func (r *PlayerNewRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.FirstName = strings.TrimSpace(r.FirstName)
+	r.LastName = strings.TrimSpace(r.LastName)
+	r.UserName = strings.TrimSpace(r.UserName)
+	r.Email = strings.TrimSpace(r.Email)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	if r.Password != r.PasswordConfirm {
+		return fmt.Errorf("confirm password does not match")
+	}
+	return nil
+}
+
+func (r *PlayerNewRequest) toPlayer() *Player {
+	return &Player{
+		FirstName:   r.FirstName,
+		LastName:    r.LastName,
+		UserName:    r.UserName,
+		Password:    r.Password,
+		Email:       r.Email,
+		UserAlias:   r.UserAlias,
+		PhoneNumber: r.PhoneNumber,
+		Commission:  decimal.NullDecimal{Decimal: r.Commission, Valid: true},
+		StatusId:    StatusActive,
+		Order:       1,
+	}
+}
+
+type PlayerUpdateRequest struct {
+	FirstName   string          `json:"first_name" validate:"required"`
+	LastName    string          `json:"last_name" validate:"required"`
+	Email       string          `json:"email" validate:"required,email"`
+	UserAlias   *string         `json:"user_alias"`
+	PhoneNumber *string         `json:"phone_number"`
+	Commission  decimal.Decimal `json:"commission"`
+}
+
+func (r *PlayerUpdateRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.FirstName = strings.TrimSpace(r.FirstName)
+	r.LastName = strings.TrimSpace(r.LastName)
+	r.Email = strings.TrimSpace(r.Email)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *PlayerUpdateRequest) apply(p *Player) {
+	p.FirstName = r.FirstName
+	p.LastName = r.LastName
+	p.Email = r.Email
+	p.UserAlias = r.UserAlias
+	p.PhoneNumber = r.PhoneNumber
+	p.Commission = decimal.NullDecimal{Decimal: r.Commission, Valid: true}
+}
+
+type PlayerSuspendRequest struct {
+	Reason string `json:"reason" validate:"required,max=255"`
+}
+
+func (r *PlayerSuspendRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.Reason = strings.TrimSpace(r.Reason)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type PlayerPasswordResetRequest struct {
+	Password        string `json:"password" validate:"required,min=6"`
+	PasswordConfirm string `json:"password_confirm" validate:"required,min=6"`
+}
+
+func (r *PlayerPasswordResetRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.Password = strings.TrimSpace(r.Password)
+	r.PasswordConfirm = strings.TrimSpace(r.PasswordConfirm)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	if r.Password != r.PasswordConfirm {
+		return fmt.Errorf("confirm password does not match")
+	}
+	return nil
+}
+
+type PlayerResponse struct {
+	Players []Player             `json:"players"`
+	Total   int                  `json:"-"`
+	Cursor  *postgres.CursorPage `json:"-"`
+}
+
+type PlayerDeleteResponse struct {
+	Success bool `json:"success"`
+}
+
+type PlayerPasswordResetResponse struct {
+	Success bool `json:"success"`
+}
@@ -0,0 +1,284 @@
+package player
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"snack-shop/pkg/events"
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/postgres"
+	"snack-shop/pkg/responses"
+	utils "snack-shop/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Player specific audit actions, the generic ones come from postgres.Audit*
+const (
+	auditSuspend       = "suspend"
+	auditPasswordReset = "password_reset"
+)
+
+// lastAccessInterval throttles the last_access write to one per player and interval
+const lastAccessInterval = time.Minute
+
+type PlayerRepo interface {
+	Show(playerShowRequest PlayerShowRequest) (*PlayerResponse, *responses.ErrorResponse)
+	ShowOne(player_uuid uuid.UUID) (*PlayerResponse, *responses.ErrorResponse)
+	Create(plreq PlayerNewRequest) (*PlayerResponse, *responses.ErrorResponse)
+	Update(player_uuid uuid.UUID, plreq PlayerUpdateRequest) (*PlayerResponse, *responses.ErrorResponse)
+	Suspend(player_uuid uuid.UUID, plreq PlayerSuspendRequest) (*PlayerResponse, *responses.ErrorResponse)
+	Delete(player_uuid uuid.UUID) (*PlayerDeleteResponse, *responses.ErrorResponse)
+	ResetPassword(player_uuid uuid.UUID, plreq PlayerPasswordResetRequest) (*PlayerPasswordResetResponse, *responses.ErrorResponse)
+	CheckSession(loginSession string) (*types.PlayerSession, *responses.ErrorResponse)
+	TouchLastAccess(playerID int64) error
+}
+
+type PlayerRepoImpl struct {
+	userCtx *types.UserContext
+	db      *sqlx.DB
+	players *postgres.Repository[Player]
+}
+
+func NewPlayerRepoImpl(u *types.UserContext, db *sqlx.DB) *PlayerRepoImpl {
+	p := &PlayerRepoImpl{
+		userCtx: u,
+		db:      db,
+	}
+	table := playerTable
+	table.Audit = p.audit
+	p.players = playerModel.Repository(db, table, u)
+	return p
+}
+
+func (p *PlayerRepoImpl) Show(playerShowRequest PlayerShowRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	page, err := p.players.List(context.Background(), postgres.ListOptions{
+		Paging:  playerShowRequest.PageOptions,
+		Sorts:   playerShowRequest.Sorts,
+		Filters: playerShowRequest.Filters,
+		Query:   playerShowRequest.Query,
+	})
+	if err != nil {
+		custom_log.NewCustomLog("player_show_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("player_show_failed", err)
+	}
+
+	return &PlayerResponse{Players: page.Rows, Total: page.Total, Cursor: page.Cursor}, nil
+}
+
+func (p *PlayerRepoImpl) ShowOne(player_uuid uuid.UUID) (*PlayerResponse, *responses.ErrorResponse) {
+	player, err := p.players.Get(context.Background(), player_uuid)
+	if err != nil {
+		return nil, p.playerError("player_showone_failed", err)
+	}
+	return &PlayerResponse{Players: []Player{*player}}, nil
+}
+
+func (p *PlayerRepoImpl) Create(plreq PlayerNewRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	player := plreq.toPlayer()
+	if err := p.players.Insert(context.Background(), player); err != nil {
+		return nil, p.playerError("player_create_failed", err)
+	}
+	return p.ShowOne(player.PlayerUUID)
+}
+
+func (p *PlayerRepoImpl) Update(player_uuid uuid.UUID, plreq PlayerUpdateRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	var player *Player
+	err := p.players.Transaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		if player, err = p.players.GetForUpdate(ctx, player_uuid); err != nil {
+			return err
+		}
+		plreq.apply(player)
+		return p.players.Update(ctx, player_uuid, player)
+	})
+	if err != nil {
+		return nil, p.playerError("player_update_failed", err)
+	}
+	return &PlayerResponse{Players: []Player{*player}}, nil
+}
+
+func (p *PlayerRepoImpl) Suspend(player_uuid uuid.UUID, plreq PlayerSuspendRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	var player *Player
+	err := p.players.Transaction(context.Background(), func(ctx context.Context) error {
+		actorID, now, err := p.players.Actor(ctx)
+		if err != nil {
+			return err
+		}
+		if player, err = p.players.GetForUpdate(ctx, player_uuid); err != nil {
+			return err
+		}
+		if player.StatusId == StatusSuspended {
+			return fmt.Errorf("player `%s` is already suspended", player.UserName)
+		}
+
+		// Clearing the session logs the player out everywhere
+		err = p.players.Exec(ctx, `
+			UPDATE tbl_players SET
+				status_id = $1,
+				login_session = NULL,
+				updated_by = $2,
+				updated_at = $3
+			WHERE player_uuid = $4`,
+			StatusSuspended, actorID, now, player_uuid)
+		if err != nil {
+			return err
+		}
+
+		player.StatusId = StatusSuspended
+		p.players.Audit(ctx, auditSuspend, actorID, player, plreq.Reason)
+		return nil
+	})
+	if err != nil {
+		return nil, p.playerError("player_suspend_failed", err)
+	}
+	events.Emit(events.SessionInvalidated, events.Session{
+		Key:    fmt.Sprintf("member%d", player.ID),
+		Reason: events.ReasonAccountSuspended,
+	})
+	return p.ShowOne(player_uuid)
+}
+
+func (p *PlayerRepoImpl) Delete(player_uuid uuid.UUID) (*PlayerDeleteResponse, *responses.ErrorResponse) {
+	var player *Player
+	err := p.players.Transaction(context.Background(), func(ctx context.Context) error {
+		var err error
+		if player, err = p.players.SoftDelete(ctx, player_uuid); err != nil {
+			return err
+		}
+		return p.players.Exec(ctx, `UPDATE tbl_players SET login_session = NULL WHERE player_uuid = $1`, player_uuid)
+	})
+	if err != nil {
+		return nil, p.playerError("player_delete_failed", err)
+	}
+	events.Emit(events.SessionInvalidated, events.Session{
+		Key:    fmt.Sprintf("member%d", player.ID),
+		Reason: events.ReasonAccountDeleted,
+	})
+	return &PlayerDeleteResponse{Success: true}, nil
+}
+
+func (p *PlayerRepoImpl) ResetPassword(player_uuid uuid.UUID, plreq PlayerPasswordResetRequest) (*PlayerPasswordResetResponse, *responses.ErrorResponse) {
+	var player *Player
+	err := p.players.Transaction(context.Background(), func(ctx context.Context) error {
+		actorID, now, err := p.players.Actor(ctx)
+		if err != nil {
+			return err
+		}
+		player, err = p.players.GetForUpdate(ctx, player_uuid)
+		if err != nil {
+			return err
+		}
+
+		// The player has to log in again with the new password
+		err = p.players.Exec(ctx, `
+			UPDATE tbl_players SET
+				password = $1,
+				login_session = NULL,
+				updated_by = $2,
+				updated_at = $3
+			WHERE player_uuid = $4`,
+			plreq.Password, actorID, now, player_uuid)
+		if err != nil {
+			return err
+		}
+
+		p.players.Audit(ctx, auditPasswordReset, actorID, player, "")
+		return nil
+	})
+	if err != nil {
+		return nil, p.playerError("player_password_reset_failed", err)
+	}
+	events.Emit(events.SessionInvalidated, events.Session{
+		Key:    fmt.Sprintf("member%d", player.ID),
+		Reason: events.ReasonPasswordChanged,
+	})
+	return &PlayerPasswordResetResponse{Success: true}, nil
+}
+
+func (p *PlayerRepoImpl) CheckSession(loginSession string) (*types.PlayerSession, *responses.ErrorResponse) {
+	var session types.PlayerSession
+	err := p.db.Get(&session, `
+		SELECT id, player_uuid, user_name, login_session
+		FROM tbl_players
+		WHERE login_session = $1 AND status_id = $2 AND deleted_at IS NULL
+		LIMIT 1`, loginSession, StatusActive)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			custom_log.NewCustomLog("invalid_session_id", "invalid player login session: "+loginSession, "warn")
+			return nil, responses.NewErrorResponse("invalid_session_id", fmt.Errorf("invalid login session"))
+		}
+		custom_log.NewCustomLog("query_data_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("query_data_failed", fmt.Errorf("cannot check login session"))
+	}
+	return &session, nil
+}
+
+// TouchLastAccess records the time of a player request. The write is skipped while the stored value
+// is recent so a busy player does not update the row on every request.
+func (p *PlayerRepoImpl) TouchLastAccess(playerID int64) error {
+	location, err := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
+	if err != nil {
+		return fmt.Errorf("failed to load location: %w", err)
+	}
+	now := time.Now().In(location)
+
+	_, err = p.db.Exec(`
+		UPDATE tbl_players SET last_access = $1
+		WHERE id = $2 AND (last_access IS NULL OR last_access < $3)`,
+		now, playerID, now.Add(-lastAccessInterval))
+	return err
+}
+
+func (p *PlayerRepoImpl) playerError(messageID string, err error) *responses.ErrorResponse {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return responses.NewErrorResponse("player_not_found", fmt.Errorf("player not found"))
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		return responses.NewErrorResponse("player_user_name_exists", fmt.Errorf("user name is already taken"))
+	case errors.As(err, &pqErr):
+		custom_log.NewCustomLog(messageID, err.Error(), "error")
+		return responses.NewErrorResponse(messageID, fmt.Errorf("database error"))
+	}
+	custom_log.NewCustomLog(messageID, err.Error(), "warn")
+	return responses.NewErrorResponse(messageID, err)
+}
+
+// audit writes player changes to the same trail as the users, on behalf of the admin
+func (p *PlayerRepoImpl) audit(ctx context.Context, action string, actorID int, row interface{}, detail string) {
+	player := row.(*Player)
+
+	var auditContext, auditDesc string
+	switch action {
+	case postgres.AuditInsert:
+		auditContext, auditDesc = "New Player", fmt.Sprintf("New player `%s` has been created", player.UserName)
+	case postgres.AuditUpdate:
+		auditContext, auditDesc = "Update Player", fmt.Sprintf("Updating player `%s` has been successful", player.UserName)
+	case postgres.AuditDelete:
+		auditContext, auditDesc = "Delete Player", fmt.Sprintf("Player `%s` has been deleted", player.UserName)
+	case postgres.AuditRestore:
+		auditContext, auditDesc = "Restore Player", fmt.Sprintf("Player `%s` has been restored", player.UserName)
+	case auditSuspend:
+		auditContext, auditDesc = "Suspend Player", fmt.Sprintf("Player `%s` has been suspended: %s", player.UserName, detail)
+	case auditPasswordReset:
+		auditContext, auditDesc = "Reset Player's password", fmt.Sprintf("Player `%s`'s password has been reset", player.UserName)
+	default:
+		return
+	}
+
+	_, err := utils.AddUserAuditLog(
+		actorID, auditContext, auditDesc, 1, p.userCtx.UserAgent,
+		p.userCtx.UserName, p.userCtx.Ip, actorID, p.db)
+	if err != nil {
+		custom_log.NewCustomLog("player_audit_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+}
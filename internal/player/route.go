@@ -0,0 +1,35 @@
+package player
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// PlayerRoute struct
+type PlayerRoute struct {
+	app     *fiber.App
+	db      *sqlx.DB
+	handler *PlayerHandler
+}
+
+func NewPlayerRoute(app *fiber.App, db *sqlx.DB) *PlayerRoute {
+	return &PlayerRoute{
+		app:     app,
+		db:      db,
+		handler: NewHandler(db),
+	}
+}
+
+func (p *PlayerRoute) RegisterPlayerRoute() *PlayerRoute {
+	v1 := p.app.Group("/api/v1/")
+	player := v1.Group("/player")
+	player.Get("/", p.handler.Show)
+	player.Get("/:id", p.handler.ShowOne)
+	player.Post("/", p.handler.Create)
+	player.Put("/:id", p.handler.Update)
+	player.Put("/:id/suspend", p.handler.Suspend)
+	player.Put("/:id/password/reset", p.handler.ResetPassword)
+	player.Delete("/:id", p.handler.Delete)
+
+	return p
+}
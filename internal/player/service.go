@@ -0,0 +1,78 @@
+package player
+
+import (
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/responses"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type PlayerCreator interface {
+	Show(playerShowRequest PlayerShowRequest) (*PlayerResponse, *responses.ErrorResponse)
+	ShowOne(player_uuid uuid.UUID) (*PlayerResponse, *responses.ErrorResponse)
+	Create(plreq PlayerNewRequest) (*PlayerResponse, *responses.ErrorResponse)
+	Update(player_uuid uuid.UUID, plreq PlayerUpdateRequest) (*PlayerResponse, *responses.ErrorResponse)
+	Suspend(player_uuid uuid.UUID, plreq PlayerSuspendRequest) (*PlayerResponse, *responses.ErrorResponse)
+	Delete(player_uuid uuid.UUID) (*PlayerDeleteResponse, *responses.ErrorResponse)
+	ResetPassword(player_uuid uuid.UUID, plreq PlayerPasswordResetRequest) (*PlayerPasswordResetResponse, *responses.ErrorResponse)
+}
+
+type PlayerService struct {
+	userCtx    *types.UserContext
+	playerRepo PlayerRepo
+}
+
+func NewPlayerService(u *types.UserContext, db *sqlx.DB) *PlayerService {
+	return &PlayerService{
+		userCtx:    u,
+		playerRepo: NewPlayerRepoImpl(u, db),
+	}
+}
+
+func (p *PlayerService) Show(playerShowRequest PlayerShowRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	return p.playerRepo.Show(playerShowRequest)
+}
+
+func (p *PlayerService) ShowOne(player_uuid uuid.UUID) (*PlayerResponse, *responses.ErrorResponse) {
+	return p.playerRepo.ShowOne(player_uuid)
+}
+
+func (p *PlayerService) Create(plreq PlayerNewRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	return p.playerRepo.Create(plreq)
+}
+
+func (p *PlayerService) Update(player_uuid uuid.UUID, plreq PlayerUpdateRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	return p.playerRepo.Update(player_uuid, plreq)
+}
+
+func (p *PlayerService) Suspend(player_uuid uuid.UUID, plreq PlayerSuspendRequest) (*PlayerResponse, *responses.ErrorResponse) {
+	return p.playerRepo.Suspend(player_uuid, plreq)
+}
+
+func (p *PlayerService) Delete(player_uuid uuid.UUID) (*PlayerDeleteResponse, *responses.ErrorResponse) {
+	return p.playerRepo.Delete(player_uuid)
+}
+
+func (p *PlayerService) ResetPassword(player_uuid uuid.UUID, plreq PlayerPasswordResetRequest) (*PlayerPasswordResetResponse, *responses.ErrorResponse) {
+	return p.playerRepo.ResetPassword(player_uuid, plreq)
+}
+
+// PlayerSessionService validates player tokens, it runs in the JWT middleware before any context exists
+type PlayerSessionService struct {
+	playerRepo PlayerRepo
+}
+
+func NewPlayerSessionService(db *sqlx.DB) *PlayerSessionService {
+	return &PlayerSessionService{
+		playerRepo: NewPlayerRepoImpl(&types.UserContext{}, db),
+	}
+}
+
+func (p *PlayerSessionService) CheckSession(loginSession string) (*types.PlayerSession, *responses.ErrorResponse) {
+	return p.playerRepo.CheckSession(loginSession)
+}
+
+func (p *PlayerSessionService) TouchLastAccess(playerID int64) error {
+	return p.playerRepo.TouchLastAccess(playerID)
+}
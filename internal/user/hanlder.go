@@ -7,6 +7,7 @@ import (
 	custom_log "snack-shop/pkg/logs"
 	types "snack-shop/pkg/model"
 	"snack-shop/pkg/utils"
+	"strings"
 
 	response "snack-shop/pkg/http/response"
 
@@ -18,12 +19,14 @@ import (
 // UserHandler struct
 type UserHandler struct {
 	db          *sqlx.DB
+	passwords   PasswordOptions
 	userService func(*fiber.Ctx) UserCreator
 }
 
-func NewHandler(db *sqlx.DB) *UserHandler {
+func NewHandler(db *sqlx.DB, passwords PasswordOptions) *UserHandler {
 	return &UserHandler{
-		db: db,
+		db:        db,
+		passwords: passwords,
 		userService: func(c *fiber.Ctx) UserCreator {
 			UserContext := c.Locals("UserContext")
 
@@ -37,7 +40,7 @@ func NewHandler(db *sqlx.DB) *UserHandler {
 			}
 
 			// Pass uCtx to NewAuthService if needed
-			return NewUserService(&uCtx, db)
+			return NewUserService(&uCtx, db, passwords)
 		},
 	}
 }
@@ -101,16 +104,32 @@ func (h *UserHandler) Show(c *fiber.Ctx) error {
 			constants.UserShowFailed,
 			err.Err,
 		))
-	} else {
-		return c.Status(http.StatusOK).JSON(response.NewResponseWithPaging(
-			utils.Translate("user_show_failed", nil, c),
+	}
+
+	paging := userRequest.PageOptions
+	if paging.IsCursor() {
+		var total *int
+		if paging.CountTotal() {
+			total = &users.Total
+		}
+		return c.Status(http.StatusOK).JSON(response.NewResponseWithCursor(
+			utils.Translate("user_show_success", nil, c),
 			constants.UserShowSuccess,
 			users,
-			1,
-			10,
-			users.Total,
+			paging.Perpage,
+			users.Cursor.NextCursor,
+			users.Cursor.PrevCursor,
+			total,
 		))
 	}
+	return c.Status(http.StatusOK).JSON(response.NewResponseWithPaging(
+		utils.Translate("user_show_success", nil, c),
+		constants.UserShowSuccess,
+		users,
+		paging.Page,
+		paging.Perpage,
+		users.Total,
+	))
 }
 
 func (h *UserHandler) ShowOne(c *fiber.Ctx) error {
@@ -137,6 +156,7 @@ func (h *UserHandler) ShowOne(c *fiber.Ctx) error {
 			err.Err,
 		))
 	} else {
+		c.Set(fiber.HeaderETag, UserETag(users.Users[0].RowVersion))
 		return c.Status(http.StatusOK).JSON(response.NewResponse(
 			utils.Translate("user_show_failed", nil, c),
 			2000,
@@ -192,6 +212,16 @@ func (h *UserHandler) Update(c *fiber.Ctx) error {
 		))
 	}
 
+	// Updates must be based on the representation the client has seen
+	version, err_version := ParseIfMatch(c.Get(fiber.HeaderIfMatch))
+	if err_version != nil {
+		return c.Status(http.StatusPreconditionRequired).JSON(response.NewResponseError(
+			utils.Translate("user_if_match_required", nil, c),
+			-3002,
+			err_version,
+		))
+	}
+
 	var userUpdateRequest UserUpdateRequest
 
 	//Bind and validate
@@ -207,15 +237,94 @@ func (h *UserHandler) Update(c *fiber.Ctx) error {
 	}
 
 	as := h.userService(c)
-	users, err := as.Update(id, userUpdateRequest)
+	users, err := as.Update(id, userUpdateRequest, version)
 
-	if err != nil {
+	if err != nil && err.MessageID == "user_version_conflict" {
+		c.Set(fiber.HeaderETag, UserETag(users.Users[0].RowVersion))
+		return c.Status(http.StatusPreconditionFailed).JSON(response.NewResponseErrorWithData(
+			utils.Translate(err.MessageID, nil, c),
+			-3003,
+			err.Err,
+			users,
+		))
+	} else if err != nil {
 		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
 			utils.Translate(err.MessageID, nil, c),
 			-3001,
 			err.Err,
 		))
 	} else {
+		c.Set(fiber.HeaderETag, UserETag(users.Users[0].RowVersion))
+		return c.Status(http.StatusOK).JSON(response.NewResponse(
+			utils.Translate("user_update_success", nil, c),
+			3001,
+			users,
+		))
+	}
+}
+
+// Patch applies an RFC 7396 merge-patch, only the members present in the document are changed
+func (h *UserHandler) Patch(c *fiber.Ctx) error {
+	id, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("user_update_failed", nil, c),
+			-2000,
+			err_uuid,
+		))
+	}
+
+	if !c.Is("json") && !strings.HasPrefix(c.Get(fiber.HeaderContentType), "application/merge-patch+json") {
+		return c.Status(http.StatusUnsupportedMediaType).JSON(response.NewResponseError(
+			utils.Translate("user_patch_unsupported_media_type", nil, c),
+			-3004,
+			fmt.Errorf("content type must be application/merge-patch+json"),
+		))
+	}
+
+	// Patches must be based on the representation the client has seen
+	version, err_version := ParseIfMatch(c.Get(fiber.HeaderIfMatch))
+	if err_version != nil {
+		return c.Status(http.StatusPreconditionRequired).JSON(response.NewResponseError(
+			utils.Translate("user_if_match_required", nil, c),
+			-3002,
+			err_version,
+		))
+	}
+
+	var userPatchRequest UserPatchRequest
+
+	//Bind and validate
+	v := utils.NewValidator()
+	if err := userPatchRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(
+			response.NewResponseError(
+				utils.Translate("user_update_failed", nil, c),
+				-1000,
+				err,
+			),
+		)
+	}
+
+	as := h.userService(c)
+	users, err := as.Patch(id, userPatchRequest, version)
+
+	if err != nil && err.MessageID == "user_version_conflict" {
+		c.Set(fiber.HeaderETag, UserETag(users.Users[0].RowVersion))
+		return c.Status(http.StatusPreconditionFailed).JSON(response.NewResponseErrorWithData(
+			utils.Translate(err.MessageID, nil, c),
+			-3003,
+			err.Err,
+			users,
+		))
+	} else if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			-3001,
+			err.Err,
+		))
+	} else {
+		c.Set(fiber.HeaderETag, UserETag(users.Users[0].RowVersion))
 		return c.Status(http.StatusOK).JSON(response.NewResponse(
 			utils.Translate("user_update_success", nil, c),
 			3001,
@@ -300,6 +409,7 @@ func (h *UserHandler) GetUserFormUpdate(c *fiber.Ctx) error {
 			err.Err,
 		))
 	} else {
+		c.Set(fiber.HeaderETag, UserETag(users.Users[0].RowVersion))
 		return c.Status(http.StatusOK).JSON(response.NewResponse(
 			utils.Translate("user_update_form_success", nil, c),
 			5000,
@@ -372,3 +482,98 @@ func (h *UserHandler) GetUserBasicInfo(c *fiber.Ctx) error {
 			user_resp,
 		))
 }
+
+// ChangeStatus moves a user through the status state machine, a reason is always required
+func (h *UserHandler) ChangeStatus(c *fiber.Ctx) error {
+	id, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("user_status_failed", nil, c),
+			constants.UserChangeStatusFailed,
+			err_uuid,
+		))
+	}
+
+	var userStatusRequest UserStatusRequest
+	v := utils.NewValidator()
+	if err := userStatusRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			utils.Translate("user_status_failed", nil, c),
+			constants.UserChangeStatusFailed,
+			err,
+		))
+	}
+
+	users, err := h.userService(c).ChangeStatus(id, userStatusRequest)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.MessageID == "user_status_invalid_transition" {
+			status = http.StatusConflict
+		}
+		return c.Status(status).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.UserChangeStatusFailed,
+			err.Err,
+		))
+	}
+
+	c.Set(fiber.HeaderETag, UserETag(users.Users[0].RowVersion))
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("user_status_success", nil, c),
+		constants.UserChangeStatusSuccess,
+		users,
+	))
+}
+
+func (h *UserHandler) StatusHistory(c *fiber.Ctx) error {
+	id, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("user_status_history_failed", nil, c),
+			constants.UserStatusHistoryFailed,
+			err_uuid,
+		))
+	}
+
+	history, err := h.userService(c).StatusHistory(id)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.UserStatusHistoryFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("user_status_history_success", nil, c),
+		constants.UserStatusHistorySuccess,
+		history,
+	))
+}
+
+// ChangeExpiredPassword is public, the challenge token of the login response authorizes it
+func (h *UserHandler) ChangeExpiredPassword(c *fiber.Ctx) error {
+	var passwordChangeRequest PasswordChangeRequest
+	if err := passwordChangeRequest.bind(c, utils.NewValidator()); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("password_change_failed", nil, c),
+			constants.PasswordChangeFailed,
+			err,
+		))
+	}
+
+	uCtx := types.UserContext{UserAgent: c.Get("User-Agent"), Ip: c.IP()}
+	success, err := NewUserService(&uCtx, h.db, h.passwords).ChangeExpiredPassword(passwordChangeRequest)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.PasswordChangeFailed,
+			err.Err,
+		))
+	}
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("password_change_success", nil, c),
+		constants.PasswordChangeSuccess,
+		success,
+	))
+}
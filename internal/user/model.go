@@ -1,8 +1,8 @@
 package user
 
 import (
-	"database/sql"
-	"errors"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	types "snack-shop/pkg/model"
+	password_policy "snack-shop/pkg/password"
 	postgres "snack-shop/pkg/postgres"
 	"snack-shop/pkg/utils"
 
@@ -36,30 +37,34 @@ func NewUserContext(userUuid string, userName string, loginSession string, exp t
 }
 
 type User struct {
-	ID           uint64          `db:"id"`
-	UserUUID     uuid.UUID       `db:"user_uuid"`
-	FirstName    string          `db:"first_name"`
-	LastName     string          `db:"last_name"`
-	UserName     string          `db:"user_name"`
-	Email        string          `db:"email"`
-	RoleId       int             `db:"role_id"`
-	RoleName     string          `db:"role_name"` // from ur.user_role_name (was incorrect as int)
-	Status       string          `db:"status"`    // assuming PostgreSQL BOOLEAN column
-	LoginSession *string         `db:"login_session"`
-	ProfilePhoto *string         `db:"profile_photo"`
-	UserAlias    *string         `db:"user_alias"`
-	PhoneNumber  *string         `db:"phone_number"`
-	UserAvatarID *int            `db:"user_avatar_id"`
-	Commission   decimal.Decimal `db:"commission"`
-	StatusId     int             `db:"status_id"`
-	Order        int             `db:"order"`
-	CreatedBy    int             `db:"created_by"`
-	Creator      string          `db:"creator"`
-	CreatedAt    time.Time       `db:"created_at"`
-	UpdatedBy    *int            `db:"updated_by"`
-	UpdatedAt    *time.Time      `db:"updated_at"`
-	DeletedBy    *int            `db:"deleted_by"`
-	DeletedAt    *time.Time      `db:"deleted_at"`
+	ID              uint64          `db:"id"`
+	UserUUID        uuid.UUID       `db:"user_uuid"`
+	FirstName       string          `db:"first_name"`
+	LastName        string          `db:"last_name"`
+	UserName        string          `db:"user_name"`
+	Email           string          `db:"email"`
+	RoleId          int             `db:"role_id"`
+	RoleName        string          `db:"role_name"` // from ur.user_role_name (was incorrect as int)
+	Status          string          `db:"status"`    // assuming PostgreSQL BOOLEAN column
+	LoginSession    *string         `db:"login_session"`
+	ProfilePhoto    *string         `db:"profile_photo"`
+	UserAlias       *string         `db:"user_alias"`
+	PhoneNumber     *string         `db:"phone_number"`
+	UserAvatarID    *int            `db:"user_avatar_id"`
+	Commission      decimal.Decimal `db:"commission"`
+	EmailVerifiedAt *time.Time      `db:"email_verified_at"`
+	PhoneVerifiedAt *time.Time      `db:"phone_verified_at"`
+	StatusId        int             `db:"status_id"`
+	SuspendedUntil  *time.Time      `db:"suspended_until"`
+	RowVersion      int             `db:"row_version"`
+	Order           int             `db:"order"`
+	CreatedBy       int             `db:"created_by"`
+	Creator         string          `db:"creator"`
+	CreatedAt       time.Time       `db:"created_at"`
+	UpdatedBy       *int            `db:"updated_by"`
+	UpdatedAt       *time.Time      `db:"updated_at"`
+	DeletedBy       *int            `db:"deleted_by"`
+	DeletedAt       *time.Time      `db:"deleted_at"`
 }
 
 type UserAddModel struct {
@@ -82,14 +87,16 @@ type UserAddModel struct {
 	Order        uint64          `db:"order_num"`
 	CreatedBy    uint64          `db:"created_by"`
 	CreatedAt    time.Time       `db:"created_at"`
+
+	PasswordHistory int
 }
 
 type UserNewRequest struct {
 	FirstName       string          `json:"first_name" validate:"required"`
 	LastName        string          `json:"last_name" validate:"required"`
 	UserName        string          `json:"user_name" validate:"required"`
-	Password        string          `json:"password" validate:"required,min=6"`
-	PasswordConfirm string          `json:"password_confirm" validate:"required,min=6"`
+	Password        string          `json:"password" validate:"required"`
+	PasswordConfirm string          `json:"password_confirm" validate:"required"`
 	Email           string          `json:"email" validate:"required,email"`
 	RoleId          int             `json:"role_id" validate:"required"`
 	PhoneNumber     *string         `json:"phone_number" validate:"required"`
@@ -120,11 +127,20 @@ func (r *UserNewRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
 }
 
 // user.cTx
-func (u *UserAddModel) New(usreq UserNewRequest, usctx *types.UserContext, dbtx *sqlx.Tx) error {
+func (u *UserAddModel) New(usreq UserNewRequest, usctx *types.UserContext, passwords PasswordOptions, dbtx *sqlx.Tx) error {
 	if usctx.RoleId > uint64(usreq.RoleId) {
 		return fmt.Errorf("permission denied: cannot create a user with a higher role")
 	}
 
+	// Apply the password policy of the new user's role
+	policy, err := password_policy.LoadPolicy(dbtx, usreq.RoleId)
+	if err != nil {
+		return err
+	}
+	if err := policy.Check(usreq.Password, usreq.UserName, passwords.Common); err != nil {
+		return err
+	}
+
 	uid, err := uuid.NewV7()
 	if err != nil {
 		return err
@@ -181,6 +197,7 @@ func (u *UserAddModel) New(usreq UserNewRequest, usctx *types.UserContext, dbtx
 	u.Order = u.ID
 	u.CreatedBy = uint64(*byID)
 	u.CreatedAt = localNow
+	u.PasswordHistory = policy.History
 
 	return nil
 }
@@ -192,7 +209,7 @@ type UserUpdateRequest struct {
 	RoleId      int             `json:"role_id"  validate:"required"`
 	PhoneNumber *string         `json:"phone_number"  validate:"required"`
 	Commission  decimal.Decimal `json:"commission"`
-	StatusId    int             `json:"status_id"  validate:"required"`
+	StatusId    int             `json:"status_id"  validate:"omitempty"` // only accepted unchanged, see PUT /user/:id/status
 }
 
 func (r *UserUpdateRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
@@ -259,7 +276,22 @@ func (u *UserUpdateModel) New(user_uuid uuid.UUID, usreq UserUpdateRequest, usct
 		return err_seq
 	} else {
 		if !is_useruuid {
-			return fmt.Errorf(fmt.Sprintf("user uuid:`%s` not found dddd", user_uuid))
+			return fmt.Errorf("user uuid:`%s` not found", user_uuid)
+		}
+	}
+
+	if usreq.StatusId != 0 {
+		sameStatus, err := postgres.IsExistsWhere(
+			"tbl_users",
+			"user_uuid = $1 AND status_id = $2",
+			[]interface{}{user_uuid, usreq.StatusId},
+			dbstream,
+		)
+		if err != nil {
+			return fmt.Errorf("cannot check user status")
+		}
+		if !sameStatus {
+			return errStatusChange
 		}
 	}
 
@@ -291,15 +323,214 @@ func (u *UserUpdateModel) New(user_uuid uuid.UUID, usreq UserUpdateRequest, usct
 	u.RoleId = usreq.RoleId
 	u.PhoneNumber = usreq.PhoneNumber
 	u.Commission = usreq.Commission
-	u.StatusId = uint64(usreq.StatusId)
 	u.UpdatedBy = uint64(*by_id)
 	u.UpdatedAt = local_now
 	return nil
 }
 
+// userPatchFields are the members a merge-patch document may contain
+var userPatchFields = map[string]bool{
+	"first_name":   true,
+	"last_name":    true,
+	"email":        true,
+	"role_id":      true,
+	"phone_number": true,
+	"commission":   true,
+	"status_id":    true,
+}
+
+// UserPatchRequest is an RFC 7396 merge-patch document. A nil field is not part of the patch,
+// phone_number is the only member that can be removed with an explicit null.
+type UserPatchRequest struct {
+	FirstName        *string          `json:"first_name" validate:"omitnil,min=1"`
+	LastName         *string          `json:"last_name" validate:"omitnil,min=1"`
+	Email            *string          `json:"email" validate:"omitnil,email"`
+	RoleId           *int             `json:"role_id" validate:"omitnil,min=1"`
+	PhoneNumber      *string          `json:"phone_number" validate:"omitnil,min=1"`
+	Commission       *decimal.Decimal `json:"commission"`
+	StatusId         *int             `json:"status_id" validate:"omitnil,min=1"`
+	ClearPhoneNumber bool             `json:"-"`
+}
+
+func (r *UserPatchRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &members); err != nil {
+		return fmt.Errorf("patch document must be a JSON object")
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("patch document is empty")
+	}
+	for name, raw := range members {
+		if !userPatchFields[name] {
+			return fmt.Errorf("field `%s` cannot be patched", name)
+		}
+		if string(bytes.TrimSpace(raw)) == "null" {
+			if name != "phone_number" {
+				return fmt.Errorf("field `%s` cannot be removed", name)
+			}
+			r.ClearPhoneNumber = true
+		}
+	}
+
+	if err := json.Unmarshal(c.Body(), r); err != nil {
+		return err
+	}
+	for _, s := range []*string{r.FirstName, r.LastName, r.Email, r.PhoneNumber} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UserFieldChange is one column modified by a patch, used for the SQL and the audit trail
+type UserFieldChange struct {
+	Column string
+	Old    interface{}
+	New    interface{}
+}
+
+type UserPatchModel struct {
+	ID        uint64
+	UserUUID  uuid.UUID
+	UserName  string
+	Changes   []UserFieldChange
+	UpdatedBy uint64
+	UpdatedAt time.Time
+}
+
+// New diffs the patch against the current row, only the members that really change are kept
+func (u *UserPatchModel) New(current *User, patch UserPatchRequest, usctx *types.UserContext, dbstream *sqlx.Tx) error {
+	// check permission
+	if current.UserName == usctx.UserName {
+		return fmt.Errorf("you cannot update your own information")
+	}
+	// The role hierarchy only matters when the patch changes the role
+	if patch.RoleId != nil && usctx.RoleId > uint64(*patch.RoleId) {
+		return fmt.Errorf("permission denied : you can't update a user that have bigger or equal role to you")
+	}
+
+	//Get user logined id
+	by_id, err := postgres.GetIdByUuid("tbl_users", "user_uuid", usctx.UserUuid, dbstream)
+	if err != nil {
+		return err
+	}
+
+	//Get current OS time
+	app_timezone := os.Getenv("APP_TIMEZONE")
+	location, err := time.LoadLocation(app_timezone)
+	if err != nil {
+		return fmt.Errorf("failed to load location: %w", err)
+	}
+
+	u.ID = current.ID
+	u.UserUUID = current.UserUUID
+	u.UserName = current.UserName
+	u.UpdatedBy = uint64(*by_id)
+	u.UpdatedAt = time.Now().In(location)
+
+	if patch.FirstName != nil && *patch.FirstName != current.FirstName {
+		u.Changes = append(u.Changes, UserFieldChange{"first_name", current.FirstName, *patch.FirstName})
+	}
+	if patch.LastName != nil && *patch.LastName != current.LastName {
+		u.Changes = append(u.Changes, UserFieldChange{"last_name", current.LastName, *patch.LastName})
+	}
+	if patch.Email != nil && *patch.Email != current.Email {
+		u.Changes = append(u.Changes, UserFieldChange{"email", current.Email, *patch.Email})
+	}
+	if patch.RoleId != nil && *patch.RoleId != current.RoleId {
+		u.Changes = append(u.Changes, UserFieldChange{"role_id", current.RoleId, *patch.RoleId})
+	}
+	if patch.StatusId != nil && *patch.StatusId != current.StatusId {
+		return errStatusChange
+	}
+	if patch.Commission != nil && !patch.Commission.Equal(current.Commission) {
+		u.Changes = append(u.Changes, UserFieldChange{"commission", current.Commission, *patch.Commission})
+	}
+
+	currentPhone := current.PhoneNumber
+	if patch.ClearPhoneNumber && currentPhone != nil {
+		u.Changes = append(u.Changes, UserFieldChange{"phone_number", *currentPhone, nil})
+	} else if patch.PhoneNumber != nil && (currentPhone == nil || *currentPhone != *patch.PhoneNumber) {
+		var old interface{}
+		if currentPhone != nil {
+			old = *currentPhone
+		}
+		u.Changes = append(u.Changes, UserFieldChange{"phone_number", old, *patch.PhoneNumber})
+	}
+	return nil
+}
+
+// AuditDescription lists every changed column with its old and new value
+func (u *UserPatchModel) AuditDescription() string {
+	changes := make([]string, 0, len(u.Changes))
+	for _, change := range u.Changes {
+		changes = append(changes, fmt.Sprintf("%s: `%v` -> `%v`", change.Column, auditValue(change.Old), auditValue(change.New)))
+	}
+	return fmt.Sprintf("User `%s` has been patched (%s)", u.UserName, strings.Join(changes, ", "))
+}
+
+func auditValue(value interface{}) interface{} {
+	if value == nil {
+		return "null"
+	}
+	return value
+}
+
+// UserETag formats a row version as a strong HTTP entity tag
+func UserETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ParseIfMatch extracts the row version from an If-Match header. Weak tags and `*` are rejected
+// because an update must be based on one exact representation.
+func ParseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, fmt.Errorf("missing If-Match header")
+	}
+	if strings.HasPrefix(header, "W/") || header == "*" || strings.Contains(header, ",") {
+		return 0, fmt.Errorf("If-Match must contain exactly one strong entity tag")
+	}
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid entity tag `%s`", header)
+	}
+	return version, nil
+}
+
+// userFields are the public fields of the user list. Filters and sorts can only reference these,
+// the columns are never taken from the request. Only NOT NULL columns get a cursor Key, the keyset
+// comparison would skip rows where the column is NULL.
+var userFields = postgres.FieldRegistry{
+	"id":                {Column: "u.id", Type: postgres.FieldInt, Operators: postgres.OpsNumber, Sortable: true, Key: "id"},
+	"user_uuid":         {Column: "u.user_uuid", Type: postgres.FieldUUID, Operators: postgres.OpsIdentity},
+	"first_name":        {Column: "u.first_name", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Nullable: true},
+	"last_name":         {Column: "u.last_name", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Nullable: true},
+	"user_name":         {Column: "u.user_name", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Key: "user_name"},
+	"user_alias":        {Column: "u.user_alias", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Nullable: true},
+	"email":             {Column: "u.email", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Key: "email"},
+	"phone_number":      {Column: "u.phone_number", Type: postgres.FieldString, Operators: postgres.OpsString, Sortable: true, Nullable: true},
+	"role_id":           {Column: "u.role_id", Type: postgres.FieldInt, Operators: postgres.OpsNumber, Sortable: true, Key: "role_id"},
+	"status_id":         {Column: "u.status_id", Type: postgres.FieldInt, Operators: postgres.OpsNumber, Sortable: true, Key: "status_id"},
+	"commission":        {Column: "u.commission", Type: postgres.FieldDecimal, Operators: postgres.OpsNumber, Sortable: true},
+	"email_verified_at": {Column: "u.email_verified_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Nullable: true},
+	"phone_verified_at": {Column: "u.phone_verified_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Nullable: true},
+	"created_at":        {Column: "u.created_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Key: "created_at"},
+	"updated_at":        {Column: "u.updated_at", Type: postgres.FieldTime, Operators: postgres.OpsTime, Sortable: true, Nullable: true},
+}
+
+// userSearch searches first/last name, user name, alias, email and phone number
+var userSearch = postgres.Search{Document: "u.search_document", Text: "u.search_text"}
+
 type UserResponse struct {
-	Users []User `json:"users"`
-	Total int    `json:"-"`
+	Users  []User               `json:"users"`
+	Total  int                  `json:"-"`
+	Cursor *postgres.CursorPage `json:"-"`
 }
 
 type TotalRecord struct {
@@ -309,6 +540,7 @@ type UserShowRequest struct {
 	PageOptions types.Paging   `json:"paging_options" query:"paging_options" validate:"required"`
 	Sorts       []types.Sort   `json:"sorts,omitempty" query:"sorts"`
 	Filters     []types.Filter `json:"filters,omitempty" query:"filters"`
+	Query       string         `json:"q,omitempty" query:"q" validate:"max=100"`
 }
 
 func (r *UserShowRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
@@ -317,16 +549,12 @@ func (r *UserShowRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
 		return err
 	}
 
+	r.Query = strings.TrimSpace(r.Query)
+
 	//Fix bug `Filter.Value` nil when http query params failed parse to json type `interface{}`
+	//The raw value is kept, the field registry converts it to the field type
 	for i := range r.Filters {
-		value := c.Query(fmt.Sprintf("filters[%d][value]", i))
-		if intValue, err := strconv.Atoi(value); err == nil {
-			r.Filters[i].Value = intValue
-		} else if boolValue, err := strconv.ParseBool(value); err == nil {
-			r.Filters[i].Value = boolValue
-		} else {
-			r.Filters[i].Value = value
-		}
+		r.Filters[i].Value = c.Query(fmt.Sprintf("filters[%d][value]", i))
 	}
 
 	if err := v.Validate(r); err != nil {
@@ -361,6 +589,7 @@ type UserFormCreateResponse struct {
 }
 
 type UserUpdateForm struct {
+	RowVersion  int             `json:"row_version"`
 	FirstName   string          `json:"first_name"`
 	LastName    string          `json:"last_name"`
 	UserName    string          `json:"user_name"`
@@ -381,14 +610,16 @@ type UserUpdatePasswordReponse struct {
 }
 type UserUpdatePasswordModel struct {
 	UserUUID  uuid.UUID
-	Password  string `json:"password" validate:"required,min=6"`
+	Target    *passwordTarget
+	Policy    *password_policy.Policy
+	Password  string `json:"password" validate:"required"`
 	UpdatedBy uint64
 	UpdatedAt time.Time
 }
 type UserUpdatePasswordRequest struct {
 	OldPassword     string `json:"old_password" validate:"required"`
-	Password        string `json:"password" validate:"required,min=6"`
-	PasswordConfirm string `json:"password_confirm" validate:"required,min=6"`
+	Password        string `json:"password" validate:"required"`
+	PasswordConfirm string `json:"password_confirm" validate:"required"`
 }
 
 func (r *UserUpdatePasswordRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
@@ -416,16 +647,13 @@ func (r *UserUpdatePasswordRequest) bind(c *fiber.Ctx, v *utils.Validator) error
 	return nil
 }
 
-func (u *UserUpdatePasswordModel) New(user_uuid uuid.UUID, usreq UserUpdatePasswordRequest, usctx *types.UserContext, db *sqlx.Tx) error {
+func (u *UserUpdatePasswordModel) New(user_uuid uuid.UUID, usreq UserUpdatePasswordRequest, usctx *types.UserContext, passwords PasswordOptions, db *sqlx.Tx) error {
 
-	// Check if user_uuid exists
-	is_useruuid, err := postgres.IsExists("tbl_users", "user_uuid", user_uuid, db)
+	// Lock the target user, the history check and the update must see the same password
+	target, err := getPasswordTarget(user_uuid, db)
 	if err != nil {
 		return err
 	}
-	if !is_useruuid {
-		return fmt.Errorf("user update by uuid:`%s` not found", user_uuid)
-	}
 
 	// Get the ID of the user performing the update
 	by_id, err := postgres.GetIdByUuid("tbl_users", "user_uuid", usctx.UserUuid, db)
@@ -433,22 +661,17 @@ func (u *UserUpdatePasswordModel) New(user_uuid uuid.UUID, usreq UserUpdatePassw
 		return err
 	}
 
-	// Fetch the existing password for the target user
-	var oldPassword string
-	query := `SELECT password FROM tbl_users WHERE user_uuid = $1`
-	err = db.Get(&oldPassword, query, user_uuid)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("can't find the old password")
-		}
-		return fmt.Errorf("failed to query old password: %w", err)
-	}
-
 	// Verify the old password matches
-	if usreq.OldPassword != oldPassword {
+	if usreq.OldPassword != target.Password {
 		return fmt.Errorf("old password does not match")
 	}
 
+	// Apply the password policy of the target's role
+	policy, err := checkNewPassword(target, usreq.Password, passwords, db)
+	if err != nil {
+		return err
+	}
+
 	// Get current time in configured timezone
 	app_timezone := os.Getenv("APP_TIMEZONE")
 	location, err := time.LoadLocation(app_timezone)
@@ -460,6 +683,8 @@ func (u *UserUpdatePasswordModel) New(user_uuid uuid.UUID, usreq UserUpdatePassw
 	// Update struct values (presumably for later use)
 	u.Password = usreq.Password
 	u.UserUUID = user_uuid
+	u.Target = target
+	u.Policy = policy
 	u.UpdatedBy = uint64(*by_id)
 	u.UpdatedAt = local_now
 
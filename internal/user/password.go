@@ -0,0 +1,157 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	password_policy "snack-shop/pkg/password"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// PasswordOptions are the password policy settings shared by every request
+type PasswordOptions struct {
+	HistorySecret   string
+	ChallengeSecret string
+	Common          *password_policy.CommonList
+}
+
+// passwordTarget is the locked account row a new password is checked against
+type passwordTarget struct {
+	ID                uint64     `db:"id"`
+	UserUUID          uuid.UUID  `db:"user_uuid"`
+	UserName          string     `db:"user_name"`
+	FirstName         string     `db:"first_name"`
+	LastName          string     `db:"last_name"`
+	RoleId            int        `db:"role_id"`
+	Password          string     `db:"password"`
+	PasswordChangedAt *time.Time `db:"password_changed_at"`
+}
+
+func getPasswordTarget(user_uuid uuid.UUID, db *sqlx.Tx) (*passwordTarget, error) {
+	var target passwordTarget
+	query := `
+		SELECT id, user_uuid, user_name, first_name, last_name, role_id, password, password_changed_at
+		FROM tbl_users
+		WHERE user_uuid = $1 AND deleted_at IS NULL
+		FOR UPDATE`
+	err := db.Get(&target, query, user_uuid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user update by uuid:`%s` not found", user_uuid)
+		}
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	return &target, nil
+}
+
+// checkNewPassword applies the policy of the role of the target to a new password, including
+// the reuse of the current and the last passwords. It returns the policy for the history size.
+func checkNewPassword(target *passwordTarget, new_password string, passwords PasswordOptions, db *sqlx.Tx) (*password_policy.Policy, error) {
+	policy, err := password_policy.LoadPolicy(db, target.RoleId)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Check(new_password, target.UserName, passwords.Common); err != nil {
+		return nil, err
+	}
+
+	if new_password == target.Password {
+		return nil, &password_policy.PolicyError{Violations: []string{"must differ from the current password"}}
+	}
+	reused, err := password_policy.IsReused(db, passwords.HistorySecret, target.ID, new_password, policy.History)
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, &password_policy.PolicyError{Violations: []string{fmt.Sprintf("must not be one of the last %d passwords", policy.History)}}
+	}
+	return policy, nil
+}
+
+// passwordErrorID is the message id of an error of a password change
+func passwordErrorID(err error, fallback string) string {
+	var policyErr *password_policy.PolicyError
+	if errors.As(err, &policyErr) {
+		return "password_policy_violation"
+	}
+	return fallback
+}
+
+// PasswordChangeRequest completes the challenge login returns for an expired password
+type PasswordChangeRequest struct {
+	Token           string `json:"token" validate:"required"`
+	Password        string `json:"password" validate:"required"`
+	PasswordConfirm string `json:"password_confirm" validate:"required"`
+}
+
+func (r *PasswordChangeRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.Token = strings.TrimSpace(r.Token)
+	r.Password = strings.TrimSpace(r.Password)
+	r.PasswordConfirm = strings.TrimSpace(r.PasswordConfirm)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	if r.Password != r.PasswordConfirm {
+		return fmt.Errorf("confirm password does not match")
+	}
+	return nil
+}
+
+// PasswordChangeModel is an expired password replaced through a challenge token
+type PasswordChangeModel struct {
+	Target    *passwordTarget
+	Policy    *password_policy.Policy
+	Password  string
+	UpdatedAt time.Time
+}
+
+func (u *PasswordChangeModel) New(req PasswordChangeRequest, passwords PasswordOptions, db *sqlx.Tx) error {
+	challenge, err := password_policy.ParseChallenge(passwords.ChallengeSecret, req.Token)
+	if err != nil {
+		return err
+	}
+
+	target, err := getPasswordTarget(challenge.UserUUID, db)
+	if err != nil {
+		return err
+	}
+
+	// The token belongs to the expired password, it is spent once the password has changed
+	var changed_at int64
+	if target.PasswordChangedAt != nil {
+		changed_at = target.PasswordChangedAt.Unix()
+	}
+	if changed_at != challenge.ChangedAt {
+		return fmt.Errorf("password change token has already been used")
+	}
+
+	policy, err := checkNewPassword(target, req.Password, passwords, db)
+	if err != nil {
+		return err
+	}
+
+	//Get current OS time
+	app_timezone := os.Getenv("APP_TIMEZONE")
+	location, err := time.LoadLocation(app_timezone)
+	if err != nil {
+		return fmt.Errorf("failed to load location: %w", err)
+	}
+
+	u.Target = target
+	u.Policy = policy
+	u.Password = req.Password
+	u.UpdatedAt = time.Now().In(location)
+	return nil
+}
@@ -3,14 +3,17 @@ package user
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 	"time"
 
+	"snack-shop/pkg/events"
 	custom_log "snack-shop/pkg/logs"
 	types "snack-shop/pkg/model"
+	password_policy "snack-shop/pkg/password"
 	"snack-shop/pkg/postgres"
 	"snack-shop/pkg/responses"
 	utils "snack-shop/pkg/utils"
@@ -24,23 +27,30 @@ type UserRepo interface {
 	Show(userShowRequest UserShowRequest) (*UserResponse, *responses.ErrorResponse)
 	ShowOne(user_uuid uuid.UUID) (*UserResponse, *responses.ErrorResponse)
 	Create(usreq UserNewRequest) (*UserResponse, *responses.ErrorResponse)
-	Update(user_uuid uuid.UUID, usreq UserUpdateRequest) (*UserResponse, *responses.ErrorResponse)
+	Update(user_uuid uuid.UUID, usreq UserUpdateRequest, version int) (*UserResponse, *responses.ErrorResponse)
+	Patch(user_uuid uuid.UUID, patch UserPatchRequest, version int) (*UserResponse, *responses.ErrorResponse)
 	Delete(user_uuid uuid.UUID) (*UserDeleteResponse, *responses.ErrorResponse)
 	GetUserFormCreate() (*UserFormCreateResponse, *responses.ErrorResponse)
 	GetUserFormUpdate(user_uuid uuid.UUID) (*UserFormUpdateResponse, *responses.ErrorResponse)
 	Update_Password(user_uuid uuid.UUID, usreq UserUpdatePasswordRequest) (*UserUpdatePasswordReponse, *responses.ErrorResponse)
 	GetUserBasicInfo(username string) (*UserBasicInfoResponse, *responses.ErrorResponse)
+	ChangeStatus(user_uuid uuid.UUID, usreq UserStatusRequest) (*UserResponse, *responses.ErrorResponse)
+	StatusHistory(user_uuid uuid.UUID) (*UserStatusResponse, *responses.ErrorResponse)
+	ReleaseExpiredSuspensions() (int64, error)
+	ChangeExpiredPassword(req PasswordChangeRequest) (*UserUpdatePasswordReponse, *responses.ErrorResponse)
 }
 
 type UserRepoImpl struct {
-	userCtx *types.UserContext
-	db      *sqlx.DB
+	userCtx   *types.UserContext
+	db        *sqlx.DB
+	passwords PasswordOptions
 }
 
-func NewUserRepoImpl(u *types.UserContext, db *sqlx.DB) *UserRepoImpl {
+func NewUserRepoImpl(u *types.UserContext, db *sqlx.DB, passwords PasswordOptions) *UserRepoImpl {
 	return &UserRepoImpl{
-		userCtx: u,
-		db:      db,
+		userCtx:   u,
+		db:        db,
+		passwords: passwords,
 	}
 }
 
@@ -54,16 +64,15 @@ func (u *UserRepoImpl) GetLoginSession(login_session string) (bool, *responses.E
 	return true, responses.NewErrorResponse("login_failed", smg_error)
 }
 
-// Test URL endpoint: {{ _.host }}/api/v1/admin/user?paging_options[page]=1&paging_options[per_page]=10&sorts[0][property]=u.id&sorts[0][direction]=desc&sorts[1][property]=u.user_name&sorts[1][direction]=desc&filters[0][property]=u.status_id&filters[0][value]=1
+// Test URL endpoint: {{ _.host }}/api/v1/user?paging_options[page]=1&paging_options[per_page]=10&sorts[0][property]=id&sorts[0][direction]=desc&sorts[1][property]=user_name&sorts[1][direction]=desc&filters[0][property]=status_id&filters[0][operator]=in&filters[0][value]=1,2&q=john
 func (u *UserRepoImpl) Show(userShowRequest UserShowRequest) (*UserResponse, *responses.ErrorResponse) {
-	perPage := userShowRequest.PageOptions.Perpage
-	page := userShowRequest.PageOptions.Page
-	offset := (page - 1) * perPage
+	paging := userShowRequest.PageOptions
+	perPage := paging.Perpage
 
-	sqlLimit := fmt.Sprintf(" LIMIT %d OFFSET %d", perPage, offset)
-	sqlOrderBy := postgres.BuildSQLSort(userShowRequest.Sorts)
-
-	sqlFilters, argsFilters := postgres.BuildSQLFilter(userShowRequest.Filters)
+	sqlFilters, argsFilters, err := userFields.BuildFilter(userShowRequest.Filters, 1)
+	if err != nil {
+		return nil, responses.NewErrorResponse("user_show_invalid_query", err)
+	}
 	fmt.Println("🚀 ~ file: repository.go ~ line 67 ~ func ~ sqlFilters : ", sqlFilters)
 	whereClause := "WHERE u.deleted_at IS NULL"
 
@@ -71,6 +80,56 @@ func (u *UserRepoImpl) Show(userShowRequest UserShowRequest) (*UserResponse, *re
 		whereClause += " AND " + sqlFilters
 	}
 
+	var sqlRank string
+	if userShowRequest.Query != "" {
+		sqlSearch, rank, argsSearch := userSearch.Build(userShowRequest.Query, len(argsFilters)+1)
+		whereClause += " AND " + sqlSearch
+		argsFilters = append(argsFilters, argsSearch...)
+		sqlRank = rank
+	}
+
+	// The page query adds the keyset condition, the count query keeps only the filters
+	pageWhereClause := whereClause
+	args := append([]interface{}{}, argsFilters...)
+
+	var sqlOrderBy, sqlLimit string
+	var keys []postgres.CursorKey
+	var cursor *postgres.Cursor
+	if paging.IsCursor() {
+		// A rank cannot be used as a keyset, in cursor mode a search only filters
+		keys, err = userFields.CursorKeys(userShowRequest.Sorts, postgres.CursorKey{Column: "u.id", Field: "id"})
+		if err != nil {
+			return nil, responses.NewErrorResponse("user_show_invalid_query", err)
+		}
+		if paging.Cursor != "" {
+			cursor, err = postgres.DecodeCursor(paging.Cursor, keys)
+			if err != nil {
+				return nil, responses.NewErrorResponse("user_show_invalid_query", err)
+			}
+		}
+
+		keysetFilter, keysetArgs := postgres.BuildKeysetFilter(keys, cursor, len(args)+1)
+		if keysetFilter != "" {
+			pageWhereClause += " AND " + keysetFilter
+			args = append(args, keysetArgs...)
+		}
+		sqlOrderBy = postgres.BuildKeysetOrder(keys, cursor != nil && cursor.Backward)
+		// One extra row tells whether there is a next page
+		sqlLimit = fmt.Sprintf(" LIMIT %d", perPage+1)
+	} else {
+		offset := (paging.Page - 1) * perPage
+		// Search results are ranked unless the client asks for another order
+		defaultOrder := "u.id"
+		if sqlRank != "" {
+			defaultOrder = sqlRank + " DESC, u.id"
+		}
+		sqlOrderBy, err = userFields.BuildSort(userShowRequest.Sorts, defaultOrder)
+		if err != nil {
+			return nil, responses.NewErrorResponse("user_show_invalid_query", err)
+		}
+		sqlLimit = fmt.Sprintf(" LIMIT %d OFFSET %d", perPage, offset)
+	}
+
 	// Construct SELECT query
 	query := fmt.Sprintf(`
 		SELECT 
@@ -89,7 +148,11 @@ func (u *UserRepoImpl) Show(userShowRequest UserShowRequest) (*UserResponse, *re
 			u.phone_number, 
 			u.user_avatar_id, 
 			u.commission, 
+			u.email_verified_at, 
+			u.phone_verified_at, 
 			u.status_id, 
+			u.suspended_until, 
+			u.row_version, 
 			u.order,            
 			u.created_by, 
 			creator.user_name AS creator, 
@@ -104,19 +167,32 @@ func (u *UserRepoImpl) Show(userShowRequest UserShowRequest) (*UserResponse, *re
 			tbl_users_roles ur ON u.role_id = ur.id
 		LEFT JOIN 
 			tbl_users creator ON u.created_by = creator.id
-		%s %s %s`, whereClause, sqlOrderBy, sqlLimit)
+		%s %s %s`, pageWhereClause, sqlOrderBy, sqlLimit)
 
 	fmt.Println("🚀 SQL Query:", query)
-	fmt.Println("🚀 Args:", argsFilters)
 
 	var users []User
-	err := u.db.Select(&users, query, argsFilters...)
+	err = u.db.Select(&users, query, args...)
 	if err != nil {
 		custom_log.NewCustomLog("user_show_failed", err.Error(), "error")
 
 		return nil, responses.NewErrorResponse("user_show_failed", fmt.Errorf("cannot select user: database error"))
 	}
 
+	var cursorPage *postgres.CursorPage
+	if paging.IsCursor() {
+		users, cursorPage, err = postgres.KeysetPage(users, perPage, keys, cursor)
+		if err != nil {
+			custom_log.NewCustomLog("user_show_failed", err.Error(), "error")
+
+			return nil, responses.NewErrorResponse("user_show_failed", fmt.Errorf("cannot build cursor"))
+		}
+	}
+
+	if !paging.CountTotal() {
+		return &UserResponse{Users: users, Cursor: cursorPage}, nil
+	}
+
 	// Count query for total records
 	countQuery := fmt.Sprintf(`
 		SELECT COUNT(*) as total
@@ -134,11 +210,42 @@ func (u *UserRepoImpl) Show(userShowRequest UserShowRequest) (*UserResponse, *re
 	}
 
 	return &UserResponse{
-		Users: users,
-		Total: totalCount,
+		Users:  users,
+		Total:  totalCount,
+		Cursor: cursorPage,
 	}, nil
 }
 
+// emit reads the committed user in the ShowOne shape, publishes it as a domain event and returns it
+func (u *UserRepoImpl) emit(name string, user_uuid uuid.UUID) (*UserResponse, *responses.ErrorResponse) {
+	users, err := u.ShowOne(user_uuid)
+	if err != nil {
+		return nil, err
+	}
+	events.Emit(name, eventPayload(users))
+	return users, nil
+}
+
+// EmitUpdated publishes user.updated for a change of the user made by another module, such as a
+// commission rate that took effect
+func EmitUpdated(db *sqlx.DB, user_uuid uuid.UUID) {
+	repo := NewUserRepoImpl(&types.UserContext{}, db, PasswordOptions{})
+	if _, err := repo.emit(events.UserUpdated, user_uuid); err != nil {
+		custom_log.NewCustomLog("user_event_failed", err.Err.Error(), "warn")
+	}
+}
+
+// eventPayload copies users without their login session, events reach other accounts and the
+// session would let them act as the user
+func eventPayload(users *UserResponse) *UserResponse {
+	payload := &UserResponse{Users: make([]User, len(users.Users))}
+	copy(payload.Users, users.Users)
+	for i := range payload.Users {
+		payload.Users[i].LoginSession = nil
+	}
+	return payload
+}
+
 func (u *UserRepoImpl) ShowOne(user_uuid uuid.UUID) (*UserResponse, *responses.ErrorResponse) {
 	query := `
 		SELECT 
@@ -157,7 +264,11 @@ func (u *UserRepoImpl) ShowOne(user_uuid uuid.UUID) (*UserResponse, *responses.E
 			u.phone_number, 
 			u.user_avatar_id, 
 			u.commission, 
+			u.email_verified_at, 
+			u.phone_verified_at, 
 			u.status_id, 
+			u.suspended_until, 
+			u.row_version, 
 			u.order,            
 			u.created_by, 
 			creator.user_name AS creator, 
@@ -225,11 +336,11 @@ func (u *UserRepoImpl) Create(usreq UserNewRequest) (*UserResponse, *responses.E
 	// }()
 
 	// Initialize user model - modify the New function to accept sqlx.Tx instead of Tarantool stream
-	err = userAddModel.New(usreq, u.userCtx, tx)
+	err = userAddModel.New(usreq, u.userCtx, u.passwords, tx)
 	if err != nil {
 		custom_log.NewCustomLog("user_create_failed", err.Error())
 
-		return nil, responses.NewErrorResponse("user_create_failed", err)
+		return nil, responses.NewErrorResponse(passwordErrorID(err, "user_create_failed"), err)
 	}
 
 	// Insert query
@@ -237,9 +348,9 @@ func (u *UserRepoImpl) Create(usreq UserNewRequest) (*UserResponse, *responses.E
 		INSERT INTO tbl_users (
 			id, user_uuid, first_name, last_name, user_name, profile_photo, user_alias, 
 			password, email, role_id, status, login_session, phone_number, commission, 
-			"order", created_by, created_at
+			"order", created_by, created_at, password_changed_at
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $17
 		)`
 
 	_, err = tx.Exec(query,
@@ -266,6 +377,14 @@ func (u *UserRepoImpl) Create(usreq UserNewRequest) (*UserResponse, *responses.E
 		custom_log.NewCustomLog("user_create_failed", err.Error(), "error")
 		return nil, responses.NewErrorResponse("user_create_failed", err)
 	}
+
+	// The first password starts the history
+	err = password_policy.Remember(tx, u.passwords.HistorySecret, userAddModel.ID, userAddModel.Password, userAddModel.PasswordHistory, userAddModel.CreatedAt)
+	if err != nil {
+		custom_log.NewCustomLog("user_create_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("user_create_failed", fmt.Errorf("cannot save password history"))
+	}
+
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
@@ -283,10 +402,10 @@ func (u *UserRepoImpl) Create(usreq UserNewRequest) (*UserResponse, *responses.E
 		// Audit failures are not critical, so we don't return an error
 	}
 
-	return u.ShowOne(userAddModel.UserUUID)
+	return u.emit(events.UserCreated, userAddModel.UserUUID)
 }
 
-func (u *UserRepoImpl) Update(user_uuid uuid.UUID, usreq UserUpdateRequest) (*UserResponse, *responses.ErrorResponse) {
+func (u *UserRepoImpl) Update(user_uuid uuid.UUID, usreq UserUpdateRequest, version int) (*UserResponse, *responses.ErrorResponse) {
 	userUpdateModel := &UserUpdateModel{}
 
 	// Begin transaction
@@ -305,6 +424,9 @@ func (u *UserRepoImpl) Update(user_uuid uuid.UUID, usreq UserUpdateRequest) (*Us
 
 	// Initialize user model - modify the New function to accept sqlx.Tx instead of Tarantool stream
 	err = userUpdateModel.New(user_uuid, usreq, u.userCtx, tx)
+	if errors.Is(err, errStatusChange) {
+		return nil, responses.NewErrorResponse("user_status_change_not_allowed", err)
+	}
 	if err != nil {
 		custom_log.NewCustomLog("user_update_failed", err.Error())
 
@@ -312,30 +434,33 @@ func (u *UserRepoImpl) Update(user_uuid uuid.UUID, usreq UserUpdateRequest) (*Us
 	}
 
 	// Update query - Using $1, $2, etc. for PostgreSQL
+	// A changed email or phone number has to be verified again
 	query := `
 		UPDATE tbl_users SET
 			first_name = $1, 
 			last_name = $2, 
 			email = $3,
 			role_id = $4, 
-			status_id = $5, 
-			phone_number = $6, 
-			commission = $7, 
-			updated_by = $8, 
-			updated_at = $9
-		WHERE user_uuid = $10`
-
-	_, err = tx.Exec(query,
+			phone_number = $5, 
+			email_verified_at = CASE WHEN email IS DISTINCT FROM $3 THEN NULL ELSE email_verified_at END, 
+			phone_verified_at = CASE WHEN phone_number IS DISTINCT FROM $5 THEN NULL ELSE phone_verified_at END, 
+			commission = $6, 
+			updated_by = $7, 
+			updated_at = $8,
+			row_version = row_version + 1
+		WHERE user_uuid = $9 AND row_version = $10`
+
+	result, err := tx.Exec(query,
 		userUpdateModel.FirstName,
 		userUpdateModel.LastName,
 		userUpdateModel.Email,
 		userUpdateModel.RoleId,
-		userUpdateModel.StatusId,
 		userUpdateModel.PhoneNumber,
 		userUpdateModel.Commission,
 		userUpdateModel.UpdatedBy,
 		userUpdateModel.UpdatedAt,
 		userUpdateModel.UserUUID,
+		version,
 	)
 
 	if err != nil {
@@ -344,6 +469,18 @@ func (u *UserRepoImpl) Update(user_uuid uuid.UUID, usreq UserUpdateRequest) (*Us
 		return nil, responses.NewErrorResponse("user_update_failed", fmt.Errorf("cannot execute update"))
 	}
 
+	// No row matched the expected version: someone else updated the user in the meantime
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		err = fmt.Errorf("user has been modified since version %d", version)
+		custom_log.NewCustomLog("user_version_conflict", err.Error(), "warn")
+
+		current, err_one := u.ShowOne(user_uuid)
+		if err_one != nil {
+			return nil, err_one
+		}
+		return current, responses.NewErrorResponse("user_version_conflict", err)
+	}
+
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
@@ -362,8 +499,123 @@ func (u *UserRepoImpl) Update(user_uuid uuid.UUID, usreq UserUpdateRequest) (*Us
 		// Audit failures are not critical, so we don't return an error
 	}
 
-	return u.ShowOne(userUpdateModel.UserUUID)
+	return u.emit(events.UserUpdated, userUpdateModel.UserUUID)
+}
+func (u *UserRepoImpl) Patch(user_uuid uuid.UUID, patch UserPatchRequest, version int) (*UserResponse, *responses.ErrorResponse) {
+	userPatchModel := &UserPatchModel{}
+
+	// Begin transaction
+	tx, err := u.db.BeginTxx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		custom_log.NewCustomLog("user_update_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_update_failed", fmt.Errorf("cannot begin transaction"))
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the row so the diff cannot be based on a stale read
+	var current User
+	err = tx.Get(&current, `
+		SELECT
+			id, user_uuid, first_name, last_name, user_name, email, role_id,
+			phone_number, commission, status_id, row_version
+		FROM tbl_users
+		WHERE user_uuid = $1 AND deleted_at IS NULL
+		FOR UPDATE`, user_uuid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, responses.NewErrorResponse("user_update_failed", fmt.Errorf("user uuid:`%s` not found", user_uuid))
+		}
+		custom_log.NewCustomLog("user_update_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_update_failed", fmt.Errorf("cannot select user: database error"))
+	}
+
+	if current.RowVersion != version {
+		err = fmt.Errorf("user has been modified since version %d", version)
+		custom_log.NewCustomLog("user_version_conflict", err.Error(), "warn")
+
+		tx.Rollback()
+		latest, err_one := u.ShowOne(user_uuid)
+		if err_one != nil {
+			return nil, err_one
+		}
+		return latest, responses.NewErrorResponse("user_version_conflict", err)
+	}
+
+	err = userPatchModel.New(&current, patch, u.userCtx, tx)
+	if errors.Is(err, errStatusChange) {
+		return nil, responses.NewErrorResponse("user_status_change_not_allowed", err)
+	}
+	if err != nil {
+		custom_log.NewCustomLog("user_update_failed", err.Error())
+
+		return nil, responses.NewErrorResponse("user_update_failed", err)
+	}
+
+	// Nothing changes, keep the version so the client's ETag stays valid
+	if len(userPatchModel.Changes) == 0 {
+		tx.Rollback()
+		return u.ShowOne(user_uuid)
+	}
+
+	// Only the changed columns are written, the column names come from UserPatchModel and never from the request
+	sets := make([]string, 0, len(userPatchModel.Changes)+5)
+	args := make([]interface{}, 0, len(userPatchModel.Changes)+4)
+	for _, change := range userPatchModel.Changes {
+		args = append(args, change.New)
+		sets = append(sets, fmt.Sprintf("%s = $%d", change.Column, len(args)))
+
+		// A changed email or phone number has to be verified again
+		switch change.Column {
+		case "email":
+			sets = append(sets, "email_verified_at = NULL")
+		case "phone_number":
+			sets = append(sets, "phone_verified_at = NULL")
+		}
+	}
+	args = append(args, userPatchModel.UpdatedBy, userPatchModel.UpdatedAt, userPatchModel.ID)
+	query := fmt.Sprintf(`
+		UPDATE tbl_users SET
+			%s,
+			updated_by = $%d,
+			updated_at = $%d,
+			row_version = row_version + 1
+		WHERE id = $%d`,
+		strings.Join(sets, ",\n\t\t\t"), len(args)-2, len(args)-1, len(args))
+
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		custom_log.NewCustomLog("user_update_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_update_failed", fmt.Errorf("cannot execute update"))
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		custom_log.NewCustomLog("user_update_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_update_failed", fmt.Errorf("cannot commit transaction"))
+	}
+
+	// Add Audit
+	_, err = utils.AddUserAuditLog(
+		int(userPatchModel.ID), "Patch User", userPatchModel.AuditDescription(), 1, u.userCtx.UserAgent,
+		u.userCtx.UserName, u.userCtx.Ip, int(userPatchModel.UpdatedBy), u.db)
+	if err != nil {
+		custom_log.NewCustomLog("user_update_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+
+	return u.emit(events.UserUpdated, userPatchModel.UserUUID)
 }
+
 func (u *UserRepoImpl) Delete(user_uuid uuid.UUID) (*UserDeleteResponse, *responses.ErrorResponse) {
 	// Check permission (admin can't delete users with equal or higher roles)
 	// if u.userCtx.RoleId != 1 {
@@ -442,7 +694,7 @@ func (u *UserRepoImpl) Delete(user_uuid uuid.UUID) (*UserDeleteResponse, *respon
 			updated_by = $4, 
 			updated_at = $5
 		WHERE user_uuid = $6`,
-		0, by_id, now, by_id, now, user_uuid)
+		types.StatusDeleted, by_id, now, by_id, now, user_uuid)
 
 	if err != nil {
 		custom_log.NewCustomLog("user_delete_failed", err.Error(), "error")
@@ -450,6 +702,16 @@ func (u *UserRepoImpl) Delete(user_uuid uuid.UUID) (*UserDeleteResponse, *respon
 		return nil, responses.NewErrorResponse("user_delete_failed", fmt.Errorf("cannot delete user"))
 	}
 
+	_, err = tx.Exec(`
+		INSERT INTO tbl_users_status_history (user_id, from_status_id, to_status_id, reason, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		users.Users[0].ID, users.Users[0].StatusId, types.StatusDeleted, "User deleted", by_id, now)
+	if err != nil {
+		custom_log.NewCustomLog("user_delete_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_delete_failed", fmt.Errorf("cannot record status history"))
+	}
+
 	// Update login session
 	login_session, _ := uuid.NewV7()
 	_, err = tx.Exec("UPDATE tbl_users SET login_session = $1 WHERE user_uuid = $2",
@@ -477,9 +739,188 @@ func (u *UserRepoImpl) Delete(user_uuid uuid.UUID) (*UserDeleteResponse, *respon
 		// Non-critical error, continue
 	}
 
+	// The user can no longer be shown, the event carries the row as it was before the delete
+	events.Emit(events.UserDeleted, eventPayload(users))
+	events.Emit(events.SessionInvalidated, events.Session{
+		Key:    fmt.Sprintf("user%d", users.Users[0].ID),
+		Reason: events.ReasonAccountDeleted,
+	})
+
 	return &UserDeleteResponse{Success: true}, nil
 }
 
+// ChangeStatus moves the user through the status state machine. Any status but active ends the
+// user's session.
+func (u *UserRepoImpl) ChangeStatus(user_uuid uuid.UUID, usreq UserStatusRequest) (*UserResponse, *responses.ErrorResponse) {
+	userStatusModel := &UserStatusModel{}
+
+	// Begin transaction
+	tx, err := u.db.BeginTxx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		custom_log.NewCustomLog("user_status_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_status_failed", fmt.Errorf("cannot begin transaction"))
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the row so two admins cannot race through the state machine
+	var current User
+	err = tx.Get(&current, `
+		SELECT id, user_uuid, user_name, role_id, status_id
+		FROM tbl_users
+		WHERE user_uuid = $1 AND deleted_at IS NULL
+		FOR UPDATE`, user_uuid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, responses.NewErrorResponse("user_status_failed", fmt.Errorf("user uuid:`%s` not found", user_uuid))
+		}
+		custom_log.NewCustomLog("user_status_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_status_failed", fmt.Errorf("cannot select user: database error"))
+	}
+
+	by_id, err := postgres.GetIdByUuid("tbl_users", "user_uuid", u.userCtx.UserUuid, tx)
+	if err != nil {
+		custom_log.NewCustomLog("user_status_failed", err.Error())
+
+		return nil, responses.NewErrorResponse("user_status_failed", fmt.Errorf("cannot get current user ID"))
+	}
+
+	err = userStatusModel.New(&current, usreq, u.userCtx, *by_id)
+	if err != nil {
+		custom_log.NewCustomLog("user_status_invalid_transition", err.Error(), "warn")
+
+		return nil, responses.NewErrorResponse("user_status_invalid_transition", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tbl_users SET
+			status_id = $1,
+			suspended_until = $2,
+			login_session = CASE WHEN $1 = $3 THEN login_session ELSE NULL END,
+			updated_by = $4,
+			updated_at = $5,
+			row_version = row_version + 1
+		WHERE id = $6`,
+		userStatusModel.ToStatusId, userStatusModel.SuspendedUntil, types.StatusActive,
+		userStatusModel.UpdatedBy, userStatusModel.UpdatedAt, userStatusModel.ID)
+	if err != nil {
+		custom_log.NewCustomLog("user_status_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_status_failed", fmt.Errorf("cannot update status"))
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO tbl_users_status_history (user_id, from_status_id, to_status_id, reason, suspended_until, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		userStatusModel.ID, userStatusModel.FromStatusId, userStatusModel.ToStatusId, userStatusModel.Reason,
+		userStatusModel.SuspendedUntil, userStatusModel.UpdatedBy, userStatusModel.UpdatedAt)
+	if err != nil {
+		custom_log.NewCustomLog("user_status_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_status_failed", fmt.Errorf("cannot record status history"))
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		custom_log.NewCustomLog("user_status_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_status_failed", fmt.Errorf("cannot commit transaction"))
+	}
+
+	// Add Audit
+	_, err = utils.AddUserAuditLog(
+		int(userStatusModel.ID), "Change User Status", userStatusModel.AuditDescription(), 1, u.userCtx.UserAgent,
+		u.userCtx.UserName, u.userCtx.Ip, int(userStatusModel.UpdatedBy), u.db)
+	if err != nil {
+		custom_log.NewCustomLog("user_status_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+
+	// Any status but active has cleared the session
+	if userStatusModel.ToStatusId != types.StatusActive {
+		reason := events.ReasonAccountInactive
+		if userStatusModel.ToStatusId == types.StatusSuspended {
+			reason = events.ReasonAccountSuspended
+		}
+		events.Emit(events.SessionInvalidated, events.Session{
+			Key:    fmt.Sprintf("user%d", userStatusModel.ID),
+			Reason: reason,
+		})
+	}
+
+	return u.emit(events.UserUpdated, user_uuid)
+}
+
+func (u *UserRepoImpl) StatusHistory(user_uuid uuid.UUID) (*UserStatusResponse, *responses.ErrorResponse) {
+	var current User
+	err := u.db.Get(&current, `
+		SELECT id, status_id, suspended_until
+		FROM tbl_users
+		WHERE user_uuid = $1 AND deleted_at IS NULL`, user_uuid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, responses.NewErrorResponse("user_status_history_failed", fmt.Errorf("user uuid:`%s` not found", user_uuid))
+		}
+		custom_log.NewCustomLog("user_status_history_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_status_history_failed", fmt.Errorf("cannot select user: database error"))
+	}
+
+	history := []UserStatusHistory{}
+	err = u.db.Select(&history, `
+		SELECT
+			h.id, h.from_status_id, h.to_status_id, h.reason, h.suspended_until,
+			h.created_by, creator.user_name AS creator, h.created_at
+		FROM tbl_users_status_history h
+		LEFT JOIN tbl_users creator ON h.created_by = creator.id
+		WHERE h.user_id = $1
+		ORDER BY h.created_at DESC, h.id DESC`, current.ID)
+	if err != nil {
+		custom_log.NewCustomLog("user_status_history_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_status_history_failed", fmt.Errorf("cannot select status history: database error"))
+	}
+
+	return &UserStatusResponse{
+		StatusId:       current.StatusId,
+		SuspendedUntil: current.SuspendedUntil,
+		History:        history,
+	}, nil
+}
+
+// ReleaseExpiredSuspensions reactivates the users whose suspension has ended and records the change
+func (u *UserRepoImpl) ReleaseExpiredSuspensions() (int64, error) {
+	location, err := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load location: %w", err)
+	}
+
+	result, err := u.db.Exec(`
+		WITH released AS (
+			UPDATE tbl_users SET
+				status_id = $1,
+				suspended_until = NULL,
+				updated_at = $3,
+				row_version = row_version + 1
+			WHERE status_id = $2 AND suspended_until <= $3 AND deleted_at IS NULL
+			RETURNING id
+		)
+		INSERT INTO tbl_users_status_history (user_id, from_status_id, to_status_id, reason, created_at)
+		SELECT id, $2, $1, 'Suspension expired', $3 FROM released`,
+		types.StatusActive, types.StatusSuspended, time.Now().In(location))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 func (u *UserRepoImpl) GetStatus() *[]types.Status {
 	return &types.StatusData
 }
@@ -584,6 +1025,7 @@ func (u *UserRepoImpl) GetUserFormUpdate(user_uuid uuid.UUID) (*UserFormUpdateRe
 			PhoneNumber: *users.Users[0].PhoneNumber,
 			StatusId:    uint64(users.Users[0].StatusId),
 			Commission:  users.Users[0].Commission,
+			RowVersion:  users.Users[0].RowVersion,
 			Status:      *status,
 			Roles:       *roles,
 		},
@@ -608,38 +1050,19 @@ func (u *UserRepoImpl) Update_Password(user_uuid uuid.UUID, usreq UserUpdatePass
 	}()
 
 	// Initialize password model
-	err = RequestChangePassword.New(user_uuid, usreq, u.userCtx, tx)
-	if err != nil {
-		custom_log.NewCustomLog("user_update_password_failed", err.Error())
-
-		return nil, responses.NewErrorResponse("user_update_password_failed", err)
-	}
-
-	// Get current user ID
-	var by_id int64
-	err = u.db.Get(&by_id, "SELECT id FROM tbl_users WHERE user_uuid = $1", u.userCtx.UserUuid)
+	err = RequestChangePassword.New(user_uuid, usreq, u.userCtx, u.passwords, tx)
 	if err != nil {
 		custom_log.NewCustomLog("user_update_password_failed", err.Error())
 
-		return nil, responses.NewErrorResponse("user_update_password_failed", fmt.Errorf("cannot get current user ID"))
+		return nil, responses.NewErrorResponse(passwordErrorID(err, "user_update_password_failed"), err)
 	}
 
-	// Get target user info
-	users, err_one := u.ShowOne(user_uuid)
-	if err_one != nil {
-		custom_log.NewCustomLog("user_update_password_failed", err_one.Err.Error(), "error")
-
-		return nil, responses.NewErrorResponse("user_update_password_failed", fmt.Errorf("user not found"))
-	} else if len(users.Users) <= 0 {
-		custom_log.NewCustomLog("user_update_password_failed", "Cannot get user info", "error")
-
-		return nil, responses.NewErrorResponse("user_update_password_failed", fmt.Errorf("user not found"))
-	}
-
-	// Update password
+	// Update password, the user has to log in again with it
 	_, err = tx.Exec(`
 		UPDATE tbl_users SET
 			password = $1, 
+			password_changed_at = $3,
+			login_session = NULL,
 			updated_by = $2, 
 			updated_at = $3
 		WHERE user_uuid = $4`,
@@ -654,6 +1077,13 @@ func (u *UserRepoImpl) Update_Password(user_uuid uuid.UUID, usreq UserUpdatePass
 		return nil, responses.NewErrorResponse("user_update_password_failed", fmt.Errorf("cannot update password"))
 	}
 
+	err = password_policy.Remember(tx, u.passwords.HistorySecret, RequestChangePassword.Target.ID, RequestChangePassword.Password, RequestChangePassword.Policy.History, RequestChangePassword.UpdatedAt)
+	if err != nil {
+		custom_log.NewCustomLog("user_update_password_failed", err.Error(), "error")
+
+		return nil, responses.NewErrorResponse("user_update_password_failed", fmt.Errorf("cannot save password history"))
+	}
+
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
@@ -663,15 +1093,21 @@ func (u *UserRepoImpl) Update_Password(user_uuid uuid.UUID, usreq UserUpdatePass
 	}
 
 	// Add Audit
-	var audit_des = fmt.Sprintf("Updating `%s %s`'s password has been successful", users.Users[0].FirstName, users.Users[0].LastName)
+	target := RequestChangePassword.Target
+	var audit_des = fmt.Sprintf("Updating `%s %s`'s password has been successful", target.FirstName, target.LastName)
 	_, err = utils.AddUserAuditLog(
-		int(users.Users[0].ID), "Update User's password", audit_des, 1, u.userCtx.UserAgent,
-		u.userCtx.UserName, u.userCtx.Ip, int(by_id), u.db)
+		int(target.ID), "Update User's password", audit_des, 1, u.userCtx.UserAgent,
+		u.userCtx.UserName, u.userCtx.Ip, int(RequestChangePassword.UpdatedBy), u.db)
 	if err != nil {
 		custom_log.NewCustomLog("user_update_password_failed", err.Error(), "warn")
 		// Non-critical error, continue
 	}
 
+	events.Emit(events.SessionInvalidated, events.Session{
+		Key:    fmt.Sprintf("user%d", target.ID),
+		Reason: events.ReasonPasswordChanged,
+	})
+
 	// // Add notification
 	// var notificationContext = "Password Update"
 	// var notificationSubject = "Password Changed"
@@ -688,6 +1124,75 @@ func (u *UserRepoImpl) Update_Password(user_uuid uuid.UUID, usreq UserUpdatePass
 
 	return &UserUpdatePasswordReponse{Success: true}, nil
 }
+
+// ChangeExpiredPassword replaces an expired password with the challenge token login has issued,
+// the user logs in again with the new password afterwards
+func (u *UserRepoImpl) ChangeExpiredPassword(req PasswordChangeRequest) (*UserUpdatePasswordReponse, *responses.ErrorResponse) {
+	var passwordChangeModel = &PasswordChangeModel{}
+
+	tx, err := u.db.BeginTxx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		custom_log.NewCustomLog("password_change_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("password_change_failed", fmt.Errorf("cannot begin transaction"))
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = passwordChangeModel.New(req, u.passwords, tx)
+	if err != nil {
+		custom_log.NewCustomLog("password_change_failed", err.Error(), "warn")
+		return nil, responses.NewErrorResponse(passwordErrorID(err, "password_change_failed"), err)
+	}
+
+	target := passwordChangeModel.Target
+	_, err = tx.Exec(`
+		UPDATE tbl_users SET
+			password = $1,
+			password_changed_at = $2,
+			login_session = NULL,
+			updated_by = $3,
+			updated_at = $2
+		WHERE id = $3`,
+		passwordChangeModel.Password,
+		passwordChangeModel.UpdatedAt,
+		target.ID)
+	if err != nil {
+		custom_log.NewCustomLog("password_change_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("password_change_failed", fmt.Errorf("cannot update password"))
+	}
+
+	err = password_policy.Remember(tx, u.passwords.HistorySecret, target.ID, passwordChangeModel.Password, passwordChangeModel.Policy.History, passwordChangeModel.UpdatedAt)
+	if err != nil {
+		custom_log.NewCustomLog("password_change_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("password_change_failed", fmt.Errorf("cannot save password history"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		custom_log.NewCustomLog("password_change_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("password_change_failed", fmt.Errorf("cannot commit transaction"))
+	}
+
+	var audit_des = fmt.Sprintf("Expired password of `%s %s` has been changed", target.FirstName, target.LastName)
+	_, err = utils.AddUserAuditLog(
+		int(target.ID), "Change Expired Password", audit_des, 1, u.userCtx.UserAgent,
+		target.UserName, u.userCtx.Ip, int(target.ID), u.db)
+	if err != nil {
+		custom_log.NewCustomLog("password_change_failed", err.Error(), "warn")
+	}
+
+	events.Emit(events.SessionInvalidated, events.Session{
+		Key:    fmt.Sprintf("user%d", target.ID),
+		Reason: events.ReasonPasswordChanged,
+	})
+
+	return &UserUpdatePasswordReponse{Success: true}, nil
+}
+
 func (u *UserRepoImpl) GetUserBasicInfo(username string) (*UserBasicInfoResponse, *responses.ErrorResponse) {
 	var userInfo UserInfo
 
@@ -1,6 +1,11 @@
 package user
 
 import (
+	"log"
+
+	config "snack-shop/config"
+	password_policy "snack-shop/pkg/password"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/jmoiron/sqlx"
 )
@@ -13,7 +18,18 @@ type UserRoute struct {
 }
 
 func NewUserRoute(app *fiber.App, db *sqlx.DB) *UserRoute {
-	handler := NewHandler(db)
+	password_config := config.InitPassword()
+	common, err := password_policy.LoadCommonList(password_config.CommonListFile)
+	if err != nil {
+		log.Fatalf("Error loading common password list %v", err)
+	}
+	options := PasswordOptions{
+		HistorySecret:   password_config.HistorySecret,
+		ChallengeSecret: password_config.ChallengeSecret,
+		Common:          common,
+	}
+
+	handler := NewHandler(db, options)
 	return &UserRoute{
 		app:     app,
 		db:      db,
@@ -21,6 +37,13 @@ func NewUserRoute(app *fiber.App, db *sqlx.DB) *UserRoute {
 	}
 }
 
+// RegisterPublicRoute mounts the routes reachable without a token, it must be registered before the JWT middleware
+func (u *UserRoute) RegisterPublicRoute() *UserRoute {
+	u.app.Post("/api/v1/auth/password/change", u.handler.ChangeExpiredPassword)
+
+	return u
+}
+
 func (u *UserRoute) RegisterUserRoute() *UserRoute {
 	v1 := u.app.Group("/api/v1/")
 	user := v1.Group("/user")
@@ -30,7 +53,10 @@ func (u *UserRoute) RegisterUserRoute() *UserRoute {
 	user.Get("/:id", u.handler.ShowOne)
 	user.Post("/", u.handler.Create)
 	user.Put("/:id", u.handler.Update)
+	user.Patch("/:id", u.handler.Patch)
 	user.Delete("/:id", u.handler.Delete)
+	user.Put("/:id/status", u.handler.ChangeStatus)
+	user.Get("/:id/status", u.handler.StatusHistory)
 	user.Get("/form/create", u.handler.GetUserFormCreate)
 	user.Get("/form/update/:id", u.handler.GetUserFormUpdate)
 	user.Put("/change/password/:id", u.handler.Update_Password)
@@ -14,12 +14,16 @@ type UserCreator interface {
 	Show(userShowRequest UserShowRequest) (*UserResponse, *responses.ErrorResponse)
 	ShowOne(user_uuid uuid.UUID) (*UserResponse, *responses.ErrorResponse)
 	Create(usreq UserNewRequest) (*UserResponse, *responses.ErrorResponse)
-	Update(user_uuid uuid.UUID, usreq UserUpdateRequest) (*UserResponse, *responses.ErrorResponse)
+	Update(user_uuid uuid.UUID, usreq UserUpdateRequest, version int) (*UserResponse, *responses.ErrorResponse)
+	Patch(user_uuid uuid.UUID, patch UserPatchRequest, version int) (*UserResponse, *responses.ErrorResponse)
 	Delete(user_uuid uuid.UUID) (*UserDeleteResponse, *responses.ErrorResponse)
 	GetUserFormCreate() (*UserFormCreateResponse, *responses.ErrorResponse)
 	GetUserFormUpdate(user_uuid uuid.UUID) (*UserFormUpdateResponse, *responses.ErrorResponse)
 	Update_Password(user_uuid uuid.UUID, usreq UserUpdatePasswordRequest) (*UserUpdatePasswordReponse, *responses.ErrorResponse)
 	GetUserBasicInfo() (*UserBasicInfoResponse, *responses.ErrorResponse)
+	ChangeStatus(user_uuid uuid.UUID, usreq UserStatusRequest) (*UserResponse, *responses.ErrorResponse)
+	StatusHistory(user_uuid uuid.UUID) (*UserStatusResponse, *responses.ErrorResponse)
+	ChangeExpiredPassword(req PasswordChangeRequest) (*UserUpdatePasswordReponse, *responses.ErrorResponse)
 }
 
 type UserService struct {
@@ -28,10 +32,10 @@ type UserService struct {
 	userRepo UserRepo
 }
 
-func NewUserService(u *types.UserContext, db *sqlx.DB) *UserService {
+func NewUserService(u *types.UserContext, db *sqlx.DB, passwords PasswordOptions) *UserService {
 	// pretty, _ := json.MarshalIndent(u, "", "  ")
 
-	r := NewUserRepoImpl(u, db)
+	r := NewUserRepoImpl(u, db, passwords)
 
 	return &UserService{
 		userCtx:  u,
@@ -76,12 +80,17 @@ func (u *UserService) Create(usreq UserNewRequest) (*UserResponse, *responses.Er
 	return success, err
 }
 
-func (u *UserService) Update(id uuid.UUID, usreq UserUpdateRequest) (*UserResponse, *responses.ErrorResponse) {
+func (u *UserService) Update(id uuid.UUID, usreq UserUpdateRequest, version int) (*UserResponse, *responses.ErrorResponse) {
 
-	success, err := u.userRepo.Update(id, usreq)
-	if err != nil {
-		return nil, err
-	}
+	// On a version conflict the repository returns the current representation together with the error
+	success, err := u.userRepo.Update(id, usreq, version)
+	return success, err
+}
+
+func (u *UserService) Patch(id uuid.UUID, patch UserPatchRequest, version int) (*UserResponse, *responses.ErrorResponse) {
+
+	// On a version conflict the repository returns the current representation together with the error
+	success, err := u.userRepo.Patch(id, patch, version)
 	return success, err
 }
 
@@ -119,3 +128,15 @@ func (u *UserService) GetUserBasicInfo() (*UserBasicInfoResponse, *responses.Err
 	}
 	return success, nil
 }
+
+func (u *UserService) ChangeStatus(id uuid.UUID, usreq UserStatusRequest) (*UserResponse, *responses.ErrorResponse) {
+	return u.userRepo.ChangeStatus(id, usreq)
+}
+
+func (u *UserService) StatusHistory(id uuid.UUID) (*UserStatusResponse, *responses.ErrorResponse) {
+	return u.userRepo.StatusHistory(id)
+}
+
+func (u *UserService) ChangeExpiredPassword(req PasswordChangeRequest) (*UserUpdatePasswordReponse, *responses.ErrorResponse) {
+	return u.userRepo.ChangeExpiredPassword(req)
+}
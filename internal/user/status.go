@@ -0,0 +1,172 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// statusTransitions are the status changes PUT /user/:id/status allows. Deleted is only reached
+// through DELETE and is final.
+var statusTransitions = map[int][]int{
+	types.StatusActive:    {types.StatusInactive, types.StatusSuspended},
+	types.StatusInactive:  {types.StatusActive, types.StatusSuspended},
+	types.StatusSuspended: {types.StatusActive, types.StatusInactive},
+}
+
+var errStatusChange = errors.New("status can only be changed through PUT /user/:id/status with a reason")
+
+func canTransition(from int, to int) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func statusName(id int) string {
+	for _, status := range types.StatusData {
+		if status.Id == id {
+			return status.StatusName
+		}
+	}
+	return fmt.Sprintf("#%d", id)
+}
+
+type UserStatusRequest struct {
+	StatusId       int     `json:"status_id" validate:"required,oneof=1 2 3"`
+	Reason         string  `json:"reason" validate:"required,max=255"`
+	SuspendedUntil *string `json:"suspended_until" validate:"omitnil,datetime=2006-01-02T15:04:05"`
+}
+
+func (r *UserStatusRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.Reason = strings.TrimSpace(r.Reason)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	if r.SuspendedUntil != nil && r.StatusId != types.StatusSuspended {
+		return fmt.Errorf("suspended_until is only allowed for a suspension")
+	}
+	return nil
+}
+
+// UserStatusModel is a validated status change of a locked user row
+type UserStatusModel struct {
+	ID             uint64
+	UserName       string
+	FromStatusId   int
+	ToStatusId     int
+	Reason         string
+	SuspendedUntil *time.Time
+	UpdatedBy      uint64
+	UpdatedAt      time.Time
+}
+
+func (u *UserStatusModel) New(current *User, usreq UserStatusRequest, usctx *types.UserContext, by_id int) error {
+	// check permission
+	if current.UserName == usctx.UserName {
+		return fmt.Errorf("you cannot change the status of your own account")
+	}
+	if usctx.RoleId > uint64(current.RoleId) {
+		return fmt.Errorf("permission denied : you can't change the status of a user that have bigger role than you")
+	}
+	if !canTransition(current.StatusId, usreq.StatusId) {
+		return fmt.Errorf("status cannot change from %s to %s", statusName(current.StatusId), statusName(usreq.StatusId))
+	}
+
+	//Get current OS time
+	app_timezone := os.Getenv("APP_TIMEZONE")
+	location, err := time.LoadLocation(app_timezone)
+	if err != nil {
+		return fmt.Errorf("failed to load location: %w", err)
+	}
+	local_now := time.Now().In(location)
+
+	// Timestamps are stored as local wall clock
+	if usreq.SuspendedUntil != nil {
+		until, err := time.ParseInLocation("2006-01-02T15:04:05", *usreq.SuspendedUntil, location)
+		if err != nil {
+			return fmt.Errorf("invalid suspended_until")
+		}
+		if !until.After(local_now) {
+			return fmt.Errorf("suspended_until must be in the future")
+		}
+		u.SuspendedUntil = &until
+	}
+
+	u.ID = current.ID
+	u.UserName = current.UserName
+	u.FromStatusId = current.StatusId
+	u.ToStatusId = usreq.StatusId
+	u.Reason = usreq.Reason
+	u.UpdatedBy = uint64(by_id)
+	u.UpdatedAt = local_now
+	return nil
+}
+
+func (u *UserStatusModel) AuditDescription() string {
+	desc := fmt.Sprintf("Status of user `%s` has changed from %s to %s: %s",
+		u.UserName, statusName(u.FromStatusId), statusName(u.ToStatusId), u.Reason)
+	if u.SuspendedUntil != nil {
+		desc += fmt.Sprintf(" (until %s)", u.SuspendedUntil.Format("2006-01-02 15:04:05"))
+	}
+	return desc
+}
+
+type UserStatusHistory struct {
+	ID             uint64     `json:"id" db:"id"`
+	FromStatusId   int        `json:"from_status_id" db:"from_status_id"`
+	ToStatusId     int        `json:"to_status_id" db:"to_status_id"`
+	Reason         string     `json:"reason" db:"reason"`
+	SuspendedUntil *time.Time `json:"suspended_until" db:"suspended_until"`
+	CreatedBy      *int       `json:"created_by" db:"created_by"`
+	Creator        *string    `json:"creator" db:"creator"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+type UserStatusResponse struct {
+	StatusId       int                 `json:"status_id"`
+	SuspendedUntil *time.Time          `json:"suspended_until"`
+	History        []UserStatusHistory `json:"history"`
+}
+
+// StartSuspensionExpiry reactivates expired suspensions every interval until ctx is done, wg is done
+// once a running pass finished
+func (u *UserRoute) StartSuspensionExpiry(ctx context.Context, wg *sync.WaitGroup, interval time.Duration) *UserRoute {
+	repo := NewUserRepoImpl(&types.UserContext{}, u.db, PasswordOptions{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				released, err := repo.ReleaseExpiredSuspensions()
+				if err != nil {
+					custom_log.NewCustomLog("user_suspension_expiry_failed", err.Error(), "error")
+				} else if released > 0 {
+					custom_log.NewCustomLog("user_suspension_expired", fmt.Sprintf("%d suspended users have been reactivated", released), "info")
+				}
+			}
+		}
+	}()
+	return u
+}
@@ -0,0 +1,175 @@
+package verification
+
+import (
+	"net/http"
+
+	"snack-shop/pkg/constants"
+	response "snack-shop/pkg/http/response"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/notifier"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// VerificationHandler struct
+type VerificationHandler struct {
+	db                  *sqlx.DB
+	verificationService func(*fiber.Ctx) VerificationCreator
+}
+
+func NewHandler(db *sqlx.DB, n notifier.Notifier, options VerificationOptions) *VerificationHandler {
+	return &VerificationHandler{
+		db: db,
+		verificationService: func(c *fiber.Ctx) VerificationCreator {
+			// Public routes run before the JWT middleware, fall back to the request metadata
+			uCtx, ok := c.Locals("UserContext").(types.UserContext)
+			if !ok {
+				uCtx = types.UserContext{
+					UserAgent: c.Get("User-Agent", "unknown"),
+					Ip:        c.IP(),
+				}
+			}
+
+			return NewVerificationService(&uCtx, db, n, options)
+		},
+	}
+}
+
+func (h *VerificationHandler) SendEmail(c *fiber.Ctx) error {
+	user_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("verification_send_failed", nil, c),
+			constants.VerificationSendFailed,
+			err_uuid,
+		))
+	}
+
+	sent, err := h.verificationService(c).SendEmail(user_uuid)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.VerificationSendFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("verification_send_success", nil, c),
+		constants.VerificationSendSuccess,
+		sent,
+	))
+}
+
+func (h *VerificationHandler) SendPhone(c *fiber.Ctx) error {
+	user_uuid, err_uuid := uuid.Parse(c.Params("id", ""))
+	if err_uuid != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("verification_send_failed", nil, c),
+			constants.VerificationSendFailed,
+			err_uuid,
+		))
+	}
+
+	sent, err := h.verificationService(c).SendPhone(user_uuid)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.VerificationSendFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("verification_send_success", nil, c),
+		constants.VerificationSendSuccess,
+		sent,
+	))
+}
+
+func (h *VerificationHandler) SendWithCredentials(c *fiber.Ctx) error {
+	var verificationSendRequest VerificationSendRequest
+
+	v := utils.NewValidator()
+	if err := verificationSendRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			utils.Translate("verification_send_failed", nil, c),
+			constants.VerificationSendFailed,
+			err,
+		))
+	}
+
+	sent, err := h.verificationService(c).SendWithCredentials(verificationSendRequest)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.VerificationSendFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("verification_send_success", nil, c),
+		constants.VerificationSendSuccess,
+		sent,
+	))
+}
+
+func (h *VerificationHandler) ConfirmEmail(c *fiber.Ctx) error {
+	var emailConfirmRequest EmailConfirmRequest
+
+	v := utils.NewValidator()
+	if err := emailConfirmRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			utils.Translate("verification_token_invalid", nil, c),
+			constants.VerificationConfirmFailed,
+			err,
+		))
+	}
+
+	verified, err := h.verificationService(c).ConfirmEmail(emailConfirmRequest)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.VerificationConfirmFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("verification_success", nil, c),
+		constants.VerificationConfirmSuccess,
+		verified,
+	))
+}
+
+func (h *VerificationHandler) ConfirmPhone(c *fiber.Ctx) error {
+	var phoneConfirmRequest PhoneConfirmRequest
+
+	v := utils.NewValidator()
+	if err := phoneConfirmRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			utils.Translate("verification_code_invalid", nil, c),
+			constants.VerificationConfirmFailed,
+			err,
+		))
+	}
+
+	verified, err := h.verificationService(c).ConfirmPhone(phoneConfirmRequest)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate(err.MessageID, nil, c),
+			constants.VerificationConfirmFailed,
+			err.Err,
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("verification_success", nil, c),
+		constants.VerificationConfirmSuccess,
+		verified,
+	))
+}
@@ -0,0 +1,133 @@
+package verification
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelPhone = "phone"
+)
+
+type VerificationOptions struct {
+	Secret         string
+	EmailLinkUrl   string
+	EmailExpire    time.Duration
+	OtpExpire      time.Duration
+	OtpMaxAttempts int
+	ResendCooldown time.Duration
+}
+
+// VerificationTarget is the account whose contact details are being verified
+type VerificationTarget struct {
+	ID              uint64     `db:"id"`
+	UserUUID        uuid.UUID  `db:"user_uuid"`
+	UserName        string     `db:"user_name"`
+	RoleId          int        `db:"role_id"`
+	Email           string     `db:"email"`
+	PhoneNumber     *string    `db:"phone_number"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	PhoneVerifiedAt *time.Time `db:"phone_verified_at"`
+}
+
+type Otp struct {
+	ID         uint64     `db:"id"`
+	UserID     uint64     `db:"user_id"`
+	Target     string     `db:"target"`
+	CodeHash   string     `db:"code_hash"`
+	Attempts   int        `db:"attempts"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	ConsumedAt *time.Time `db:"consumed_at"`
+	Expired    bool       `db:"expired"`
+	InCooldown bool       `db:"in_cooldown"`
+}
+
+// VerificationSendRequest lets an account that is blocked at login request a new link or code
+type VerificationSendRequest struct {
+	UserName string `json:"user_name" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	Channel  string `json:"channel" validate:"required,oneof=email phone"`
+}
+
+func (r *VerificationSendRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.UserName = strings.TrimSpace(r.UserName)
+	r.Channel = strings.TrimSpace(r.Channel)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type PhoneConfirmRequest struct {
+	UserName string `json:"user_name" validate:"required"`
+	Code     string `json:"code" validate:"required,len=6,numeric"`
+}
+
+func (r *PhoneConfirmRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.UserName = strings.TrimSpace(r.UserName)
+	r.Code = strings.TrimSpace(r.Code)
+
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+type EmailConfirmRequest struct {
+	Token string `query:"token" validate:"required"`
+}
+
+func (r *EmailConfirmRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.QueryParser(r); err != nil {
+		return err
+	}
+	if err := v.Validate(r); err != nil {
+		return err
+	}
+	if strings.Count(r.Token, ".") != 1 {
+		return fmt.Errorf("malformed verification token")
+	}
+	return nil
+}
+
+type VerificationSendResponse struct {
+	Channel   string    `json:"channel"`
+	Target    string    `json:"target"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type VerificationResponse struct {
+	Success    bool      `json:"success"`
+	Channel    string    `json:"channel"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// maskTarget hides most of an email address or phone number before it is echoed back
+func maskTarget(channel string, target string) string {
+	if channel == ChannelEmail {
+		at := strings.Index(target, "@")
+		if at <= 1 {
+			return target
+		}
+		return target[:1] + strings.Repeat("*", at-1) + target[at:]
+	}
+	if len(target) <= 3 {
+		return target
+	}
+	return strings.Repeat("*", len(target)-3) + target[len(target)-3:]
+}
@@ -0,0 +1,264 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/responses"
+	utils "snack-shop/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type VerificationRepo interface {
+	GetTargetByUuid(user_uuid uuid.UUID) (*VerificationTarget, *responses.ErrorResponse)
+	GetTargetByUserName(username string) (*VerificationTarget, *responses.ErrorResponse)
+	GetTargetByCredentials(username string, password string) (*VerificationTarget, *responses.ErrorResponse)
+	GetLatestOtp(userID uint64, cooldown time.Duration) (*Otp, *responses.ErrorResponse)
+	CreateOtp(userID uint64, target string, codeHash string, ttl time.Duration) *responses.ErrorResponse
+	ClaimOtpAttempt(otpID uint64, maxAttempts int) (bool, *responses.ErrorResponse)
+	ConfirmPhone(target *VerificationTarget, otp *Otp) (*time.Time, *responses.ErrorResponse)
+	ConfirmEmail(target *VerificationTarget, email string) (*time.Time, *responses.ErrorResponse)
+}
+
+type VerificationRepoImpl struct {
+	userCtx *types.UserContext
+	db      *sqlx.DB
+}
+
+func NewVerificationRepoImpl(u *types.UserContext, db *sqlx.DB) *VerificationRepoImpl {
+	return &VerificationRepoImpl{
+		userCtx: u,
+		db:      db,
+	}
+}
+
+const targetSelect = `
+	SELECT
+		id, user_uuid, user_name, role_id, email, phone_number,
+		email_verified_at, phone_verified_at
+	FROM tbl_users`
+
+func (v *VerificationRepoImpl) GetTargetByUuid(user_uuid uuid.UUID) (*VerificationTarget, *responses.ErrorResponse) {
+	var target VerificationTarget
+	err := v.db.Get(&target, targetSelect+` WHERE user_uuid = $1 AND deleted_at IS NULL`, user_uuid)
+	if err != nil {
+		return nil, v.targetError(err)
+	}
+	return &target, nil
+}
+
+func (v *VerificationRepoImpl) GetTargetByUserName(username string) (*VerificationTarget, *responses.ErrorResponse) {
+	var target VerificationTarget
+	err := v.db.Get(&target, targetSelect+` WHERE user_name = $1 AND deleted_at IS NULL`, username)
+	if err != nil {
+		return nil, v.targetError(err)
+	}
+	return &target, nil
+}
+
+func (v *VerificationRepoImpl) GetTargetByCredentials(username string, password string) (*VerificationTarget, *responses.ErrorResponse) {
+	var target VerificationTarget
+	err := v.db.Get(&target, targetSelect+` WHERE user_name = $1 AND password = $2 AND deleted_at IS NULL`, username, password)
+	if err != nil {
+		return nil, v.targetError(err)
+	}
+	return &target, nil
+}
+
+func (v *VerificationRepoImpl) targetError(err error) *responses.ErrorResponse {
+	if errors.Is(err, sql.ErrNoRows) {
+		return responses.NewErrorResponse("member_not_found", fmt.Errorf("user not found. Please check the provided information"))
+	}
+	custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+	return responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot select user: database error"))
+}
+
+func (v *VerificationRepoImpl) GetLatestOtp(userID uint64, cooldown time.Duration) (*Otp, *responses.ErrorResponse) {
+	now, err := localNow()
+	if err != nil {
+		return nil, responses.NewErrorResponse("verification_failed", err)
+	}
+
+	// Timestamps are stored as local wall clock time, so compare them in SQL against the local now
+	var otp Otp
+	err = v.db.Get(&otp, `
+		SELECT
+			id, user_id, target, code_hash, attempts, expires_at, created_at, consumed_at,
+			expires_at < $3 AS expired,
+			created_at > $4 AS in_cooldown
+		FROM tbl_users_verifications
+		WHERE user_id = $1 AND channel = $2
+		ORDER BY created_at DESC
+		LIMIT 1`, userID, ChannelPhone, now, now.Add(-cooldown))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot select verification code: database error"))
+	}
+	return &otp, nil
+}
+
+func (v *VerificationRepoImpl) CreateOtp(userID uint64, target string, codeHash string, ttl time.Duration) *responses.ErrorResponse {
+	now, err := localNow()
+	if err != nil {
+		return responses.NewErrorResponse("verification_send_failed", err)
+	}
+
+	tx, err := v.db.BeginTxx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		custom_log.NewCustomLog("verification_send_failed", err.Error(), "error")
+		return responses.NewErrorResponse("verification_send_failed", fmt.Errorf("cannot begin transaction"))
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Only the most recent code is valid
+	_, err = tx.Exec(`
+		UPDATE tbl_users_verifications SET consumed_at = $1
+		WHERE user_id = $2 AND channel = $3 AND consumed_at IS NULL`,
+		now, userID, ChannelPhone)
+	if err != nil {
+		custom_log.NewCustomLog("verification_send_failed", err.Error(), "error")
+		return responses.NewErrorResponse("verification_send_failed", fmt.Errorf("cannot revoke previous codes"))
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO tbl_users_verifications (
+			user_id, channel, target, code_hash, attempts, expires_at, created_at
+		) VALUES ($1, $2, $3, $4, 0, $5, $6)`,
+		userID, ChannelPhone, target, codeHash, now.Add(ttl), now)
+	if err != nil {
+		custom_log.NewCustomLog("verification_send_failed", err.Error(), "error")
+		return responses.NewErrorResponse("verification_send_failed", fmt.Errorf("cannot store verification code"))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		custom_log.NewCustomLog("verification_send_failed", err.Error(), "error")
+		return responses.NewErrorResponse("verification_send_failed", fmt.Errorf("cannot commit transaction"))
+	}
+	return nil
+}
+
+// ClaimOtpAttempt counts an attempt against the code before it is compared. The check and the
+// increment are one statement, so parallel requests cannot exceed maxAttempts. It reports false
+// once the attempts are used up or the code was consumed.
+func (v *VerificationRepoImpl) ClaimOtpAttempt(otpID uint64, maxAttempts int) (bool, *responses.ErrorResponse) {
+	var attempts int
+	err := v.db.Get(&attempts, `
+		UPDATE tbl_users_verifications SET attempts = attempts + 1
+		WHERE id = $1 AND attempts < $2 AND consumed_at IS NULL
+		RETURNING attempts`, otpID, maxAttempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+		return false, responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot update verification code"))
+	}
+	return true, nil
+}
+
+func (v *VerificationRepoImpl) ConfirmPhone(target *VerificationTarget, otp *Otp) (*time.Time, *responses.ErrorResponse) {
+	now, err := localNow()
+	if err != nil {
+		return nil, responses.NewErrorResponse("verification_failed", err)
+	}
+
+	tx, err := v.db.BeginTxx(context.Background(), &sql.TxOptions{})
+	if err != nil {
+		custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot begin transaction"))
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(`UPDATE tbl_users_verifications SET consumed_at = $1 WHERE id = $2`, now, otp.ID)
+	if err != nil {
+		custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot consume verification code"))
+	}
+
+	// The number is part of the WHERE clause so a code sent to an old number cannot verify a new one
+	result, err := tx.Exec(`
+		UPDATE tbl_users SET phone_verified_at = $1, row_version = row_version + 1
+		WHERE id = $2 AND phone_number = $3 AND deleted_at IS NULL`,
+		now, target.ID, otp.Target)
+	if err != nil {
+		custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot verify phone number"))
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		err = fmt.Errorf("phone number has changed since the code was sent")
+		return nil, responses.NewErrorResponse("verification_failed", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot commit transaction"))
+	}
+
+	v.audit(target, "Verify Phone", fmt.Sprintf("User `%s` has verified the phone number", target.UserName))
+	return &now, nil
+}
+
+func (v *VerificationRepoImpl) ConfirmEmail(target *VerificationTarget, email string) (*time.Time, *responses.ErrorResponse) {
+	now, err := localNow()
+	if err != nil {
+		return nil, responses.NewErrorResponse("verification_failed", err)
+	}
+
+	// The address is part of the WHERE clause so a link for an old address cannot verify a new one
+	result, err := v.db.Exec(`
+		UPDATE tbl_users SET email_verified_at = $1, row_version = row_version + 1
+		WHERE id = $2 AND email = $3 AND deleted_at IS NULL`,
+		now, target.ID, email)
+	if err != nil {
+		custom_log.NewCustomLog("verification_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_failed", fmt.Errorf("cannot verify email"))
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, responses.NewErrorResponse("verification_failed", fmt.Errorf("email address has changed since the link was sent"))
+	}
+
+	v.audit(target, "Verify Email", fmt.Sprintf("User `%s` has verified the email address", target.UserName))
+	return &now, nil
+}
+
+func (v *VerificationRepoImpl) audit(target *VerificationTarget, auditContext string, auditDesc string) {
+	_, err := utils.AddUserAuditLog(
+		int(target.ID), auditContext, auditDesc, 1, v.userCtx.UserAgent,
+		target.UserName, v.userCtx.Ip, int(target.ID), v.db)
+	if err != nil {
+		custom_log.NewCustomLog("verification_audit_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+}
+
+func localNow() (time.Time, error) {
+	app_timezone := os.Getenv("APP_TIMEZONE")
+	location, err := time.LoadLocation(app_timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load location: %w", err)
+	}
+	return time.Now().In(location), nil
+}
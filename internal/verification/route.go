@@ -0,0 +1,54 @@
+package verification
+
+import (
+	"time"
+
+	config "snack-shop/config"
+	"snack-shop/pkg/notifier"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+)
+
+// VerificationRoute struct
+type VerificationRoute struct {
+	app     *fiber.App
+	db      *sqlx.DB
+	handler *VerificationHandler
+}
+
+func NewVerificationRoute(app *fiber.App, db *sqlx.DB, n notifier.Notifier) *VerificationRoute {
+	verification_config := config.InitVerification()
+	options := VerificationOptions{
+		Secret:         verification_config.Secret,
+		EmailLinkUrl:   verification_config.EmailLinkUrl,
+		EmailExpire:    time.Duration(verification_config.EmailExpire) * time.Minute,
+		OtpExpire:      time.Duration(verification_config.OtpExpire) * time.Second,
+		OtpMaxAttempts: verification_config.OtpMaxAttempts,
+		ResendCooldown: time.Duration(verification_config.ResendCooldown) * time.Second,
+	}
+
+	return &VerificationRoute{
+		app:     app,
+		db:      db,
+		handler: NewHandler(db, n, options),
+	}
+}
+
+// RegisterPublicRoute mounts the routes reachable without a token, it must be registered before the JWT middleware
+func (v *VerificationRoute) RegisterPublicRoute() *VerificationRoute {
+	verify := v.app.Group("/api/v1/auth/verify")
+	verify.Post("/send", v.handler.SendWithCredentials)
+	verify.Get("/email", v.handler.ConfirmEmail)
+	verify.Post("/phone", v.handler.ConfirmPhone)
+
+	return v
+}
+
+func (v *VerificationRoute) RegisterVerificationRoute() *VerificationRoute {
+	v1 := v.app.Group("/api/v1/")
+	v1.Post("/user/:id/verify/email", v.handler.SendEmail)
+	v1.Post("/user/:id/verify/phone", v.handler.SendPhone)
+
+	return v
+}
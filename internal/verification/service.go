@@ -0,0 +1,201 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/notifier"
+	"snack-shop/pkg/responses"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type VerificationCreator interface {
+	SendEmail(user_uuid uuid.UUID) (*VerificationSendResponse, *responses.ErrorResponse)
+	SendPhone(user_uuid uuid.UUID) (*VerificationSendResponse, *responses.ErrorResponse)
+	SendWithCredentials(req VerificationSendRequest) (*VerificationSendResponse, *responses.ErrorResponse)
+	ConfirmEmail(req EmailConfirmRequest) (*VerificationResponse, *responses.ErrorResponse)
+	ConfirmPhone(req PhoneConfirmRequest) (*VerificationResponse, *responses.ErrorResponse)
+}
+
+type VerificationService struct {
+	userCtx          *types.UserContext
+	verificationRepo VerificationRepo
+	notifier         notifier.Notifier
+	options          VerificationOptions
+}
+
+func NewVerificationService(u *types.UserContext, db *sqlx.DB, n notifier.Notifier, options VerificationOptions) *VerificationService {
+	return &VerificationService{
+		userCtx:          u,
+		verificationRepo: NewVerificationRepoImpl(u, db),
+		notifier:         n,
+		options:          options,
+	}
+}
+
+// SendEmail is used by an authenticated admin to (re)send the verification link of an account
+func (v *VerificationService) SendEmail(user_uuid uuid.UUID) (*VerificationSendResponse, *responses.ErrorResponse) {
+	target, err := v.verificationRepo.GetTargetByUuid(user_uuid)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.checkPermission(target); err != nil {
+		return nil, err
+	}
+	return v.sendEmail(target)
+}
+
+// SendPhone is used by an authenticated admin to (re)send the OTP code of an account
+func (v *VerificationService) SendPhone(user_uuid uuid.UUID) (*VerificationSendResponse, *responses.ErrorResponse) {
+	target, err := v.verificationRepo.GetTargetByUuid(user_uuid)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.checkPermission(target); err != nil {
+		return nil, err
+	}
+	return v.sendPhone(target)
+}
+
+// SendWithCredentials lets a user whose login is blocked on verification request a new link or code
+func (v *VerificationService) SendWithCredentials(req VerificationSendRequest) (*VerificationSendResponse, *responses.ErrorResponse) {
+	target, err := v.verificationRepo.GetTargetByCredentials(req.UserName, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if req.Channel == ChannelEmail {
+		return v.sendEmail(target)
+	}
+	return v.sendPhone(target)
+}
+
+func (v *VerificationService) ConfirmEmail(req EmailConfirmRequest) (*VerificationResponse, *responses.ErrorResponse) {
+	claims, errToken := parseEmailToken(v.options.Secret, req.Token)
+	if errToken != nil {
+		return nil, responses.NewErrorResponse("verification_token_invalid", errToken)
+	}
+
+	target, err := v.verificationRepo.GetTargetByUuid(claims.UserUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedAt, err := v.verificationRepo.ConfirmEmail(target, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationResponse{Success: true, Channel: ChannelEmail, VerifiedAt: *verifiedAt}, nil
+}
+
+func (v *VerificationService) ConfirmPhone(req PhoneConfirmRequest) (*VerificationResponse, *responses.ErrorResponse) {
+	target, err := v.verificationRepo.GetTargetByUserName(req.UserName)
+	if err != nil {
+		return nil, err
+	}
+
+	otp, err := v.verificationRepo.GetLatestOtp(target.ID, v.options.ResendCooldown)
+	if err != nil {
+		return nil, err
+	}
+	if otp == nil || otp.ConsumedAt != nil || otp.Expired {
+		return nil, responses.NewErrorResponse("verification_code_invalid", fmt.Errorf("verification code is invalid or has expired"))
+	}
+
+	// The attempt is claimed before the code is compared, a 6 digit code must not be guessed in parallel
+	claimed, err := v.verificationRepo.ClaimOtpAttempt(otp.ID, v.options.OtpMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, responses.NewErrorResponse("verification_code_invalid", fmt.Errorf("too many attempts, please request a new code"))
+	}
+
+	if hashOtpCode(v.options.Secret, target.ID, otp.Target, req.Code) != otp.CodeHash {
+		return nil, responses.NewErrorResponse("verification_code_invalid", fmt.Errorf("verification code is invalid or has expired"))
+	}
+
+	verifiedAt, err := v.verificationRepo.ConfirmPhone(target, otp)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationResponse{Success: true, Channel: ChannelPhone, VerifiedAt: *verifiedAt}, nil
+}
+
+func (v *VerificationService) sendEmail(target *VerificationTarget) (*VerificationSendResponse, *responses.ErrorResponse) {
+	if target.EmailVerifiedAt != nil {
+		return nil, responses.NewErrorResponse("verification_already_done", fmt.Errorf("email address is already verified"))
+	}
+
+	expiresAt := time.Now().Add(v.options.EmailExpire)
+	token := signEmailToken(v.options.Secret, emailClaims{
+		UserUUID: target.UserUUID,
+		Email:    target.Email,
+		Exp:      expiresAt,
+	})
+	link := fmt.Sprintf("%s?token=%s", v.options.EmailLinkUrl, url.QueryEscape(token))
+
+	body := fmt.Sprintf("Hello %s, please confirm your email address by opening this link: %s", target.UserName, link)
+	if err := v.notifier.SendEmail(context.Background(), target.Email, "Verify your email address", body); err != nil {
+		custom_log.NewCustomLog("verification_send_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_send_failed", fmt.Errorf("cannot send verification email"))
+	}
+
+	return &VerificationSendResponse{
+		Channel:   ChannelEmail,
+		Target:    maskTarget(ChannelEmail, target.Email),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (v *VerificationService) sendPhone(target *VerificationTarget) (*VerificationSendResponse, *responses.ErrorResponse) {
+	if target.PhoneNumber == nil || *target.PhoneNumber == "" {
+		return nil, responses.NewErrorResponse("verification_send_failed", fmt.Errorf("user has no phone number"))
+	}
+	if target.PhoneVerifiedAt != nil {
+		return nil, responses.NewErrorResponse("verification_already_done", fmt.Errorf("phone number is already verified"))
+	}
+
+	latest, err := v.verificationRepo.GetLatestOtp(target.ID, v.options.ResendCooldown)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && latest.InCooldown {
+		return nil, responses.NewErrorResponse("verification_send_too_soon", fmt.Errorf("please wait before requesting a new code"))
+	}
+
+	code, errCode := newOtpCode()
+	if errCode != nil {
+		custom_log.NewCustomLog("verification_send_failed", errCode.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_send_failed", fmt.Errorf("cannot generate verification code"))
+	}
+
+	phone := *target.PhoneNumber
+	if err := v.verificationRepo.CreateOtp(target.ID, phone, hashOtpCode(v.options.Secret, target.ID, phone, code), v.options.OtpExpire); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Your verification code is %s. It expires in %d minutes.", code, int(v.options.OtpExpire.Minutes()))
+	if err := v.notifier.SendSMS(context.Background(), phone, message); err != nil {
+		custom_log.NewCustomLog("verification_send_failed", err.Error(), "error")
+		return nil, responses.NewErrorResponse("verification_send_failed", fmt.Errorf("cannot send verification code"))
+	}
+
+	return &VerificationSendResponse{
+		Channel:   ChannelPhone,
+		Target:    maskTarget(ChannelPhone, phone),
+		ExpiresAt: time.Now().Add(v.options.OtpExpire),
+	}, nil
+}
+
+func (v *VerificationService) checkPermission(target *VerificationTarget) *responses.ErrorResponse {
+	if target.UserName != v.userCtx.UserName && v.userCtx.RoleId > uint64(target.RoleId) {
+		return responses.NewErrorResponse("verification_send_failed", fmt.Errorf("permission denied: this user has a higher role than you"))
+	}
+	return nil
+}
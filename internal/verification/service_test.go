@@ -0,0 +1,105 @@
+package verification
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/responses"
+
+	"github.com/google/uuid"
+)
+
+// fakeRepo keeps one account and its latest code in memory, ClaimOtpAttempt is atomic like the
+// UPDATE of VerificationRepoImpl
+type fakeRepo struct {
+	VerificationRepo
+
+	mu       sync.Mutex
+	target   VerificationTarget
+	otp      Otp
+	verified bool
+}
+
+func (f *fakeRepo) GetTargetByUserName(string) (*VerificationTarget, *responses.ErrorResponse) {
+	target := f.target
+	return &target, nil
+}
+
+func (f *fakeRepo) GetLatestOtp(uint64, time.Duration) (*Otp, *responses.ErrorResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	otp := f.otp
+	return &otp, nil
+}
+
+func (f *fakeRepo) ClaimOtpAttempt(otpID uint64, maxAttempts int) (bool, *responses.ErrorResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.otp.ID != otpID || f.otp.ConsumedAt != nil || f.otp.Attempts >= maxAttempts {
+		return false, nil
+	}
+	f.otp.Attempts++
+	return true, nil
+}
+
+func (f *fakeRepo) ConfirmPhone(*VerificationTarget, *Otp) (*time.Time, *responses.ErrorResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	f.otp.ConsumedAt = &now
+	f.verified = true
+	return &now, nil
+}
+
+func newTestService(code string) (*VerificationService, *fakeRepo) {
+	options := VerificationOptions{Secret: "secret", OtpMaxAttempts: 5}
+	phone := "+85512345678"
+	repo := &fakeRepo{
+		target: VerificationTarget{ID: 7, UserUUID: uuid.New(), UserName: "alice", PhoneNumber: &phone},
+		otp:    Otp{ID: 1, UserID: 7, Target: phone, CodeHash: hashOtpCode(options.Secret, 7, phone, code)},
+	}
+	return &VerificationService{userCtx: &types.UserContext{}, verificationRepo: repo, options: options}, repo
+}
+
+func TestConfirmPhone(t *testing.T) {
+	service, repo := newTestService("123456")
+	if _, err := service.ConfirmPhone(PhoneConfirmRequest{UserName: "alice", Code: "000000"}); err == nil {
+		t.Fatal("expected a wrong code to be refused")
+	}
+	if _, err := service.ConfirmPhone(PhoneConfirmRequest{UserName: "alice", Code: "123456"}); err != nil {
+		t.Fatalf("expected the code to verify the phone number: %v", err.Err)
+	}
+	if !repo.verified || repo.otp.Attempts != 2 {
+		t.Fatalf("expected the phone number to be verified after 2 attempts, got %v after %d", repo.verified, repo.otp.Attempts)
+	}
+}
+
+func TestConfirmPhoneAttemptLimit(t *testing.T) {
+	service, repo := newTestService("123456")
+
+	// Parallel guesses all read the code before any attempt is counted
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.ConfirmPhone(PhoneConfirmRequest{UserName: "alice", Code: "000000"}); err == nil {
+				t.Error("expected a wrong code to be refused")
+			}
+		}()
+	}
+	wg.Wait()
+	if repo.otp.Attempts != 5 {
+		t.Fatalf("expected 5 attempts to be counted, got %d", repo.otp.Attempts)
+	}
+
+	_, err := service.ConfirmPhone(PhoneConfirmRequest{UserName: "alice", Code: "123456"})
+	if err == nil || err.MessageID != "verification_code_invalid" {
+		t.Fatalf("expected the right code to be refused once the attempts are used up, got %v", err)
+	}
+	if repo.verified {
+		t.Fatal("expected the phone number to stay unverified")
+	}
+}
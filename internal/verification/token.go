@@ -0,0 +1,91 @@
+package verification
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// emailClaims is the payload of the signed email verification link. The email address is part of
+// the payload so a link stops working as soon as the address on the account changes.
+type emailClaims struct {
+	UserUUID uuid.UUID
+	Email    string
+	Exp      time.Time
+}
+
+func signEmailToken(secret string, claims emailClaims) string {
+	payload := strings.Join([]string{
+		claims.UserUUID.String(),
+		claims.Email,
+		strconv.FormatInt(claims.Exp.Unix(), 10),
+	}, "|")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + hmacHex(secret, encoded)
+}
+
+func parseEmailToken(secret string, token string) (*emailClaims, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed verification token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(hmacHex(secret, encoded))) {
+		return nil, fmt.Errorf("invalid verification token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed verification token")
+	}
+	parts := strings.Split(string(payload), "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed verification token")
+	}
+
+	user_uuid, err := uuid.Parse(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed verification token")
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed verification token")
+	}
+	if time.Now().Unix() > exp {
+		return nil, fmt.Errorf("verification token has expired")
+	}
+
+	return &emailClaims{
+		UserUUID: user_uuid,
+		Email:    parts[1],
+		Exp:      time.Unix(exp, 0),
+	}, nil
+}
+
+// newOtpCode returns a random 6 digit numeric code
+func newOtpCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashOtpCode binds the code to the user and phone number so a leaked hash is useless elsewhere
+func hashOtpCode(secret string, userID uint64, target string, code string) string {
+	return hmacHex(secret, fmt.Sprintf("%d|%s|%s", userID, target, code))
+}
+
+func hmacHex(secret string, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,274 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"snack-shop/pkg/constants"
+	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// A close frame reason may not be longer than 123 bytes
+const maxCloseReasonLength = 123
+
+// ConnectionInfo describes one live connection for the administration endpoints
+type ConnectionInfo struct {
+	ID          string    `json:"id"`
+	Transport   string    `json:"transport"`
+	Key         string    `json:"key"`
+	Kind        string    `json:"kind"`
+	AccountID   int64     `json:"account_id"`
+	UserName    string    `json:"user_name"`
+	RoleId      uint64    `json:"role_id,omitempty"`
+	Ip          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	Instance    string    `json:"instance,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastActive  time.Time `json:"last_active"`
+
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Sent          int64 `json:"sent"`
+	Dropped       int64 `json:"dropped"`
+}
+
+type KickRequest struct {
+	Reason string `json:"reason" validate:"required,max=123"`
+}
+
+func (r *KickRequest) bind(c *fiber.Ctx, v *utils.Validator) error {
+	if err := c.BodyParser(r); err != nil {
+		return err
+	}
+	r.Reason = strings.TrimSpace(r.Reason)
+	return v.Validate(r)
+}
+
+// KickResponse is the number of connections that were told to close
+type KickResponse struct {
+	Connections int `json:"connections"`
+}
+
+func (c *Client) info() ConnectionInfo {
+	c.mu.Lock()
+	lastActive := c.LastActive
+	c.mu.Unlock()
+
+	info := ConnectionInfo{
+		ID:          c.ID,
+		Transport:   c.Transport,
+		Key:         c.UserID,
+		Kind:        c.Identity.Kind,
+		AccountID:   c.Identity.ID,
+		UserName:    c.Identity.UserName,
+		RoleId:      c.Identity.RoleId,
+		Ip:          c.Identity.Ip,
+		UserAgent:   c.Identity.UserAgent,
+		ConnectedAt: c.ConnectedAt,
+		LastActive:  lastActive,
+
+		QueueDepth:    len(c.SendChan),
+		QueueCapacity: cap(c.SendChan),
+		Sent:          c.sent.Load(),
+		Dropped:       c.dropped.Load(),
+	}
+	if c.hub.cluster != nil {
+		info.Instance = c.hub.cluster.originID
+	}
+	return info
+}
+
+// close sends a close frame with code and reason and drops the connection. WriteControl may run
+// concurrently with the writer of the connection, an event stream writes its close envelope itself.
+func (c *Client) close(code int, reason string) {
+	if len(reason) > maxCloseReasonLength {
+		reason = reason[:maxCloseReasonLength]
+	}
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	c.mu.Lock()
+	c.closeCode = code
+	c.closeReason = reason
+	c.mu.Unlock()
+
+	if c.Conn != nil {
+		deadline := time.Now().Add(time.Second)
+		if err := c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline); err != nil {
+			custom_log.NewCustomLog("websocket_close_failed", err.Error(), "warn")
+		}
+	}
+	c.cleanup()
+}
+
+// localConnections returns the connections on this instance
+func (h *Hub) localConnections() []ConnectionInfo {
+	clients := h.allClients()
+	infos := make([]ConnectionInfo, len(clients))
+	for i, client := range clients {
+		infos[i] = client.info()
+	}
+	return infos
+}
+
+// allConnections lists the connections of the whole cluster, or of this instance without Redis
+func (h *Hub) allConnections(ctx context.Context) ([]ConnectionInfo, error) {
+	if h.cluster == nil {
+		return h.localConnections(), nil
+	}
+	return h.cluster.Connections(ctx)
+}
+
+// Connections lists the live connections, optionally of one account with ?key=user12
+func (h *WebSocketHandler) Connections(c *fiber.Ctx) error {
+	uCtx, ok := c.Locals("UserContext").(types.UserContext)
+	if !ok {
+		return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+			utils.Translate("websocket_connections_failed", nil, c),
+			constants.WebSocketConnectionsFailed,
+			fmt.Errorf("only admin users can list the connections"),
+		))
+	}
+
+	connections, err := h.hub.allConnections(c.Context())
+	if err != nil {
+		custom_log.NewCustomLog("websocket_connections_failed", err.Error(), "error")
+		return c.Status(http.StatusInternalServerError).JSON(response.NewResponseError(
+			utils.Translate("websocket_connections_failed", nil, c),
+			constants.WebSocketConnectionsFailed,
+			fmt.Errorf("cannot list the connections"),
+		))
+	}
+
+	key := c.Query("key")
+	filtered := make([]ConnectionInfo, 0, len(connections))
+	for _, info := range connections {
+		if (key == "" || info.Key == key) && manageable(uCtx, info) {
+			filtered = append(filtered, info)
+		}
+	}
+	connections = filtered
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+	})
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("websocket_connections_success", nil, c),
+		constants.WebSocketConnectionsSuccess,
+		connections,
+	))
+}
+
+// manageable reports whether the admin may see and close the connection, like other account
+// actions an admin cannot act on a more privileged user
+func manageable(uCtx types.UserContext, info ConnectionInfo) bool {
+	return info.Kind != IdentityUser || uCtx.RoleId <= info.RoleId
+}
+
+// KickConnection closes one connection with the given reason
+func (h *WebSocketHandler) KickConnection(c *fiber.Ctx) error {
+	return h.kick(c, closeRequest{Connection: c.Params("id")})
+}
+
+// KickAccount closes every connection of an account, e.g. user12 or member42
+func (h *WebSocketHandler) KickAccount(c *fiber.Ctx) error {
+	return h.kick(c, closeRequest{Account: c.Params("key")})
+}
+
+func (h *WebSocketHandler) kick(c *fiber.Ctx, request closeRequest) error {
+	uCtx, ok := c.Locals("UserContext").(types.UserContext)
+	if !ok {
+		return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+			utils.Translate("websocket_kick_failed", nil, c),
+			constants.WebSocketKickFailed,
+			fmt.Errorf("only admin users can close connections"),
+		))
+	}
+
+	var kickRequest KickRequest
+	v := utils.NewValidator()
+	if err := kickRequest.bind(c, v); err != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			utils.Translate("websocket_kick_failed", nil, c),
+			constants.WebSocketKickFailed,
+			err,
+		))
+	}
+
+	connections, err := h.hub.allConnections(c.Context())
+	if err != nil {
+		custom_log.NewCustomLog("websocket_kick_failed", err.Error(), "error")
+		return c.Status(http.StatusInternalServerError).JSON(response.NewResponseError(
+			utils.Translate("websocket_kick_failed", nil, c),
+			constants.WebSocketKickFailed,
+			fmt.Errorf("cannot list the connections"),
+		))
+	}
+
+	var targets []ConnectionInfo
+	for _, info := range connections {
+		if (request.Connection != "" && info.ID == request.Connection) || (request.Account != "" && info.Key == request.Account) {
+			targets = append(targets, info)
+		}
+	}
+	if len(targets) == 0 {
+		return c.Status(http.StatusNotFound).JSON(response.NewResponseError(
+			utils.Translate("websocket_kick_failed", nil, c),
+			constants.WebSocketKickFailed,
+			fmt.Errorf("no live connection `%s%s`", request.Connection, request.Account),
+		))
+	}
+
+	for _, info := range targets {
+		if !manageable(uCtx, info) {
+			return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+				utils.Translate("websocket_kick_failed", nil, c),
+				constants.WebSocketKickFailed,
+				fmt.Errorf("not allowed to close connections of `%s`", info.UserName),
+			))
+		}
+	}
+
+	request.Code = CloseKicked
+	request.Reason = kickRequest.Reason
+	h.hub.closeConnections(request)
+
+	// Add Audit
+	auditContext := "Kick WebSocket Connection"
+	auditDesc := fmt.Sprintf("Connection `%s` of `%s` has been closed: %s", request.Connection, targets[0].UserName, kickRequest.Reason)
+	if request.Account != "" {
+		auditContext = "Kick WebSocket Account"
+		auditDesc = fmt.Sprintf("%d connection(s) of `%s` have been closed: %s", len(targets), targets[0].UserName, kickRequest.Reason)
+	}
+	// The log of a kicked user is the one of the user, players have no user audit log
+	auditUserID := int(uCtx.UserID)
+	if targets[0].Kind == IdentityUser {
+		auditUserID = int(targets[0].AccountID)
+	}
+	_, err = utils.AddUserAuditLog(
+		auditUserID, auditContext, auditDesc, 1, uCtx.UserAgent,
+		uCtx.UserName, uCtx.Ip, int(uCtx.UserID), h.db)
+	if err != nil {
+		custom_log.NewCustomLog("websocket_kick_failed", err.Error(), "warn")
+		// Audit failures are not critical, so we don't return an error
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("websocket_kick_success", nil, c),
+		constants.WebSocketKickSuccess,
+		KickResponse{Connections: len(targets)},
+	))
+}
@@ -0,0 +1,50 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	types "snack-shop/pkg/model"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestConnectionsHidesPrivilegedUsers(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	identities := []Identity{testIdentity(IdentityUser, 1), testIdentity(IdentityUser, 2), testIdentity(IdentityUser, 3), testIdentity(IdentityPlayer, 4)}
+	identities[0].RoleId = 1
+	identities[1].RoleId = 2
+	identities[2].RoleId = 3
+	for _, identity := range identities {
+		if err := hub.connect(hub.newClient(identity, TransportSSE, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := NewHandler(nil, hub, nil, nil)
+	app := fiber.New()
+	app.Get("/connections", func(c *fiber.Ctx) error {
+		c.Locals("UserContext", types.UserContext{UserID: 2, RoleId: 2})
+		return handler.Connections(c)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/connections", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Data []ConnectionInfo `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]bool{}
+	for _, info := range body.Data {
+		keys[info.Key] = true
+	}
+	if len(keys) != 3 || keys["user1"] || !keys["user2"] || !keys["user3"] || !keys["member4"] {
+		t.Fatalf("expected user2, user3 and member4, got %v", keys)
+	}
+}
@@ -0,0 +1,300 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	custom_log "snack-shop/pkg/logs"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	fanoutChannel     = "websocket:fanout"
+	instancesKey      = "websocket:instances"
+	presenceKeyPrefix = "websocket:presence:"
+	// Hash per instance of connection ID -> ConnectionInfo, last_active is refreshed by the heartbeat
+	connectionsKeyPrefix = "websocket:connections:"
+
+	// An instance that missed its heartbeats for instanceTTL no longer counts as present
+	heartbeatInterval = 30 * time.Second
+	instanceTTL       = 90 * time.Second
+)
+
+const (
+	targetTopic = "topic"
+	targetUser  = "user"
+	targetClose = "close"
+)
+
+// clusterMessage is a hub message relayed to the other instances. Origin is the instance that
+// already delivered it to its own connections, it skips its own messages.
+type clusterMessage struct {
+	Origin  string          `json:"origin"`
+	Target  string          `json:"target"`
+	Key     string          `json:"key"`
+	Message json.RawMessage `json:"message"`
+}
+
+// ClusterOptions are the settings of the Redis backed part of the hub
+type ClusterOptions struct {
+	StreamMaxLen int64
+	StreamTTL    time.Duration
+}
+
+// Cluster relays hub messages between API replicas through Redis pub/sub, keeps the count of
+// the connections of every replica and the message streams of the accounts in Redis
+type Cluster struct {
+	hub      *Hub
+	redis    *redis.Client
+	originID string
+	options  ClusterOptions
+}
+
+// StartCluster joins the hub to the fan-out channel and starts the presence heartbeat, both stop
+// when ctx is done and wg is done once the instance left. Without a cluster the hub only reaches
+// local connections.
+func StartCluster(ctx context.Context, wg *sync.WaitGroup, hub *Hub, rdb *redis.Client, options ClusterOptions) *Cluster {
+	c := &Cluster{
+		hub:      hub,
+		redis:    rdb,
+		originID: uuid.NewString(),
+		options:  options,
+	}
+	hub.cluster = c
+
+	sub := rdb.Subscribe(ctx, fanoutChannel)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer sub.Close()
+		channel := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-channel:
+				if !ok {
+					return
+				}
+				c.receive(msg.Payload)
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		c.heartbeat(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				c.leave()
+				return
+			case <-ticker.C:
+				c.heartbeat(ctx)
+			}
+		}
+	}()
+
+	return c
+}
+
+// broadcast hands a message the local connections already got to the other instances
+func (c *Cluster) broadcast(target string, key string, message []byte) {
+	payload, err := json.Marshal(clusterMessage{
+		Origin:  c.originID,
+		Target:  target,
+		Key:     key,
+		Message: message,
+	})
+	if err != nil {
+		custom_log.NewCustomLog("websocket_fanout_failed", err.Error(), "error")
+		return
+	}
+	if err := c.redis.Publish(context.Background(), fanoutChannel, payload).Err(); err != nil {
+		custom_log.NewCustomLog("websocket_fanout_failed", err.Error(), "error")
+	}
+}
+
+func (c *Cluster) receive(payload string) {
+	var message clusterMessage
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		custom_log.NewCustomLog("websocket_fanout_failed", err.Error(), "warn")
+		return
+	}
+	if message.Origin == c.originID {
+		return
+	}
+
+	switch message.Target {
+	case targetTopic:
+		c.hub.publishLocal(message.Key, message.Message)
+	case targetUser:
+		c.hub.sendLocal(message.Key, message.Message)
+	case targetClose:
+		var request closeRequest
+		if err := json.Unmarshal(message.Message, &request); err != nil {
+			custom_log.NewCustomLog("websocket_fanout_failed", err.Error(), "warn")
+			return
+		}
+		c.hub.closeLocal(request)
+	}
+}
+
+// connected and disconnected keep the presence and connection hashes of this instance up to date
+// between heartbeats
+func (c *Cluster) connected(client *Client) {
+	ctx := context.Background()
+	info, err := json.Marshal(client.info())
+	if err != nil {
+		custom_log.NewCustomLog("websocket_presence_failed", err.Error(), "warn")
+		return
+	}
+	_, err = c.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, presenceKeyPrefix+c.originID, client.UserID, 1)
+		pipe.HSet(ctx, connectionsKeyPrefix+c.originID, client.ID, info)
+		return nil
+	})
+	if err != nil {
+		custom_log.NewCustomLog("websocket_presence_failed", err.Error(), "warn")
+	}
+}
+
+func (c *Cluster) disconnected(client *Client) {
+	ctx := context.Background()
+	presenceKey := presenceKeyPrefix + c.originID
+	count, err := c.redis.HIncrBy(ctx, presenceKey, client.UserID, -1).Result()
+	if err == nil && count <= 0 {
+		err = c.redis.HDel(ctx, presenceKey, client.UserID).Err()
+	}
+	if err == nil {
+		err = c.redis.HDel(ctx, connectionsKeyPrefix+c.originID, client.ID).Err()
+	}
+	if err != nil {
+		custom_log.NewCustomLog("websocket_presence_failed", err.Error(), "warn")
+	}
+}
+
+// heartbeat rewrites the presence and connection hashes from the local connections and marks the
+// instance alive
+func (c *Cluster) heartbeat(ctx context.Context) {
+	presenceKey := presenceKeyPrefix + c.originID
+	connectionsKey := connectionsKeyPrefix + c.originID
+	counts := c.hub.localConnectionCounts()
+
+	connections := make(map[string]interface{})
+	for _, info := range c.hub.localConnections() {
+		body, err := json.Marshal(info)
+		if err != nil {
+			continue
+		}
+		connections[info.ID] = body
+	}
+
+	_, err := c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, presenceKey)
+		if len(counts) > 0 {
+			pipe.HSet(ctx, presenceKey, counts)
+		}
+		pipe.Expire(ctx, presenceKey, instanceTTL)
+		pipe.Del(ctx, connectionsKey)
+		if len(connections) > 0 {
+			pipe.HSet(ctx, connectionsKey, connections)
+		}
+		pipe.Expire(ctx, connectionsKey, instanceTTL)
+		pipe.ZAdd(ctx, instancesKey, redis.Z{Score: float64(time.Now().Unix()), Member: c.originID})
+		pipe.ZRemRangeByScore(ctx, instancesKey, "-inf", strconv.FormatInt(time.Now().Add(-instanceTTL).Unix(), 10))
+		return nil
+	})
+	if err != nil {
+		custom_log.NewCustomLog("websocket_presence_failed", err.Error(), "warn")
+	}
+}
+
+// leave removes the instance right away instead of waiting for its heartbeat to expire
+func (c *Cluster) leave() {
+	ctx := context.Background()
+	c.redis.ZRem(ctx, instancesKey, c.originID)
+	c.redis.Del(ctx, presenceKeyPrefix+c.originID, connectionsKeyPrefix+c.originID)
+}
+
+// Presence counts the connections and the distinct connected accounts of all live instances
+func (c *Cluster) Presence(ctx context.Context) (*PresenceCount, error) {
+	since := strconv.FormatInt(time.Now().Add(-instanceTTL).Unix(), 10)
+	instances, err := c.redis.ZRangeByScore(ctx, instancesKey, &redis.ZRangeBy{Min: since, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list websocket instances: %w", err)
+	}
+
+	presence := &PresenceCount{Instances: len(instances)}
+	accounts := make(map[string]struct{})
+	for _, instance := range instances {
+		counts, err := c.redis.HGetAll(ctx, presenceKeyPrefix+instance).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read websocket presence: %w", err)
+		}
+		for key, value := range counts {
+			count, _ := strconv.Atoi(value)
+			if count <= 0 {
+				continue
+			}
+			presence.Connections += count
+			accounts[key] = struct{}{}
+		}
+	}
+	presence.Accounts = len(accounts)
+	return presence, nil
+}
+
+// Connections lists the connections of all live instances
+func (c *Cluster) Connections(ctx context.Context) ([]ConnectionInfo, error) {
+	since := strconv.FormatInt(time.Now().Add(-instanceTTL).Unix(), 10)
+	instances, err := c.redis.ZRangeByScore(ctx, instancesKey, &redis.ZRangeBy{Min: since, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list websocket instances: %w", err)
+	}
+
+	connections := make([]ConnectionInfo, 0)
+	for _, instance := range instances {
+		entries, err := c.redis.HGetAll(ctx, connectionsKeyPrefix+instance).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read websocket connections: %w", err)
+		}
+		for _, entry := range entries {
+			var info ConnectionInfo
+			if err := json.Unmarshal([]byte(entry), &info); err != nil {
+				continue
+			}
+			connections = append(connections, info)
+		}
+	}
+	return connections, nil
+}
+
+// connectionCount counts the connections of one account on all live instances
+func (c *Cluster) connectionCount(ctx context.Context, key string) (int, error) {
+	since := strconv.FormatInt(time.Now().Add(-instanceTTL).Unix(), 10)
+	instances, err := c.redis.ZRangeByScore(ctx, instancesKey, &redis.ZRangeBy{Min: since, Max: "+inf"}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list websocket instances: %w", err)
+	}
+
+	total := 0
+	for _, instance := range instances {
+		count, err := c.redis.HGet(ctx, presenceKeyPrefix+instance, key).Int()
+		if err != nil && err != redis.Nil {
+			return 0, fmt.Errorf("failed to read websocket presence: %w", err)
+		}
+		if count > 0 {
+			total += count
+		}
+	}
+	return total, nil
+}
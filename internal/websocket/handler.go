@@ -5,91 +5,160 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"snack-shop/pkg/constants"
 	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
 	types "snack-shop/pkg/model"
-
-	// "scratch_card_admin/pkg/constant"
-	// statuscode "scratch_card_admin/pkg/constant/statuscode/bet_rmq"
-	// pkg_model "scratch_card_admin/pkg/models"
-	// "scratch_card_admin/pkg/utils/apiresponse"
+	"snack-shop/pkg/utils"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
-// Client represents a single WebSocket connection with metadata
-type Client struct {
-	ID          string          // Unique connection ID
-	Conn        *websocket.Conn // The actual WebSocket connection
-	UserID      string          // User identifier from JWT
-	ConnectedAt time.Time       // When this connection was established
-	LastActive  time.Time       // Last activity timestamp
-	SendChan    chan []byte     // Channel for sending messages to this client
-	mu          sync.Mutex      // Mutex for thread-safe operations on this client
-	done        chan struct{}   // Signal channel for shutdown
-	closeOnce   sync.Once       // Ensure cleanup only happens once
-}
-
-// Global storage for clients - now supports multiple connections per user
-var (
-	// Map: UserID -> Array of Client connections
-	Clients      = make(map[string][]*Client)
-	ClientsMutex = &sync.RWMutex{}
-)
-
 // WebSocketHandler struct to handle database and WebSocket connections
 type WebSocketHandler struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	hub      *Hub
+	presence *PresenceService
+	rpc      *RPC
 }
 
-func NewHandler(db *sqlx.DB) *WebSocketHandler {
+func NewHandler(db *sqlx.DB, hub *Hub, presence *PresenceService, rpc *RPC) *WebSocketHandler {
 	return &WebSocketHandler{
-		db: db,
+		db:       db,
+		hub:      hub,
+		presence: presence,
+		rpc:      rpc,
+	}
+}
+
+// identityFromContext builds the identity of a connection from the context of the JWT middleware
+func identityFromContext(c *fiber.Ctx) (Identity, bool) {
+	var identity Identity
+	if uCtx, ok := c.Locals("UserContext").(types.UserContext); ok {
+		identity = Identity{
+			Key:       uCtx.KeyAliasForWebsocket,
+			Kind:      IdentityUser,
+			ID:        int64(uCtx.UserID),
+			UUID:      uCtx.UserUuid,
+			UserName:  uCtx.UserName,
+			RoleId:    uCtx.RoleId,
+			UserAgent: uCtx.UserAgent,
+			Ip:        uCtx.Ip,
+
+			LoginSession: uCtx.LoginSession,
+			ExpiresAt:    uCtx.Exp,
+		}
+	} else if pCtx, ok := c.Locals("PlayerContext").(types.PlayerContext); ok {
+		identity = Identity{
+			Key:       pCtx.KeyAliasForWebsocket,
+			Kind:      IdentityPlayer,
+			ID:        int64(pCtx.PlayerID),
+			UUID:      pCtx.PlayerUuid,
+			UserName:  pCtx.UserName,
+			UserAgent: pCtx.UserAgent,
+			Ip:        pCtx.Ip,
+
+			LoginSession: pCtx.LoginSession,
+			ExpiresAt:    pCtx.Exp,
+		}
 	}
+	return identity, identity.Key != ""
+}
+
+// Upgrade resolves the identity of the connection before the protocol switch, the JWT middleware
+// has already verified the token and the login session of the user or player
+func (h *WebSocketHandler) Upgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	identity, ok := identityFromContext(c)
+	if !ok {
+		custom_log.NewCustomLog("websocket_identity_failed", "missing user or player context on websocket upgrade", "warn")
+		return fiber.ErrUnauthorized
+	}
+
+	// The JWT middleware accepted the token of "Bearer, <token>", RPC calls send it again
+	if parts := strings.Split(c.Get("Sec-WebSocket-Protocol"), ","); len(parts) == 2 {
+		identity.token = strings.TrimSpace(parts[1])
+	}
+	identity.language = c.Query("lang", c.Get(fiber.HeaderAcceptLanguage))
+	identity.messages = translateRPCMessages(c)
+
+	c.Locals("WebSocketIdentity", identity)
+	return c.Next()
+}
+
+// Presence returns the number of connections of the whole cluster, it is for admin users only
+func (h *WebSocketHandler) Presence(c *fiber.Ctx) error {
+	if _, ok := c.Locals("UserContext").(types.UserContext); !ok {
+		return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+			utils.Translate("websocket_presence_failed", nil, c),
+			constants.WebSocketPresenceFailed,
+			fmt.Errorf("only admin users can read the presence"),
+		))
+	}
+
+	var presence *PresenceCount
+	if h.hub.cluster != nil {
+		var err error
+		presence, err = h.hub.cluster.Presence(c.Context())
+		if err != nil {
+			custom_log.NewCustomLog("websocket_presence_failed", err.Error(), "error")
+			return c.Status(http.StatusInternalServerError).JSON(response.NewResponseError(
+				utils.Translate("websocket_presence_failed", nil, c),
+				constants.WebSocketPresenceFailed,
+				fmt.Errorf("cannot read the presence"),
+			))
+		}
+	} else {
+		presence = &PresenceCount{Instances: 1}
+		for _, count := range h.hub.localConnectionCounts() {
+			presence.Connections += count.(int)
+			presence.Accounts++
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("websocket_presence_success", nil, c),
+		constants.WebSocketPresenceSuccess,
+		presence,
+	))
 }
 
 // HandleWebSocket handles WebSocket communication with support for multiple connections
 func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
-	// Extract user context from JWT
-	Context, ok := c.Locals("userContext").(*types.UserContext)
-	if !ok || Context == nil {
-		log.Println("Invalid user context")
+	identity, ok := c.Locals("WebSocketIdentity").(Identity)
+	if !ok {
+		log.Println("Invalid websocket identity")
 		return
 	}
 
-	// Build final WebSocket key: "user1" or "member10" etc.
-	userID := Context.KeyAliasForWebsocket
-
-	// Create a unique client instance for this connection
-	client := &Client{
-		ID:          uuid.New().String(), // Unique ID for this specific connection
-		Conn:        c,
-		UserID:      userID,
-		ConnectedAt: time.Now(),
-		LastActive:  time.Now(),
-		SendChan:    make(chan []byte, 256), // Buffered channel for messages
-		done:        make(chan struct{}),    // Shutdown signal
+	if err := h.hub.admit(context.Background(), identity.Key); err != nil {
+		logViolation(identity, "", err)
+		message := websocket.FormatCloseMessage(CloseTooManyConnections, ReasonTooManyConnections)
+		c.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		return
 	}
 
-	// Add this client to the map (supports multiple connections per user)
-	h.AddClient(client)
-
-	log.Printf("✅ User %s connected (ConnectionID: %s, Total connections for this user: %d)\n",
-		userID, client.ID, h.GetUserConnectionCount(userID))
+	client := h.hub.newClient(identity, TransportWebSocket, c)
+	if err := h.hub.connect(client); err != nil {
+		client.close(websocket.CloseGoingAway, ReasonServerShutdown)
+		return
+	}
+	defer h.hub.disconnect(client)
 
-	// Cleanup when connection closes
-	defer func() {
-		client.cleanup()
-		h.DropClient(client)
-		log.Printf("🔌 User %s disconnected (ConnectionID: %s, Remaining connections: %d)\n",
-			userID, client.ID, h.GetUserConnectionCount(userID))
-	}()
+	h.serve(client)
+}
 
+// serve runs the reader and the writer of a connection until either stops
+func (h *WebSocketHandler) serve(client *Client) {
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -98,9 +167,11 @@ func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	// Writer goroutine - sends messages from SendChan to client
+	// Writer goroutine - sends messages from SendChan to client, closing the connection also
+	// unblocks the reader
 	go func() {
 		defer wg.Done()
+		defer client.cleanup()
 		h.writePump(ctx, client)
 	}()
 
@@ -114,21 +185,15 @@ func (h *WebSocketHandler) HandleWebSocket(c *websocket.Conn) {
 	wg.Wait()
 }
 
-// cleanup handles safe shutdown of client resources
-func (c *Client) cleanup() {
-	c.closeOnce.Do(func() {
-		close(c.done)
-		close(c.SendChan)
-		c.Conn.Close()
-	})
-}
-
 // readPump handles incoming messages from the WebSocket client
 func (h *WebSocketHandler) readPump(ctx context.Context, client *Client, cancel context.CancelFunc) {
 	defer cancel()
 
-	// Set initial read deadline
+	// Set initial read deadline and the size limit, a larger message closes the connection
 	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	if h.hub.options.MaxMessageSize > 0 {
+		client.Conn.SetReadLimit(int64(h.hub.options.MaxMessageSize))
+	}
 
 	// Handle pong messages to keep connection alive
 	client.Conn.SetPongHandler(func(string) error {
@@ -148,21 +213,29 @@ func (h *WebSocketHandler) readPump(ctx context.Context, client *Client, cancel
 		default:
 			_, msg, err := client.Conn.ReadMessage()
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("❌ WebSocket error for user %s (conn: %s): %v", client.UserID, client.ID, err)
+				// The error comes from fasthttp/websocket, which gofiber/websocket declares again,
+				// and the connection already sent the close frame
+				if err.Error() == websocket.ErrReadLimit.Error() {
+					logViolation(client.Identity, client.ID, fmt.Errorf("message larger than %d bytes", h.hub.options.MaxMessageSize))
+				} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+					log.Printf("WebSocket read error for %s (%s): %v", client.UserID, client.ID, err)
 				}
 				return
 			}
+			if err := h.hub.allowMessage(client); err != nil {
+				logViolation(client.Identity, client.ID, err)
+				client.close(CloseRateLimited, ReasonRateLimited)
+				return
+			}
 
-			// Update last active time
+			// Update last active time, unlike pongs a message also keeps the presence online
+			now := time.Now()
 			client.mu.Lock()
-			client.LastActive = time.Now()
+			client.LastActive = now
+			client.LastMessage = now
 			client.mu.Unlock()
 
-			log.Printf("📨 Received from user %s (conn: %s): %s", client.UserID, client.ID, msg)
-
-			// Handle the message (you can add your business logic here)
-			// Example: h.handleClientMessage(client, msg)
+			h.handleClientMessage(client, msg)
 		}
 	}
 }
@@ -172,158 +245,35 @@ func (h *WebSocketHandler) writePump(ctx context.Context, client *Client) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	// Log connection stats safely
-	h.logConnectionStats()
-
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("🛑 Context done for user %s (conn: %s)", client.UserID, client.ID)
 			return
 
 		case <-client.done:
-			log.Printf("🛑 Client shutdown for user %s (conn: %s)", client.UserID, client.ID)
 			return
 
-		case message, ok := <-client.SendChan:
+		case message := <-client.SendChan:
 			client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-
-			log.Println("-----------------------------------------------------")
-			log.Printf("📨 Received SendChan event for user %s (conn: %s)", client.UserID, client.ID)
-			log.Printf("📦 ok = %v", ok)
-			log.Printf("📦 message raw = %s", string(message))
-			log.Println("-----------------------------------------------------")
-
-			if !ok {
-				log.Printf("❌ SendChan CLOSED for user %s (conn: %s)", client.UserID, client.ID)
-				client.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
 			if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("❌ Error writing message to user %s (conn: %s): %v", client.UserID, client.ID, err)
+				log.Printf("WebSocket write error for %s (%s): %v", client.UserID, client.ID, err)
 				return
 			}
 
-			log.Printf("✅ Message delivered to user %s (conn: %s)\n", client.UserID, client.ID)
-
 		case <-ticker.C:
 			client.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("❌ Ping failed for user %s (conn: %s): %v", client.UserID, client.ID, err)
+				log.Printf("WebSocket ping failed for %s (%s): %v", client.UserID, client.ID, err)
 				return
 			}
-			log.Printf("🏓 Ping sent to user %s (conn: %s)", client.UserID, client.ID)
-		}
-	}
-}
-
-// logConnectionStats safely logs connection statistics
-func (h *WebSocketHandler) logConnectionStats() {
-	ClientsMutex.RLock()
-	defer ClientsMutex.RUnlock()
-
-	for uid, conns := range Clients {
-		log.Printf("👥 User %s has %d connections", uid, len(conns))
-	}
-}
-
-// AddClient adds a new client connection (supports multiple connections per user)
-func (h *WebSocketHandler) AddClient(client *Client) {
-	ClientsMutex.Lock()
-	defer ClientsMutex.Unlock()
-
-	// Append to the array of connections for this user
-	Clients[client.UserID] = append(Clients[client.UserID], client)
-
-	log.Printf("📊 Client added - User: %s, ConnID: %s, Total connections for user: %d",
-		client.UserID, client.ID, len(Clients[client.UserID]))
-}
-
-// DropClient removes a specific client connection
-func (h *WebSocketHandler) DropClient(client *Client) {
-	ClientsMutex.Lock()
-	defer ClientsMutex.Unlock()
-
-	connections := Clients[client.UserID]
-
-	// Find and remove this specific connection
-	for i, conn := range connections {
-		if conn.ID == client.ID {
-			// Remove this connection from the slice
-			Clients[client.UserID] = append(connections[:i], connections[i+1:]...)
-
-			// If no more connections for this user, delete the key
-			if len(Clients[client.UserID]) == 0 {
-				delete(Clients, client.UserID)
-				log.Printf("🗑️  User %s has no more connections, removed from map", client.UserID)
-			}
-
-			log.Printf("📊 Client removed - User: %s, ConnID: %s, Remaining connections: %d",
-				client.UserID, client.ID, len(Clients[client.UserID]))
-			break
-		}
-	}
-}
-
-// GetUserConnectionCount returns the number of active connections for a user
-func (h *WebSocketHandler) GetUserConnectionCount(userID string) int {
-	ClientsMutex.RLock()
-	defer ClientsMutex.RUnlock()
-	return len(Clients[userID])
-}
-
-// DropClients closes all WebSocket connections (for graceful shutdown)
-func DropClients() {
-	ClientsMutex.Lock()
-	defer ClientsMutex.Unlock()
-
-	for userID, connections := range Clients {
-		for _, client := range connections {
-			// Use cleanup to safely close everything
-			client.cleanup()
-			log.Printf("🛑 Closed connection for user %s (conn: %s)", userID, client.ID)
-		}
-		// Remove all connections for this user
-		delete(Clients, userID)
-	}
-
-	log.Println("🛑 All WebSocket connections closed")
-}
-
-// GetAllClients returns all connected user IDs
-func GetAllClients() []string {
-	ClientsMutex.RLock()
-	defer ClientsMutex.RUnlock()
-
-	clientIDs := make([]string, 0, len(Clients))
-	for userID := range Clients {
-		clientIDs = append(clientIDs, userID)
-	}
-	return clientIDs
-}
-
-// GetAllConnections returns detailed info about all connections
-func GetAllConnections() map[string][]string {
-	ClientsMutex.RLock()
-	defer ClientsMutex.RUnlock()
-
-	result := make(map[string][]string)
-	for userID, connections := range Clients {
-		connIDs := make([]string, len(connections))
-		for i, client := range connections {
-			connIDs[i] = client.ID
 		}
-		result[userID] = connIDs
 	}
-	return result
 }
 
 // BroadcastToUser sends a message to ALL connections of a specific user
 func (h *WebSocketHandler) BroadcastToUser(c *fiber.Ctx) error {
-	userContext := c.Locals("userContext").(*types.UserContext)
+	userContext := c.Locals("UserContext").(types.UserContext)
 	keyWebsocket := userContext.KeyAliasForWebsocket
-	fmt.Println("🚀 ~ file: handler.go ~ line 304 ~ func ~ keyWebsocket : ", keyWebsocket)
 	message := []byte(c.FormValue("message") + " - " + keyWebsocket)
 
 	sent := h.SendToUser(keyWebsocket, message)
@@ -341,46 +291,22 @@ func (h *WebSocketHandler) BroadcastToUser(c *fiber.Ctx) error {
 	})
 }
 
-// SendToUser sends message to all connections of a specific user
+// SendToUser sends message to all connections of a specific user through its message stream, see
+// Notify. The count is of the connections on this instance.
 func (h *WebSocketHandler) SendToUser(userID string, message []byte) int {
-	fmt.Println("🚀 ~ file: handler.go ~ line 324 ~ func ~ userID : ", userID)
-
-	// Get connections with read lock
-	ClientsMutex.RLock()
-	connections := make([]*Client, len(Clients[userID]))
-	copy(connections, Clients[userID])
-	ClientsMutex.RUnlock()
-
-	fmt.Println("🚀 ~ file: handler.go ~ line 327 ~ func ~ connections : ", connections)
-
-	if len(connections) == 0 {
-		log.Printf("⚠️  No connections found for user %s", userID)
-		return 0
+	var payload interface{} = string(message)
+	if json.Valid(message) {
+		payload = json.RawMessage(message)
 	}
-
-	sentCount := 0
-	for _, client := range connections {
-		// Check if client is still active before sending
-		select {
-		case <-client.done:
-			log.Printf("⚠️  Connection closed for user %s (conn: %s)", userID, client.ID)
-			continue
-		default:
-		}
-
-		select {
-		case client.SendChan <- message:
-			sentCount++
-			log.Printf("✅ Message queued for user %s (conn: %s)", userID, client.ID)
-		case <-time.After(100 * time.Millisecond):
-			log.Printf("⚠️  Send channel timeout for user %s (conn: %s)", userID, client.ID)
-		}
+	sent, err := h.hub.Notify(userID, "message", payload)
+	if err != nil {
+		log.Printf("Message for user %s is delivered without sequence id: %v", userID, err)
 	}
-
-	return sentCount
+	return sent
 }
 
-// BroadcastBalance broadcasts balance updates to admins and the specific member
+// BroadcastBalance sends a balance update to the member through its message stream and publishes it
+// to balance.member.<id> for admins, who subscribe to all players with balance.member.*
 func (h *WebSocketHandler) BroadcastBalance(memberID int64, currencyID int64, balance float64) {
 	update := BalanceUpdate{
 		MemberID:  memberID,
@@ -390,123 +316,13 @@ func (h *WebSocketHandler) BroadcastBalance(memberID int64, currencyID int64, ba
 		Topic:     "update_member_balance",
 	}
 
-	data := response.NewResponse(
-		"hello Im under water please help me !",
-		2000,
-		update,
-	)
-	// Marshal message OUTSIDE the lock
-	message, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("❌ Error marshaling balance update: %v", err)
-		return
+	topic := fmt.Sprintf("balance.member.%d", memberID)
+	if _, err := h.hub.Notify(fmt.Sprintf("member%d", memberID), topic, update); err != nil {
+		log.Printf("Balance update of member%d is delivered without sequence id: %v", memberID, err)
 	}
-
-	targetMember := fmt.Sprintf("member%d", memberID)
-
-	// Get snapshot of clients to avoid holding lock during send
-	ClientsMutex.RLock()
-	clientsToSend := make(map[string][]*Client)
-	for userKey, connections := range Clients {
-		// Send only to admin users ("userX") or the member who owns this balance
-		if strings.HasPrefix(userKey, "user") || userKey == targetMember {
-			clientsToSend[userKey] = make([]*Client, len(connections))
-			copy(clientsToSend[userKey], connections)
-		}
-	}
-	ClientsMutex.RUnlock()
-
-	sentCount := 0
-	for userKey, connections := range clientsToSend {
-		fmt.Println("🚀 ~ file: handler.go ~ line 387 ~ broadcasting to userKey : ", userKey)
-
-		for _, client := range connections {
-			// Check if client is still active
-			select {
-			case <-client.done:
-				log.Printf("⚠️ Connection closed for %s (conn %s)", userKey, client.ID)
-				continue
-			default:
-			}
-
-			select {
-			case client.SendChan <- message:
-				sentCount++
-				log.Printf("📤 Sent balance update to %s (conn: %s)", userKey, client.ID)
-			case <-time.After(100 * time.Millisecond):
-				log.Printf("⚠️ Send timeout for %s (conn %s)", userKey, client.ID)
-			}
-		}
-	}
-
-	log.Printf("📤 BroadcastBalance: sent to %d connections (admins + %s)",
-		sentCount, targetMember)
+	h.hub.Publish(topic, update)
 }
 
-// BroadcastBetSettlement broadcasts bet settlement to ALL connected clients
-// func BroadcastBetSettlement(message string, status string, StatusCode int) {
-// 	payload := BetSattlement{
-// 		Time:    time.Now().Format(time.RFC3339),
-// 		Message: message,
-// 		Topic:   "bet_settlement",
-// 	}
-
-// 	var success bool
-// 	switch status {
-// 	case "success":
-// 		success = true
-// 	case "pending":
-// 		success = false
-// 	}
-
-// 	betSettlement := apiresponse.APIResponseData(
-// 		success,
-// 		message,
-// 		StatusCode,
-// 		payload,
-// 	)
-
-// 	// Marshal OUTSIDE the lock
-// 	betSettlementResponse, err := json.Marshal(betSettlement)
-// 	if err != nil {
-// 		log.Printf("❌ Error marshaling bet settlement: %v", err)
-// 		return
-// 	}
-
-// 	// Get snapshot of all clients
-// 	ClientsMutex.RLock()
-// 	allClients := make(map[string][]*Client)
-// 	for userID, connections := range Clients {
-// 		allClients[userID] = make([]*Client, len(connections))
-// 		copy(allClients[userID], connections)
-// 	}
-// 	ClientsMutex.RUnlock()
-
-// 	totalSent := 0
-// 	for userID, connections := range allClients {
-// 		for _, client := range connections {
-// 			// Check if client is still active
-// 			select {
-// 			case <-client.done:
-// 				log.Printf("⚠️ Connection closed for user %s (conn: %s)", userID, client.ID)
-// 				continue
-// 			default:
-// 			}
-
-// 			select {
-// 			case client.SendChan <- betSettlementResponse:
-// 				totalSent++
-// 			case <-time.After(100 * time.Millisecond):
-// 				log.Printf("⚠️  Timeout sending bet settlement to user %s (conn: %s)",
-// 					userID, client.ID)
-// 			}
-// 		}
-// 	}
-
-// 	log.Printf("📤 Bet settlement broadcast sent to %d total connections across %d users",
-// 		totalSent, len(allClients))
-// }
-
 // SendToUsers sends a message to multiple specific users
 func (h *WebSocketHandler) SendToUsers(userIDs []string, message []byte) {
 	for _, uid := range userIDs {
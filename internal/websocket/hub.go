@@ -0,0 +1,408 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+// Slow consumer policies, applied when the send queue of a connection is full
+const (
+	PolicyDropOldest = "drop_oldest" // discard the oldest queued message to make room
+	PolicyDropNewest = "drop_newest" // discard the message being sent
+	PolicyDisconnect = "disconnect"  // close the connection with CloseSlowConsumer
+)
+
+// ReasonSlowConsumer is the close reason of the disconnect policy
+const ReasonSlowConsumer = "slow_consumer"
+
+// ReasonServerShutdown is the close reason of the connections closed by Hub.Close, with code 1001
+const ReasonServerShutdown = "server_shutdown"
+
+var errHubClosed = errors.New("the hub is closed")
+
+// Conn is the WebSocket side of a connection, *websocket.Conn in production
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+// Client represents a single WebSocket connection with metadata
+type Client struct {
+	hub         *Hub          // Hub the connection belongs to
+	ID          string        // Unique connection ID
+	Conn        Conn          // The actual WebSocket connection, nil for Server-Sent Events
+	Transport   string        // TransportWebSocket or TransportSSE
+	UserID      string        // Connection key of the account, see Identity.Key
+	Identity    Identity      // Account verified by the JWT middleware
+	ConnectedAt time.Time     // When this connection was established
+	LastActive  time.Time     // Last activity timestamp, pongs and heartbeats included
+	LastMessage time.Time     // Last message or call of the client, see PresenceService.status
+	SendChan    chan []byte   // Channel for sending messages to this client
+	mu          sync.Mutex    // Mutex for thread-safe operations on this client
+	done        chan struct{} // Signal channel for shutdown
+	closeOnce   sync.Once     // Ensure cleanup only happens once
+
+	topics map[string]struct{} // Subscribed topics, guarded by the mutex of the hub
+
+	closeCode   int    // Close code and reason of a server side close, guarded by mu
+	closeReason string // Server-Sent Events send them as a close envelope
+
+	replaying bool     // Live messages are held back while a replay runs, guarded by mu
+	held      [][]byte // Live messages queued once the replay finished, see Client.endReplay
+
+	sent    atomic.Int64 // Messages queued for the writer
+	dropped atomic.Int64 // Messages lost to the slow consumer policy
+
+	pendingCalls atomic.Int32 // RPC calls waiting for their reply
+	limiter      *tokenBucket // Inbound messages of the connection
+}
+
+// HubOptions configure the send queue of every connection and the limits of inbound traffic, a
+// zero limit is no limit
+type HubOptions struct {
+	SendBuffer   int
+	SlowConsumer string
+
+	MaxMessageSize      int     // Bytes of an inbound message, larger ones close with 1009
+	MessageRate         float64 // Inbound messages per second of a connection
+	MessageBurst        int
+	AccountMessageRate  float64 // Inbound messages per second of all connections of an account
+	AccountMessageBurst int
+	MaxConnections      int // Connections of an account in the whole cluster
+}
+
+// Hub keeps the live connections of this instance and their topic subscriptions. The Redis cluster
+// and the presence service attach themselves when they are started.
+type Hub struct {
+	options HubOptions
+
+	mu            sync.RWMutex
+	clients       map[string][]*Client          // connection key -> connections of the account
+	subscriptions map[string]map[string]*Client // subscribed topic, wildcards included -> connections by ID
+	limiters      map[string]*tokenBucket       // connection key -> inbound messages of the account
+
+	cluster  *Cluster
+	presence *PresenceService
+
+	closed      bool           // Set by Close, guarded by mu
+	connections sync.WaitGroup // Connections until disconnect returned
+}
+
+func NewHub(options HubOptions) *Hub {
+	if options.SendBuffer <= 0 {
+		options.SendBuffer = 256
+	}
+	switch options.SlowConsumer {
+	case PolicyDropOldest, PolicyDropNewest, PolicyDisconnect:
+	default:
+		options.SlowConsumer = PolicyDropOldest
+	}
+
+	return &Hub{
+		options:       options,
+		clients:       make(map[string][]*Client),
+		subscriptions: make(map[string]map[string]*Client),
+		limiters:      make(map[string]*tokenBucket),
+	}
+}
+
+// newClient creates the hub side of a connection, conn is nil for Server-Sent Events
+func (h *Hub) newClient(identity Identity, transport string, conn Conn) *Client {
+	return &Client{
+		hub:         h,
+		ID:          uuid.New().String(), // Unique ID for this specific connection
+		Conn:        conn,
+		Transport:   transport,
+		UserID:      identity.Key,
+		Identity:    identity,
+		ConnectedAt: time.Now(),
+		LastActive:  time.Now(),
+		LastMessage: time.Now(),
+		SendChan:    make(chan []byte, h.options.SendBuffer), // Buffered channel for messages
+		done:        make(chan struct{}),                     // Shutdown signal
+		topics:      make(map[string]struct{}),
+		limiter:     newTokenBucket(h.options.MessageRate, h.options.MessageBurst),
+	}
+}
+
+// connect adds a connection to the hub, the cluster and the presence of its account. A closed hub
+// refuses it, the caller must call disconnect only when it was added.
+func (h *Hub) connect(client *Client) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return errHubClosed
+	}
+	h.connections.Add(1)
+	h.clients[client.UserID] = append(h.clients[client.UserID], client)
+	if _, ok := h.limiters[client.UserID]; !ok {
+		h.limiters[client.UserID] = newTokenBucket(h.options.AccountMessageRate, h.options.AccountMessageBurst)
+	}
+	h.mu.Unlock()
+
+	if h.cluster != nil {
+		h.cluster.connected(client)
+	}
+	if h.presence != nil {
+		h.presence.connected(client)
+	}
+	log.Printf("WebSocket %s connected: %s (%s)", client.Transport, client.UserID, client.ID)
+	return nil
+}
+
+// disconnect closes a connection and removes it with its subscriptions
+func (h *Hub) disconnect(client *Client) {
+	defer h.connections.Done()
+	client.cleanup()
+
+	h.mu.Lock()
+	for topic := range client.topics {
+		h.unsubscribeLocked(client, topic)
+	}
+	connections := h.clients[client.UserID]
+	for i, conn := range connections {
+		if conn.ID == client.ID {
+			h.clients[client.UserID] = append(connections[:i], connections[i+1:]...)
+			break
+		}
+	}
+	if len(h.clients[client.UserID]) == 0 {
+		delete(h.clients, client.UserID)
+		delete(h.limiters, client.UserID)
+	}
+	h.mu.Unlock()
+
+	if h.cluster != nil {
+		h.cluster.disconnected(client)
+	}
+	if h.presence != nil {
+		h.presence.disconnected(client)
+	}
+	log.Printf("WebSocket %s disconnected: %s (%s), sent %d, dropped %d",
+		client.Transport, client.UserID, client.ID, client.sent.Load(), client.dropped.Load())
+}
+
+// cleanup handles safe shutdown of client resources. SendChan stays open, publishers may still
+// hold the client and the writer stops on done.
+func (c *Client) cleanup() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.Conn != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+// enqueue queues a message for the writer of the connection without blocking, a full queue is
+// handled by the slow consumer policy of the hub
+func (h *Hub) enqueue(client *Client, message []byte) bool {
+	select {
+	case <-client.done:
+		return false
+	default:
+	}
+	if client.hold(message) {
+		return true
+	}
+
+	select {
+	case client.SendChan <- message:
+		client.sent.Add(1)
+		return true
+	default:
+	}
+
+	switch h.options.SlowConsumer {
+	case PolicyDropOldest:
+		select {
+		case <-client.SendChan:
+			client.dropped.Add(1)
+		default:
+		}
+		select {
+		case client.SendChan <- message:
+			client.sent.Add(1)
+			return true
+		default:
+		}
+	case PolicyDisconnect:
+		client.dropped.Add(1)
+		client.close(CloseSlowConsumer, ReasonSlowConsumer)
+		return false
+	}
+
+	client.dropped.Add(1)
+	return false
+}
+
+// enqueueWait queues a message and waits for room up to timeout, for replies the client asked for
+// such as a replay, which may be longer than the queue
+func (h *Hub) enqueueWait(client *Client, message []byte, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case client.SendChan <- message:
+		client.sent.Add(1)
+		return true
+	case <-client.done:
+		return false
+	case <-timer.C:
+		client.dropped.Add(1)
+		return false
+	}
+}
+
+// clientsOf returns a snapshot of the connections of an account
+func (h *Hub) clientsOf(key string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	connections := make([]*Client, len(h.clients[key]))
+	copy(connections, h.clients[key])
+	return connections
+}
+
+// allClients returns a snapshot of every connection
+func (h *Hub) allClients() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, connections := range h.clients {
+		clients = append(clients, connections...)
+	}
+	return clients
+}
+
+// sendLocal queues message for the connections of an account on this instance
+func (h *Hub) sendLocal(key string, message []byte) int {
+	sent := 0
+	for _, client := range h.clientsOf(key) {
+		if h.enqueue(client, message) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Subscribe adds already authorized topics to a connection
+func (h *Hub) Subscribe(client *Client, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		if h.subscriptions[topic] == nil {
+			h.subscriptions[topic] = make(map[string]*Client)
+		}
+		h.subscriptions[topic][client.ID] = client
+		client.topics[topic] = struct{}{}
+	}
+}
+
+func (h *Hub) Unsubscribe(client *Client, topics []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range topics {
+		h.unsubscribeLocked(client, topic)
+	}
+}
+
+// unsubscribeLocked removes one subscription, the caller holds the mutex
+func (h *Hub) unsubscribeLocked(client *Client, topic string) {
+	delete(client.topics, topic)
+	if subscribers, ok := h.subscriptions[topic]; ok {
+		delete(subscribers, client.ID)
+		if len(subscribers) == 0 {
+			delete(h.subscriptions, topic)
+		}
+	}
+}
+
+// publishLocal delivers an encoded event to the subscribers on this instance
+func (h *Hub) publishLocal(topic string, message []byte) int {
+	// Snapshot the subscribers, a connection matching several subscriptions gets the event once
+	h.mu.RLock()
+	recipients := make(map[string]*Client)
+	for subscription, subscribers := range h.subscriptions {
+		if !matchTopic(subscription, topic) {
+			continue
+		}
+		for id, client := range subscribers {
+			recipients[id] = client
+		}
+	}
+	h.mu.RUnlock()
+
+	sent := 0
+	for _, client := range recipients {
+		if h.enqueue(client, message) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// localConnectionCounts returns the number of connections of every account on this instance
+func (h *Hub) localConnectionCounts() map[string]interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	counts := make(map[string]interface{}, len(h.clients))
+	for key, connections := range h.clients {
+		counts[key] = len(connections)
+	}
+	return counts
+}
+
+// ConnectionCount returns the number of connections of an account on this instance
+func (h *Hub) ConnectionCount(key string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[key])
+}
+
+// CloseAll closes every connection of this instance with code and reason
+func (h *Hub) CloseAll(code int, reason string) int {
+	clients := h.allClients()
+	for _, client := range clients {
+		client.close(code, reason)
+	}
+	return len(clients)
+}
+
+// Close refuses new connections, closes the open ones as going away and waits until they are
+// disconnected, which also updates the cluster and the presence, or until ctx is done
+func (h *Hub) Close(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+
+	closed := h.CloseAll(websocket.CloseGoingAway, ReasonServerShutdown)
+	log.Printf("Closing %d WebSocket connections", closed)
+
+	done := make(chan struct{})
+	go func() {
+		h.connections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("connections still open: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,389 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/websocket/v2"
+)
+
+// memConn is an in-memory Conn, the test pushes client messages to reads and inspects what the
+// server wrote
+type memConn struct {
+	reads  chan []byte
+	closed chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	writes    [][]byte
+	closeCode int
+	readLimit int64
+	onPong    func(appData string) error
+}
+
+func newMemConn() *memConn {
+	return &memConn{
+		reads:  make(chan []byte, 16),
+		closed: make(chan struct{}),
+	}
+}
+
+func (m *memConn) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-m.reads:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// Like the library, which also sends the 1009 close frame itself
+		if m.readLimit > 0 && int64(len(msg)) > m.readLimit {
+			return 0, nil, websocket.ErrReadLimit
+		}
+		return websocket.TextMessage, msg, nil
+	case <-m.closed:
+		return 0, nil, errors.New("connection closed")
+	}
+}
+
+func (m *memConn) WriteMessage(messageType int, data []byte) error {
+	select {
+	case <-m.closed:
+		return errors.New("connection closed")
+	default:
+	}
+	if messageType == websocket.TextMessage {
+		m.mu.Lock()
+		m.writes = append(m.writes, data)
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+func (m *memConn) WriteControl(messageType int, data []byte, _ time.Time) error {
+	if messageType == websocket.CloseMessage && len(data) >= 2 {
+		m.mu.Lock()
+		m.closeCode = int(data[0])<<8 | int(data[1])
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+func (m *memConn) SetReadDeadline(time.Time) error  { return nil }
+func (m *memConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (m *memConn) SetPongHandler(h func(appData string) error) {
+	m.mu.Lock()
+	m.onPong = h
+	m.mu.Unlock()
+}
+
+// pong answers a ping of the server once the reader installed its handler
+func (m *memConn) pong(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		h := m.onPong
+		m.mu.Unlock()
+		if h != nil {
+			h("")
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("expected a pong handler")
+}
+
+func (m *memConn) SetReadLimit(limit int64) {
+	m.mu.Lock()
+	m.readLimit = limit
+	m.mu.Unlock()
+}
+
+func (m *memConn) Close() error {
+	m.once.Do(func() { close(m.closed) })
+	return nil
+}
+
+// code returns the code of the close frame the server sent
+func (m *memConn) code() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closeCode
+}
+
+// envelopes decodes what the server wrote so far
+func (m *memConn) envelopes(t *testing.T) []Envelope {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	envelopes := make([]Envelope, len(m.writes))
+	for i, data := range m.writes {
+		if err := json.Unmarshal(data, &envelopes[i]); err != nil {
+			t.Fatalf("invalid envelope %s: %v", data, err)
+		}
+	}
+	return envelopes
+}
+
+// waitFor polls until the server wrote n envelopes
+func (m *memConn) waitFor(t *testing.T, n int) []Envelope {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if envelopes := m.envelopes(t); len(envelopes) >= n {
+			return envelopes
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d envelopes, got %v", n, m.envelopes(t))
+	return nil
+}
+
+func testIdentity(kind string, id int64) Identity {
+	prefix := "user"
+	if kind == IdentityPlayer {
+		prefix = "member"
+	}
+	return Identity{
+		Key:          fmt.Sprintf("%s%d", prefix, id),
+		Kind:         kind,
+		ID:           id,
+		LoginSession: fmt.Sprintf("session-%d", id),
+	}
+}
+
+func TestHubConnectDisconnect(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	first := hub.newClient(testIdentity(IdentityUser, 1), TransportWebSocket, newMemConn())
+	second := hub.newClient(testIdentity(IdentityUser, 1), TransportSSE, nil)
+
+	hub.connect(first)
+	hub.connect(second)
+	hub.Subscribe(first, []string{"user.updated"})
+	if got := hub.ConnectionCount("user1"); got != 2 {
+		t.Fatalf("expected 2 connections, got %d", got)
+	}
+
+	hub.disconnect(first)
+	if got := hub.ConnectionCount("user1"); got != 1 {
+		t.Fatalf("expected 1 connection, got %d", got)
+	}
+	if len(hub.subscriptions) != 0 {
+		t.Fatalf("expected the subscriptions of the connection to be removed, got %v", hub.subscriptions)
+	}
+	select {
+	case <-first.done:
+	default:
+		t.Fatal("expected the connection to be closed")
+	}
+
+	hub.disconnect(second)
+	if len(hub.clients) != 0 {
+		t.Fatalf("expected no connections, got %v", hub.clients)
+	}
+}
+
+func TestHubPublishDeliversOncePerConnection(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	client := hub.newClient(testIdentity(IdentityUser, 1), TransportSSE, nil)
+	other := hub.newClient(testIdentity(IdentityUser, 2), TransportSSE, nil)
+	hub.connect(client)
+	hub.connect(other)
+	hub.Subscribe(client, []string{"balance.member.7", "balance.member.*"})
+	hub.Subscribe(other, []string{"balance.member.8"})
+
+	if sent := hub.Publish("balance.member.7", map[string]int{"balance": 10}); sent != 1 {
+		t.Fatalf("expected 1 recipient, got %d", sent)
+	}
+	if len(client.SendChan) != 1 || len(other.SendChan) != 0 {
+		t.Fatalf("expected one message for the subscriber only, got %d and %d", len(client.SendChan), len(other.SendChan))
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(<-client.SendChan, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Type != EnvelopeEvent || envelope.Topic != "balance.member.7" {
+		t.Fatalf("unexpected envelope %+v", envelope)
+	}
+}
+
+func TestHubSlowConsumerPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		queued  []string
+		sent    int64
+		dropped int64
+		closed  bool
+	}{
+		{policy: PolicyDropOldest, queued: []string{"2", "3"}, sent: 3, dropped: 1},
+		{policy: PolicyDropNewest, queued: []string{"1", "2"}, sent: 2, dropped: 1},
+		{policy: PolicyDisconnect, queued: []string{"1", "2"}, sent: 2, dropped: 1, closed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			hub := NewHub(HubOptions{SendBuffer: 2, SlowConsumer: tt.policy})
+			conn := newMemConn()
+			client := hub.newClient(testIdentity(IdentityUser, 1), TransportWebSocket, conn)
+			hub.connect(client)
+
+			for _, message := range []string{"1", "2", "3"} {
+				hub.sendLocal("user1", []byte(message))
+			}
+
+			info := client.info()
+			if info.Sent != tt.sent || info.Dropped != tt.dropped {
+				t.Fatalf("expected %d sent and %d dropped, got %d and %d", tt.sent, tt.dropped, info.Sent, info.Dropped)
+			}
+			if info.QueueDepth != len(tt.queued) || info.QueueCapacity != 2 {
+				t.Fatalf("expected a queue of %d/2, got %d/%d", len(tt.queued), info.QueueDepth, info.QueueCapacity)
+			}
+
+			for _, want := range tt.queued {
+				if got := string(<-client.SendChan); got != want {
+					t.Fatalf("expected message %s, got %s", want, got)
+				}
+			}
+
+			select {
+			case <-client.done:
+				if !tt.closed {
+					t.Fatal("expected the connection to stay open")
+				}
+				if conn.closeCode != CloseSlowConsumer {
+					t.Fatalf("expected close code %d, got %d", CloseSlowConsumer, conn.closeCode)
+				}
+			default:
+				if tt.closed {
+					t.Fatal("expected the connection to be closed")
+				}
+			}
+		})
+	}
+}
+
+func TestHubCloseLocalKeepsSession(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	identity := testIdentity(IdentityPlayer, 5)
+	old := hub.newClient(identity, TransportWebSocket, newMemConn())
+	identity.LoginSession = "replacement"
+	current := hub.newClient(identity, TransportWebSocket, newMemConn())
+	hub.connect(old)
+	hub.connect(current)
+
+	closed := hub.closeLocal(closeRequest{
+		Account:     "member5",
+		KeepSession: "replacement",
+		Code:        CloseSessionInvalidated,
+		Reason:      "session_replaced",
+	})
+	if closed != 1 {
+		t.Fatalf("expected 1 closed connection, got %d", closed)
+	}
+	select {
+	case <-old.done:
+	default:
+		t.Fatal("expected the connection of the replaced session to be closed")
+	}
+	select {
+	case <-current.done:
+		t.Fatal("expected the connection of the new session to stay open")
+	default:
+	}
+}
+
+func TestHubCloseAll(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	conns := []*memConn{newMemConn(), newMemConn()}
+	for i, conn := range conns {
+		hub.connect(hub.newClient(testIdentity(IdentityUser, int64(i)), TransportWebSocket, conn))
+	}
+
+	if closed := hub.CloseAll(websocket.CloseGoingAway, "shutdown"); closed != 2 {
+		t.Fatalf("expected 2 closed connections, got %d", closed)
+	}
+	for _, conn := range conns {
+		if conn.closeCode != websocket.CloseGoingAway {
+			t.Fatalf("expected close code %d, got %d", websocket.CloseGoingAway, conn.closeCode)
+		}
+	}
+}
+
+func TestHandlerServeSubscribeAndPublish(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	h := NewHandler(nil, hub, nil, nil)
+	conn := newMemConn()
+	client := hub.newClient(testIdentity(IdentityUser, 1), TransportWebSocket, conn)
+	hub.connect(client)
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		defer hub.disconnect(client)
+		h.serve(client)
+	}()
+
+	conn.reads <- []byte(`{"action":"subscribe","topics":["user.updated","secret.topic"]}`)
+	envelopes := conn.waitFor(t, 2)
+	if envelopes[0].Type != EnvelopeError || envelopes[0].Topic != "secret.topic" {
+		t.Fatalf("expected the unknown topic to be refused, got %+v", envelopes[0])
+	}
+	if envelopes[1].Type != EnvelopeSubscribed || len(envelopes[1].Topics) != 1 || envelopes[1].Topics[0] != "user.updated" {
+		t.Fatalf("expected the subscription to be confirmed, got %+v", envelopes[1])
+	}
+
+	hub.Publish("user.updated", map[string]string{"uuid": "abc"})
+	envelopes = conn.waitFor(t, 3)
+	if envelopes[2].Type != EnvelopeEvent || envelopes[2].Topic != "user.updated" {
+		t.Fatalf("expected the event, got %+v", envelopes[2])
+	}
+
+	conn.Close()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected serve to return once the connection closed")
+	}
+	if got := hub.ConnectionCount("user1"); got != 0 {
+		t.Fatalf("expected the connection to be removed, got %d", got)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	h := NewHandler(nil, hub, nil, nil)
+	conns := []*memConn{newMemConn(), newMemConn()}
+	for i, conn := range conns {
+		client := hub.newClient(testIdentity(IdentityUser, int64(i)), TransportWebSocket, conn)
+		if err := hub.connect(client); err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			defer hub.disconnect(client)
+			h.serve(client)
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := hub.Close(ctx); err != nil {
+		t.Fatalf("expected every connection to be disconnected: %v", err)
+	}
+	for _, conn := range conns {
+		if conn.code() != websocket.CloseGoingAway {
+			t.Fatalf("expected close code %d, got %d", websocket.CloseGoingAway, conn.code())
+		}
+	}
+	if len(hub.allClients()) != 0 {
+		t.Fatal("expected no connections left")
+	}
+
+	if err := hub.connect(hub.newClient(testIdentity(IdentityUser, 3), TransportSSE, nil)); err == nil {
+		t.Fatal("expected a closed hub to refuse connections")
+	}
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	custom_log "snack-shop/pkg/logs"
+)
+
+// Close reasons of the connections that broke a limit of HubOptions
+const (
+	ReasonRateLimited        = "rate_limited"
+	ReasonTooManyConnections = "too_many_connections"
+)
+
+// tokenBucket allows rate messages per second on average with bursts of up to burst messages, a
+// nil bucket allows everything
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token if one is left
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// allowMessage takes a token of the connection and one of its account for an inbound message. The
+// bucket of the account is shared by its connections on this instance.
+func (h *Hub) allowMessage(client *Client) error {
+	now := time.Now()
+	if !client.limiter.allow(now) {
+		return fmt.Errorf("more than %g messages per second on the connection", h.options.MessageRate)
+	}
+
+	h.mu.RLock()
+	bucket := h.limiters[client.UserID]
+	h.mu.RUnlock()
+	if !bucket.allow(now) {
+		return fmt.Errorf("more than %g messages per second on the account", h.options.AccountMessageRate)
+	}
+	return nil
+}
+
+// admit checks the connection limit of an account before it connects, connections on other
+// instances count as well
+func (h *Hub) admit(ctx context.Context, key string) error {
+	if h.options.MaxConnections <= 0 {
+		return nil
+	}
+	count, err := h.connectionCount(ctx, key)
+	if err != nil {
+		// Without the count of the cluster the connection is let in, like without Redis
+		custom_log.NewCustomLog("websocket_presence_failed", err.Error(), "warn")
+		return nil
+	}
+	if count >= h.options.MaxConnections {
+		return fmt.Errorf("more than %d connections", h.options.MaxConnections)
+	}
+	return nil
+}
+
+// logViolation writes the security log entry of a connection that broke a limit
+func logViolation(identity Identity, connection string, err error) {
+	custom_log.NewCustomLog("websocket_security_violation",
+		fmt.Sprintf("%s `%s` from %s, connection %s: %v", identity.Key, identity.UserName, identity.Ip, connection, err),
+		"warn")
+}
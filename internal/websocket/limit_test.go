@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !bucket.allow(now) {
+			t.Fatalf("expected message %d of the burst to be allowed", i+1)
+		}
+	}
+	if bucket.allow(now) {
+		t.Fatal("expected the bucket to be empty after the burst")
+	}
+	if !bucket.allow(now.Add(500 * time.Millisecond)) {
+		t.Fatal("expected a token after 1/rate seconds")
+	}
+	if bucket.allow(now.Add(500 * time.Millisecond)) {
+		t.Fatal("expected a single token after 1/rate seconds")
+	}
+
+	unlimited := newTokenBucket(0, 0)
+	if !unlimited.allow(now) {
+		t.Fatal("expected a zero rate to allow everything")
+	}
+}
+
+// serveLimited serves a connection of user1 and returns once the server closed it
+func serveLimited(t *testing.T, hub *Hub, messages ...string) *memConn {
+	t.Helper()
+	h := NewHandler(nil, hub, nil, nil)
+	conn := newMemConn()
+	client := hub.newClient(testIdentity(IdentityUser, 1), TransportWebSocket, conn)
+	hub.connect(client)
+	for _, message := range messages {
+		conn.reads <- []byte(message)
+	}
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		defer hub.disconnect(client)
+		h.serve(client)
+	}()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+	return conn
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	subscribe := `{"action":"subscribe","topics":["user.updated"]}`
+
+	hub := NewHub(HubOptions{MessageRate: 1, MessageBurst: 2})
+	conn := serveLimited(t, hub, subscribe, subscribe, subscribe)
+	if conn.code() != CloseRateLimited {
+		t.Fatalf("expected close code %d, got %d", CloseRateLimited, conn.code())
+	}
+
+	// The bucket of the account is shared by its connections
+	hub = NewHub(HubOptions{AccountMessageRate: 1, AccountMessageBurst: 2})
+	hub.connect(hub.newClient(testIdentity(IdentityUser, 1), TransportSSE, nil))
+	hub.limiters["user1"].allow(time.Now())
+	conn = serveLimited(t, hub, subscribe, subscribe)
+	if conn.code() != CloseRateLimited {
+		t.Fatalf("expected close code %d, got %d", CloseRateLimited, conn.code())
+	}
+}
+
+func TestHandlerMessageSize(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	defer func() { log.Logger = logger }()
+
+	hub := NewHub(HubOptions{MaxMessageSize: 64})
+	conn := serveLimited(t, hub, `{"action":"subscribe","topics":["`+strings.Repeat("a", 64)+`"]}`)
+
+	conn.mu.Lock()
+	readLimit := conn.readLimit
+	conn.mu.Unlock()
+	if readLimit != 64 {
+		t.Fatalf("expected a read limit of 64 bytes, got %d", readLimit)
+	}
+	if !strings.Contains(logs.String(), "websocket_security_violation") || !strings.Contains(logs.String(), "message larger than 64 bytes") {
+		t.Fatalf("expected the violation to be logged, got %s", logs.String())
+	}
+	select {
+	case <-conn.closed:
+	default:
+		t.Fatal("expected the connection to be closed")
+	}
+	if got := hub.ConnectionCount("user1"); got != 0 {
+		t.Fatalf("expected the connection to be removed, got %d", got)
+	}
+	if envelopes := conn.envelopes(t); len(envelopes) != 0 {
+		t.Fatalf("expected the message not to be handled, got %v", envelopes)
+	}
+}
+
+func TestHubAdmit(t *testing.T) {
+	hub := NewHub(HubOptions{MaxConnections: 2})
+	for i := 0; i < 2; i++ {
+		if err := hub.admit(t.Context(), "user1"); err != nil {
+			t.Fatalf("expected connection %d to be admitted: %v", i+1, err)
+		}
+		hub.connect(hub.newClient(testIdentity(IdentityUser, 1), TransportSSE, nil))
+	}
+	if err := hub.admit(t.Context(), "user1"); err == nil {
+		t.Fatal("expected a third connection to be refused")
+	}
+	if err := hub.admit(t.Context(), "user2"); err != nil {
+		t.Fatalf("expected the limit to be per account: %v", err)
+	}
+}
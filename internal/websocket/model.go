@@ -1,5 +1,40 @@
 package websocket
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// Identity is the account a connection belongs to, taken from the context the JWT middleware built
+type Identity struct {
+	Key       string // "user<id>" for admin users, "member<id>" for players
+	Kind      string
+	ID        int64
+	UUID      string
+	UserName  string
+	RoleId    uint64
+	UserAgent string
+	Ip        string
+
+	LoginSession string    // Session the token was issued for, re-checked while connected
+	ExpiresAt    time.Time // Expiry of the token
+
+	// Token and language of the upgrade request, RPC calls are made with them
+	token    string
+	language string
+	messages map[string]string // RPC errors translated in language
+}
+
+const (
+	IdentityUser   = "user"
+	IdentityPlayer = "player"
+)
+
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
 type BalanceUpdate struct {
 	MemberID  int64   `json:"member_id"`
 	CurrentID int64   `json:"currency_id"`
@@ -24,3 +59,69 @@ type Data struct {
 	CurrencyID    int     `json:"currency_id"`
 	Balance       float64 `json:"balance"`
 }
+
+// ClientMessage is a control message sent by the client, e.g.
+// {"action":"subscribe","topics":["user.updated","balance.member.42"]}
+// {"action":"ack","id":"1760781234567-0"}
+// {"action":"resume","last_id":"1760781234567-0"}
+// A message with a method is an RPC call, the reply carries the same id, see Method
+// {"id":"7","method":"user.show","params":{"id":12}}
+type ClientMessage struct {
+	Action string          `json:"action"`
+	Topics []string        `json:"topics"`
+	ID     string          `json:"id"`
+	LastID string          `json:"last_id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+	ActionAck         = "ack"
+	ActionResume      = "resume"
+)
+
+// Envelope wraps every message the server sends, events carry the topic they were published to.
+// Events sent with Notify carry the increasing sequence ID of the account's stream, clients ack it
+// and drop IDs they have already seen. The reply to an RPC call carries its id and method, with
+// the response as result or the message, status code and data of the error response.
+type Envelope struct {
+	Type    string      `json:"type"`
+	ID      string      `json:"id,omitempty"`
+	Method  string      `json:"method,omitempty"`
+	Topic   string      `json:"topic,omitempty"`
+	Topics  []string    `json:"topics,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Code    int         `json:"code,omitempty"`
+}
+
+const (
+	EnvelopeEvent        = "event"
+	EnvelopeSubscribed   = "subscribed"
+	EnvelopeUnsubscribed = "unsubscribed"
+	EnvelopeResumed      = "resumed"
+	EnvelopeResult       = "result"
+	EnvelopeClose        = "close"
+	EnvelopeError        = "error"
+)
+
+// Close codes of the connections closed by the server, the reason of the close frame tells more,
+// e.g. 4001 with password_changed. A message over the size limit closes with the standard 1009.
+const (
+	CloseKicked             = 4000
+	CloseSessionInvalidated = 4001
+	CloseSessionExpired     = 4002
+	CloseSlowConsumer       = 4003
+	CloseRateLimited        = 4004
+	CloseTooManyConnections = 4005
+)
+
+// PresenceCount is the number of connections and connected accounts of the whole cluster
+type PresenceCount struct {
+	Instances   int `json:"instances"`
+	Connections int `json:"connections"`
+	Accounts    int `json:"accounts"`
+}
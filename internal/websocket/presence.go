@@ -0,0 +1,389 @@
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"snack-shop/pkg/constants"
+	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
+	types "snack-shop/pkg/model"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// The presence of an account is cached in a Redis hash with its last status, the unix time it was
+// last seen and the unix time of its last message, every instance pushes the activity of its
+// connections there
+const (
+	presenceAccountPrefix = "presence:"
+	presenceCacheTTL      = 7 * 24 * time.Hour
+	presenceSweepInterval = 30 * time.Second
+	maxPresenceIDs        = 100
+)
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// accountKeyPattern matches the connection keys of Identity, user<id> or member<id>
+var accountKeyPattern = regexp.MustCompile(`^(user|member)(\d+)$`)
+
+// touchScript moves last_seen and last_message forward only, instances may report activity out of
+// order
+var touchScript = redis.NewScript(`
+local seen = tonumber(redis.call('HGET', KEYS[1], 'last_seen') or '0')
+if tonumber(ARGV[1]) > seen then
+	redis.call('HSET', KEYS[1], 'last_seen', ARGV[1])
+end
+local message = tonumber(redis.call('HGET', KEYS[1], 'last_message') or '0')
+if tonumber(ARGV[2]) > message then
+	redis.call('HSET', KEYS[1], 'last_message', ARGV[2])
+end
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return 0
+`)
+
+// Presence is the status of an account, it is away when none of its connections sent a message or
+// call for PresenceOptions.AwayAfter. Pings and heartbeats only move LastSeen.
+type Presence struct {
+	Key      string     `json:"key"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen"`
+}
+
+type PresenceOptions struct {
+	AwayAfter time.Duration
+}
+
+// PresenceService tracks online, away and offline per user and player. Changes are published to
+// presence.<key>, the last seen time is cached in Redis and kept in Postgres once offline.
+type PresenceService struct {
+	hub     *Hub
+	db      *sqlx.DB
+	redis   *redis.Client
+	options PresenceOptions
+}
+
+// NewPresenceService attaches the presence tracking to the connections of hub
+func NewPresenceService(hub *Hub, db *sqlx.DB, rdb *redis.Client, options PresenceOptions) *PresenceService {
+	p := &PresenceService{
+		hub:     hub,
+		db:      db,
+		redis:   rdb,
+		options: options,
+	}
+	hub.presence = p
+	return p
+}
+
+// Start pushes the activity of the local connections and publishes away changes until ctx is done
+func (p *PresenceService) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(presenceSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.sweep(ctx)
+			}
+		}
+	}()
+}
+
+// connected and disconnected run after the connection was added to or removed from the hub and
+// the cluster, so the connection count is already up to date
+func (p *PresenceService) connected(client *Client) {
+	ctx := context.Background()
+	now := time.Now()
+	p.touch(ctx, client.UserID, activity{Seen: now, Message: now})
+	p.refresh(ctx, client.UserID)
+}
+
+func (p *PresenceService) disconnected(client *Client) {
+	ctx := context.Background()
+	p.touch(ctx, client.UserID, activity{Seen: time.Now()})
+	p.refresh(ctx, client.UserID)
+}
+
+func (p *PresenceService) sweep(ctx context.Context) {
+	for key, active := range p.hub.localActivity() {
+		p.touch(ctx, key, active)
+		p.refresh(ctx, key)
+	}
+}
+
+func (p *PresenceService) touch(ctx context.Context, key string, active activity) {
+	var message int64
+	if !active.Message.IsZero() {
+		message = active.Message.Unix()
+	}
+	err := touchScript.Run(ctx, p.redis, []string{presenceAccountPrefix + key},
+		active.Seen.Unix(), message, int(presenceCacheTTL.Seconds())).Err()
+	if err != nil && err != redis.Nil {
+		custom_log.NewCustomLog("presence_update_failed", err.Error(), "warn")
+	}
+}
+
+// refresh publishes the presence of an account when its status changed, going offline also
+// stores the last seen time in Postgres
+func (p *PresenceService) refresh(ctx context.Context, key string) {
+	presence, err := p.current(ctx, key)
+	if err != nil {
+		custom_log.NewCustomLog("presence_update_failed", err.Error(), "warn")
+		return
+	}
+
+	cacheKey := presenceAccountPrefix + key
+	previous, err := p.redis.HGet(ctx, cacheKey, "status").Result()
+	if err != nil && err != redis.Nil {
+		custom_log.NewCustomLog("presence_update_failed", err.Error(), "warn")
+		return
+	}
+	if previous == presence.Status {
+		return
+	}
+	if err := p.redis.HSet(ctx, cacheKey, "status", presence.Status).Err(); err != nil {
+		custom_log.NewCustomLog("presence_update_failed", err.Error(), "warn")
+		return
+	}
+
+	if presence.Status == PresenceOffline && presence.LastSeen != nil {
+		if err := p.storeLastSeen(key, *presence.LastSeen); err != nil {
+			custom_log.NewCustomLog("presence_update_failed", err.Error(), "warn")
+		}
+	}
+	p.hub.Publish("presence."+key, presence)
+}
+
+// current computes the presence from the live connections of the cluster and the cached activity
+func (p *PresenceService) current(ctx context.Context, key string) (*Presence, error) {
+	count, err := p.hub.connectionCount(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := p.redis.HMGet(ctx, presenceAccountPrefix+key, "last_seen", "last_message").Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read presence: %w", err)
+	}
+	var seen, message int64
+	if len(values) == 2 {
+		seen, _ = strconv.ParseInt(fmt.Sprint(values[0]), 10, 64)
+		message, _ = strconv.ParseInt(fmt.Sprint(values[1]), 10, 64)
+	}
+
+	presence := &Presence{Key: key}
+	if seen > 0 {
+		lastSeen := inLocation(time.Unix(seen, 0))
+		presence.LastSeen = &lastSeen
+	}
+	presence.Status = p.status(count, time.Unix(message, 0))
+	return presence, nil
+}
+
+// status is offline without connections and away when the last message or call is older than
+// AwayAfter. Event streams cannot send messages, they turn away AwayAfter after they connected.
+func (p *PresenceService) status(connections int, lastMessage time.Time) string {
+	switch {
+	case connections == 0:
+		return PresenceOffline
+	case time.Since(lastMessage) > p.options.AwayAfter:
+		return PresenceAway
+	default:
+		return PresenceOnline
+	}
+}
+
+// List returns the presence of accounts by connection key, the last seen time of accounts that
+// are not cached is loaded from Postgres
+func (p *PresenceService) List(ctx context.Context, keys []string) ([]Presence, error) {
+	presences := make([]Presence, 0, len(keys))
+	for _, key := range keys {
+		presence, err := p.current(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if presence.LastSeen == nil {
+			lastSeen, err := p.loadLastSeen(key)
+			if err != nil {
+				return nil, err
+			}
+			if lastSeen != nil {
+				p.touch(ctx, key, activity{Seen: *lastSeen})
+				presence.LastSeen = lastSeen
+			}
+		}
+		presences = append(presences, *presence)
+	}
+	return presences, nil
+}
+
+func (p *PresenceService) storeLastSeen(key string, seen time.Time) error {
+	table, id, err := presenceTable(key)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`UPDATE %s SET last_seen_at = $1 WHERE id = $2`, table)
+	if _, err := p.db.Exec(query, inLocation(seen), id); err != nil {
+		return fmt.Errorf("failed to store last seen of %s: %w", key, err)
+	}
+	return nil
+}
+
+func (p *PresenceService) loadLastSeen(key string) (*time.Time, error) {
+	table, id, err := presenceTable(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastSeen sql.NullTime
+	query := fmt.Sprintf(`SELECT last_seen_at FROM %s WHERE id = $1 AND deleted_at IS NULL`, table)
+	if err := p.db.Get(&lastSeen, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load last seen of %s: %w", key, err)
+	}
+	if !lastSeen.Valid {
+		return nil, nil
+	}
+
+	// The column holds the wall clock of APP_TIMEZONE
+	location, err := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load location: %w", err)
+	}
+	t := lastSeen.Time
+	seen := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+	return &seen, nil
+}
+
+// presenceTable resolves a connection key to its table and row ID
+func presenceTable(key string) (string, int64, error) {
+	match := accountKeyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return "", 0, fmt.Errorf("invalid account `%s`", key)
+	}
+	id, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid account `%s`", key)
+	}
+	if match[1] == "user" {
+		return "tbl_users", id, nil
+	}
+	return "tbl_players", id, nil
+}
+
+// inLocation converts to the APP_TIMEZONE the timestamps of the database are written in
+func inLocation(t time.Time) time.Time {
+	location, err := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
+	if err != nil {
+		return t
+	}
+	return t.In(location)
+}
+
+// connectionCount counts the connections of an account on every instance
+func (h *Hub) connectionCount(ctx context.Context, key string) (int, error) {
+	if h.cluster == nil {
+		return h.ConnectionCount(key), nil
+	}
+	return h.cluster.connectionCount(ctx, key)
+}
+
+// activity is the latest activity of the connections of an account. Seen is moved by pings and
+// heartbeats as well, Message only by the messages and calls of the client.
+type activity struct {
+	Seen    time.Time
+	Message time.Time
+}
+
+// localActivity returns the latest activity of every account on this instance
+func (h *Hub) localActivity() map[string]activity {
+	clients := h.allClients()
+	accounts := make(map[string]activity)
+	for _, client := range clients {
+		client.mu.Lock()
+		seen, message := client.LastActive, client.LastMessage
+		client.mu.Unlock()
+
+		active := accounts[client.UserID]
+		if seen.After(active.Seen) {
+			active.Seen = seen
+		}
+		if message.After(active.Message) {
+			active.Message = message
+		}
+		accounts[client.UserID] = active
+	}
+	return accounts
+}
+
+// AccountPresence returns the presence of accounts given as ?ids=user12,member42, it is for admin
+// users only
+func (h *WebSocketHandler) AccountPresence(c *fiber.Ctx) error {
+	if _, ok := c.Locals("UserContext").(types.UserContext); !ok {
+		return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+			utils.Translate("presence_failed", nil, c),
+			constants.PresenceFailed,
+			fmt.Errorf("only admin users can read the presence"),
+		))
+	}
+
+	var keys []string
+	for _, key := range strings.Split(c.Query("ids"), ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if !accountKeyPattern.MatchString(key) {
+			return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+				utils.Translate("presence_failed", nil, c),
+				constants.PresenceFailed,
+				fmt.Errorf("invalid account `%s`, expected user<id> or member<id>", key),
+			))
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 || len(keys) > maxPresenceIDs {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("presence_failed", nil, c),
+			constants.PresenceFailed,
+			fmt.Errorf("ids must list between 1 and %d accounts", maxPresenceIDs),
+		))
+	}
+
+	presences, err := h.presence.List(c.Context(), keys)
+	if err != nil {
+		custom_log.NewCustomLog("presence_failed", err.Error(), "error")
+		return c.Status(http.StatusInternalServerError).JSON(response.NewResponseError(
+			utils.Translate("presence_failed", nil, c),
+			constants.PresenceFailed,
+			fmt.Errorf("cannot read the presence"),
+		))
+	}
+
+	return c.Status(http.StatusOK).JSON(response.NewResponse(
+		utils.Translate("presence_success", nil, c),
+		constants.PresenceSuccess,
+		presences,
+	))
+}
@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresenceIdleConnectionTurnsAway(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	h := NewHandler(nil, hub, nil, nil)
+	presence := &PresenceService{hub: hub, options: PresenceOptions{AwayAfter: 50 * time.Millisecond}}
+	conn := newMemConn()
+	client := hub.newClient(testIdentity(IdentityUser, 1), TransportWebSocket, conn)
+	hub.connect(client)
+	defer conn.Close()
+	go func() {
+		defer hub.disconnect(client)
+		h.serve(client)
+	}()
+
+	status := func() (string, activity) {
+		active := hub.localActivity()["user1"]
+		return presence.status(hub.ConnectionCount("user1"), active.Message), active
+	}
+	if got, _ := status(); got != PresenceOnline {
+		t.Fatalf("expected a new connection to be online, got %s", got)
+	}
+
+	// Pings keep the connection alive but are no activity of the user
+	time.Sleep(80 * time.Millisecond)
+	conn.pong(t)
+	got, active := status()
+	if got != PresenceAway {
+		t.Fatalf("expected an idle connection with pings to be away, got %s", got)
+	}
+	if time.Since(active.Seen) > 50*time.Millisecond {
+		t.Fatalf("expected the pong to move last seen, got %s", active.Seen)
+	}
+
+	conn.reads <- []byte(`{"action":"subscribe","topics":["user.updated"]}`)
+	conn.waitFor(t, 1)
+	if got, _ := status(); got != PresenceOnline {
+		t.Fatalf("expected a message to bring the connection back online, got %s", got)
+	}
+}
+
+func TestPresenceStatus(t *testing.T) {
+	presence := &PresenceService{options: PresenceOptions{AwayAfter: time.Minute}}
+	if got := presence.status(0, time.Now()); got != PresenceOffline {
+		t.Fatalf("expected offline without connections, got %s", got)
+	}
+	if got := presence.status(1, time.Now().Add(-2*time.Minute)); got != PresenceAway {
+		t.Fatalf("expected away after AwayAfter, got %s", got)
+	}
+	if got := presence.status(2, time.Now()); got != PresenceOnline {
+		t.Fatalf("expected online, got %s", got)
+	}
+}
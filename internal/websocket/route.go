@@ -1,63 +1,104 @@
 package websocket
 
 import (
-	"log"
+	"context"
+	"os"
+	"sync"
+	"time"
 
-	jwt "snack-shop/pkg/jwt"
+	"snack-shop/pkg/events"
+	"snack-shop/pkg/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
 )
 
-func WebSocketRoute(root fiber.Router, db *sqlx.DB, jwtMiddleware fiber.Handler) {
-	// Handler instance
-	wsHandler := NewHandler(db)
-
-	ws := root.Group("/websocket")
+// WebSocketRoute struct
+type WebSocketRoute struct {
+	app     *fiber.App
+	db      *sqlx.DB
+	hub     *Hub
+	handler *WebSocketHandler
+}
 
-	ws.Get("/ws", func(c *fiber.Ctx) error {
+// NewWebSocketRoute starts the background work of the hub, it stops when ctx is done and wg is done
+// once it finished
+func NewWebSocketRoute(ctx context.Context, wg *sync.WaitGroup, app *fiber.App, db *sqlx.DB, rdb *redis.Client) *WebSocketRoute {
+	hub := NewHub(HubOptions{
+		SendBuffer:   utils.GetenvInt("WEBSOCKET_SEND_BUFFER", 256),
+		SlowConsumer: os.Getenv("WEBSOCKET_SLOW_CONSUMER"),
+
+		MaxMessageSize:      utils.GetenvInt("WEBSOCKET_MAX_MESSAGE_SIZE", 4096),
+		MessageRate:         float64(utils.GetenvInt("WEBSOCKET_MESSAGE_RATE", 10)),
+		MessageBurst:        utils.GetenvInt("WEBSOCKET_MESSAGE_BURST", 20),
+		AccountMessageRate:  float64(utils.GetenvInt("WEBSOCKET_ACCOUNT_MESSAGE_RATE", 20)),
+		AccountMessageBurst: utils.GetenvInt("WEBSOCKET_ACCOUNT_MESSAGE_BURST", 40),
+		MaxConnections:      utils.GetenvInt("WEBSOCKET_MAX_CONNECTIONS", 10),
+	})
 
-		log.Println("➡️ Incoming request to /websocket/ws")
+	// Replicas exchange hub messages and presence through Redis
+	StartCluster(ctx, wg, hub, rdb, ClusterOptions{
+		StreamMaxLen: int64(utils.GetenvInt("WEBSOCKET_STREAM_MAXLEN", 1000)),
+		StreamTTL:    time.Duration(utils.GetenvInt("WEBSOCKET_STREAM_TTL", 604800)) * time.Second,
+	})
 
-		// Must be websocket upgrade
-		if !websocket.IsWebSocketUpgrade(c) {
-			log.Println("❌ Not a WebSocket upgrade request")
-			return fiber.ErrUpgradeRequired
+	presence := NewPresenceService(hub, db, rdb, PresenceOptions{
+		AwayAfter: time.Duration(utils.GetenvInt("PRESENCE_AWAY_AFTER", 300)) * time.Second,
+	})
+	presence.Start(ctx, wg)
+
+	// Domain events go to the subscribers of the topic of the same name, e.g. user.created, an
+	// invalidated session closes the connections bound to it
+	events.Subscribe(func(event events.Event) {
+		if session, ok := event.Payload.(events.Session); ok && event.Name == events.SessionInvalidated {
+			hub.closeInvalidatedSession(session)
+			return
 		}
+		hub.Publish(event.Name, event.Payload)
+	})
+	StartSessionCheck(ctx, wg, hub, db, rdb,
+		time.Duration(utils.GetenvInt("WEBSOCKET_SESSION_CHECK", 60))*time.Second)
 
-		log.Println("🔄 WebSocket upgrade requested")
-
-		// Validate JWT if "Upgrade: websocket" header exists
-		if websocketUpgrade := c.Get("Upgrade"); websocketUpgrade == "websocket" {
-			log.Println("🔐 Checking JWT token in WebSocket request")
-
-			if err := jwt.ExtractUserFromWebSocketToken(c); err != nil {
-				log.Println("❌ JWT validation failed:", err)
-				return err
-			}
+	// Clients call routes of the API over their connection, see Method
+	rpc := NewRPC(app, RPCOptions{
+		Timeout: time.Duration(utils.GetenvInt("WEBSOCKET_RPC_TIMEOUT", 10)) * time.Second,
+	})
 
-			log.Println("✅ JWT validated successfully")
-		}
+	return &WebSocketRoute{
+		app:     app,
+		db:      db,
+		hub:     hub,
+		handler: NewHandler(db, hub, presence, rpc),
+	}
+}
 
-		// Mark connection as allowed
-		c.Locals("allowed", true)
+// Close sends a close frame to every WebSocket and event stream and waits until they are gone, see
+// Hub.Close
+func (w *WebSocketRoute) Close(ctx context.Context) error {
+	return w.hub.Close(ctx)
+}
 
-		// Upgrade to websocket
-		return websocket.New(func(conn *websocket.Conn) {
+// RegisterWebSocketRoute mounts the hub behind the JWT middleware, which verifies the token of the
+// Sec-WebSocket-Protocol header and the login session the same way as for HTTP requests
+func (w *WebSocketRoute) RegisterWebSocketRoute() *WebSocketRoute {
+	ws := w.app.Group("/websocket")
+	ws.Get("/ws", w.handler.Upgrade, websocket.New(w.handler.HandleWebSocket, websocket.Config{
+		Subprotocols: []string{"Bearer"},
+	}))
+	ws.Get("/presence", w.handler.Presence)
 
-			log.Println("🌐 WebSocket connected!")
+	// Connection administration, admin users only
+	ws.Get("/connections", w.handler.Connections)
+	ws.Post("/connections/:id/kick", w.handler.KickConnection)
+	ws.Post("/accounts/:key/kick", w.handler.KickAccount)
 
-			// Handle disconnect
-			defer func() {
-				log.Println("🔌 WebSocket disconnected")
-			}()
+	// Server-Sent Events fallback of the hub for clients behind proxies without WebSocket support
+	w.app.Get("/api/v1/events", w.handler.Events)
 
-			// Actual handler
-			wsHandler.HandleWebSocket(conn)
+	// Online, away or offline of users and players, changes are published to presence.<key>
+	w.app.Get("/api/v1/presence", w.handler.AccountPresence)
 
-		}, websocket.Config{
-			Subprotocols: []string{"Bearer"},
-		})(c)
-	})
+	return w
 }
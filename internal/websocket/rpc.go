@@ -0,0 +1,334 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"snack-shop/pkg/constants"
+	custom_log "snack-shop/pkg/logs"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// A connection may wait for maxPendingCalls replies at a time, further calls are refused
+const maxPendingCalls = 16
+
+// Method maps an RPC method to a route of the API. A call runs through the same middleware and
+// handler as the HTTP request with the token and language of the connection, so authorization,
+// validation and translations are those of the route. The params fill the :name segments of
+// Path, the rest is the query of GET and DELETE or the JSON body of the other methods.
+type Method struct {
+	HTTPMethod string
+	Path       string
+	Timeout    time.Duration // Zero for RPCOptions.Timeout
+}
+
+var (
+	methods      = make(map[string]Method)
+	methodsMutex = &sync.RWMutex{}
+)
+
+var pathParamPattern = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+func init() {
+	RegisterMethod("user.info", Method{HTTPMethod: fiber.MethodGet, Path: "/api/v1/user/info"})
+	RegisterMethod("user.list", Method{HTTPMethod: fiber.MethodGet, Path: "/api/v1/user"})
+	RegisterMethod("user.show", Method{HTTPMethod: fiber.MethodGet, Path: "/api/v1/user/:id"})
+	RegisterMethod("player.list", Method{HTTPMethod: fiber.MethodGet, Path: "/api/v1/player"})
+	RegisterMethod("player.show", Method{HTTPMethod: fiber.MethodGet, Path: "/api/v1/player/:id"})
+	RegisterMethod("presence.list", Method{HTTPMethod: fiber.MethodGet, Path: "/api/v1/presence"})
+	RegisterMethod("websocket.connections", Method{HTTPMethod: fiber.MethodGet, Path: "/websocket/connections"})
+}
+
+// RegisterMethod adds or replaces an RPC method
+func RegisterMethod(name string, method Method) {
+	methodsMutex.Lock()
+	defer methodsMutex.Unlock()
+	methods[name] = method
+}
+
+func lookupMethod(name string) (Method, bool) {
+	methodsMutex.RLock()
+	defer methodsMutex.RUnlock()
+	method, ok := methods[name]
+	return method, ok
+}
+
+// RPC errors that do not come from a route are translated when the connection is upgraded, the
+// request context is gone afterwards
+var rpcMessageIDs = []string{
+	"websocket_rpc_unknown_method",
+	"websocket_rpc_invalid_params",
+	"websocket_rpc_timeout",
+	"websocket_rpc_busy",
+}
+
+func translateRPCMessages(c *fiber.Ctx) map[string]string {
+	messages := make(map[string]string, len(rpcMessageIDs))
+	for _, id := range rpcMessageIDs {
+		messages[id] = utils.Translate(id, nil, c)
+	}
+	return messages
+}
+
+var errCallTimeout = errors.New("call timed out")
+
+type RPCOptions struct {
+	Timeout time.Duration
+}
+
+// RPC calls the routes of the app for the connections
+type RPC struct {
+	app     *fiber.App
+	options RPCOptions
+
+	once    sync.Once
+	handler fasthttp.RequestHandler
+}
+
+func NewRPC(app *fiber.App, options RPCOptions) *RPC {
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	return &RPC{
+		app:     app,
+		options: options,
+	}
+}
+
+// handleCall runs a call of the client without blocking its reader and sends the reply
+func (h *WebSocketHandler) handleCall(client *Client, message ClientMessage) {
+	reply := Envelope{Type: EnvelopeError, ID: message.ID, Method: message.Method, Code: constants.WebSocketRPCFailed}
+
+	method, ok := lookupMethod(message.Method)
+	if !ok || h.rpc == nil {
+		reply.Error = client.Identity.messages["websocket_rpc_unknown_method"]
+		client.reply(reply)
+		return
+	}
+	if message.ID == "" {
+		reply.Error = client.Identity.messages["websocket_rpc_invalid_params"]
+		client.reply(reply)
+		return
+	}
+	if client.pendingCalls.Add(1) > maxPendingCalls {
+		client.pendingCalls.Add(-1)
+		reply.Error = client.Identity.messages["websocket_rpc_busy"]
+		client.reply(reply)
+		return
+	}
+
+	go func() {
+		defer client.pendingCalls.Add(-1)
+
+		status, body, err := h.rpc.call(client.Identity, method, message.Params)
+		switch {
+		case errors.Is(err, errCallTimeout):
+			reply.Error = client.Identity.messages["websocket_rpc_timeout"]
+		case err != nil:
+			reply.Error = client.Identity.messages["websocket_rpc_invalid_params"]
+			reply.Payload = err.Error()
+		default:
+			reply = callReply(reply, status, body)
+		}
+		client.reply(reply)
+	}()
+}
+
+// callReply turns the response of a route into the reply of the call
+func callReply(reply Envelope, status int, body []byte) Envelope {
+	var result interface{} = string(body)
+	if json.Valid(body) {
+		result = json.RawMessage(body)
+	}
+	if status < http.StatusBadRequest {
+		reply.Type = EnvelopeResult
+		reply.Code = 0
+		reply.Result = result
+		return reply
+	}
+
+	// Error responses of the handlers, see response.NewResponseError. Others such as a missing
+	// route are plain text.
+	var errorResponse struct {
+		Message    string          `json:"message"`
+		StatusCode int             `json:"status_code"`
+		Data       json.RawMessage `json:"data"`
+		Error      string          `json:"error"`
+	}
+	reply.Code = status
+	if err := json.Unmarshal(body, &errorResponse); err != nil {
+		reply.Error = string(body)
+		return reply
+	}
+	reply.Error = errorResponse.Message
+	if reply.Error == "" {
+		reply.Error = errorResponse.Error
+	}
+	if errorResponse.StatusCode != 0 {
+		reply.Code = errorResponse.StatusCode
+	}
+	if len(errorResponse.Data) > 0 {
+		reply.Payload = errorResponse.Data
+	}
+	return reply
+}
+
+// call runs the route of method as a request of identity and returns its status and body, or
+// errCallTimeout once the timeout of the method passed
+func (r *RPC) call(identity Identity, method Method, params json.RawMessage) (int, []byte, error) {
+	request, err := method.request(params)
+	if err != nil {
+		return 0, nil, err
+	}
+	request.Header.Set(fiber.HeaderAuthorization, "Bearer "+identity.token)
+	request.Header.Set(fiber.HeaderAcceptLanguage, identity.language)
+	request.Header.Set(fiber.HeaderUserAgent, identity.UserAgent)
+
+	// The tree of routes is built once the app listens, it is complete by the first call
+	r.once.Do(func() {
+		r.handler = r.app.Handler()
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(request, &net.TCPAddr{IP: net.ParseIP(identity.Ip)}, nil)
+
+	// A handler cannot be interrupted, on timeout it finishes in the background and its
+	// response is dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.handler(ctx)
+	}()
+
+	timeout := method.Timeout
+	if timeout <= 0 {
+		timeout = r.options.Timeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return ctx.Response.StatusCode(), ctx.Response.Body(), nil
+	case <-timer.C:
+		custom_log.NewCustomLog("websocket_rpc_timeout",
+			fmt.Sprintf("%s %s did not answer within %s", method.HTTPMethod, method.Path, timeout), "warn")
+		return 0, nil, errCallTimeout
+	}
+}
+
+// request builds the HTTP request of a call from its params
+func (m Method) request(params json.RawMessage) (*fasthttp.Request, error) {
+	values := make(map[string]interface{})
+	if len(params) > 0 && string(params) != "null" {
+		decoder := json.NewDecoder(strings.NewReader(string(params)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return nil, fmt.Errorf("params must be an object: %w", err)
+		}
+	}
+
+	var errPath error
+	path := pathParamPattern.ReplaceAllStringFunc(m.Path, func(segment string) string {
+		name := segment[1:]
+		value, ok := values[name]
+		if !ok {
+			errPath = fmt.Errorf("missing param `%s`", name)
+			return segment
+		}
+		delete(values, name)
+
+		// fasthttp decodes and normalizes the path, a value must not leave its segment or it could
+		// reach any route
+		param := paramString(value)
+		if param == "" || param == "." || param == ".." || strings.ContainsAny(param, `/\`) {
+			errPath = fmt.Errorf("invalid param `%s`", name)
+			return segment
+		}
+		return url.PathEscape(param)
+	})
+	if errPath != nil {
+		return nil, errPath
+	}
+
+	request := &fasthttp.Request{}
+	request.Header.SetMethod(m.HTTPMethod)
+	if m.HTTPMethod == fiber.MethodGet || m.HTTPMethod == fiber.MethodDelete {
+		query := url.Values{}
+		for name, value := range values {
+			addQuery(query, name, value)
+		}
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+	} else {
+		body, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.SetContentType(fiber.MIMEApplicationJSON)
+		request.SetBody(body)
+	}
+	request.SetRequestURI(path)
+	return request, nil
+}
+
+// addQuery encodes a param the way the query parsers of the handlers read it, lists of values as
+// repeated keys and objects with brackets, e.g. filters[0][value]
+func addQuery(query url.Values, name string, value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range value {
+			addQuery(query, fmt.Sprintf("%s[%s]", name, key), nested)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			switch nested.(type) {
+			case map[string]interface{}, []interface{}:
+				addQuery(query, fmt.Sprintf("%s[%d]", name, i), nested)
+			default:
+				query.Add(name, paramString(nested))
+			}
+		}
+	default:
+		query.Add(name, paramString(value))
+	}
+}
+
+func paramString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// reply queues the reply of a call, it waits for room like a replay since the client is waiting
+// for it
+func (c *Client) reply(envelope Envelope) {
+	message, err := json.Marshal(envelope)
+	if err != nil {
+		custom_log.NewCustomLog("websocket_rpc_failed", err.Error(), "error")
+		return
+	}
+	c.hub.enqueueWait(c, message, replayWait)
+}
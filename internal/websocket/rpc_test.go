@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	response "snack-shop/pkg/http/response"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMethodRequest(t *testing.T) {
+	method := Method{HTTPMethod: fiber.MethodGet, Path: "/api/v1/user/:id/status"}
+	request, err := method.request(json.RawMessage(`{"id":12,"page":2,"ids":["a","b"],"filters":[{"field":"status","value":"active"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := request.URI().QueryArgs()
+	if path := string(request.URI().Path()); path != "/api/v1/user/12/status" {
+		t.Fatalf("unexpected path %s", path)
+	}
+	if args.Has("id") || string(args.Peek("page")) != "2" || len(args.PeekMulti("ids")) != 2 {
+		t.Fatalf("unexpected query %s", args.String())
+	}
+	if value := string(args.Peek("filters[0][value]")); value != "active" {
+		t.Fatalf("expected the filter in brackets, got %s", args.String())
+	}
+
+	method = Method{HTTPMethod: fiber.MethodPut, Path: "/api/v1/user/:id"}
+	request, err = method.request(json.RawMessage(`{"id":"7","name":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(request.Body()); body != `{"name":"a"}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+
+	if _, err := method.request(json.RawMessage(`{"name":"a"}`)); err == nil {
+		t.Fatal("expected the missing path param to be refused")
+	}
+	if _, err := method.request(json.RawMessage(`[1]`)); err == nil {
+		t.Fatal("expected params other than an object to be refused")
+	}
+
+	for _, id := range []string{`"../../../websocket/connections"`, `".."`, `"."`, `"a/b"`, `"a\\b"`, `""`} {
+		if _, err := method.request(json.RawMessage(`{"id":` + id + `}`)); err == nil {
+			t.Fatalf("expected the path param %s to be refused", id)
+		}
+	}
+}
+
+func TestHandlerCall(t *testing.T) {
+	app := fiber.New()
+	app.Get("/test/echo/:id", func(c *fiber.Ctx) error {
+		return c.Status(http.StatusOK).JSON(response.NewResponse("ok", 1, fiber.Map{
+			"id":            c.Params("id"),
+			"name":          c.Query("name"),
+			"authorization": c.Get(fiber.HeaderAuthorization),
+			"language":      c.Get(fiber.HeaderAcceptLanguage),
+		}))
+	})
+	app.Get("/test/forbidden", func(c *fiber.Ctx) error {
+		return c.Status(http.StatusForbidden).JSON(response.NewResponseError("denied", 2, fmt.Errorf("not allowed")))
+	})
+	app.Get("/test/slow", func(c *fiber.Ctx) error {
+		time.Sleep(200 * time.Millisecond)
+		return c.SendStatus(http.StatusOK)
+	})
+	RegisterMethod("test.echo", Method{HTTPMethod: fiber.MethodGet, Path: "/test/echo/:id"})
+	RegisterMethod("test.forbidden", Method{HTTPMethod: fiber.MethodGet, Path: "/test/forbidden"})
+	RegisterMethod("test.slow", Method{HTTPMethod: fiber.MethodGet, Path: "/test/slow", Timeout: 20 * time.Millisecond})
+
+	hub := NewHub(HubOptions{})
+	h := NewHandler(nil, hub, nil, NewRPC(app, RPCOptions{}))
+	identity := testIdentity(IdentityUser, 1)
+	identity.token = "token"
+	identity.language = "en"
+	identity.messages = map[string]string{
+		"websocket_rpc_unknown_method": "unknown method",
+		"websocket_rpc_timeout":        "timed out",
+	}
+	client := hub.newClient(identity, TransportSSE, nil)
+	hub.connect(client)
+	defer hub.disconnect(client)
+
+	call := func(message string) Envelope {
+		t.Helper()
+		h.handleClientMessage(client, []byte(message))
+		select {
+		case data := <-client.SendChan:
+			var envelope Envelope
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			return envelope
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no reply to %s", message)
+			return Envelope{}
+		}
+	}
+
+	reply := call(`{"id":"1","method":"test.echo","params":{"id":5,"name":"x"}}`)
+	if reply.Type != EnvelopeResult || reply.ID != "1" || reply.Method != "test.echo" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+	result, _ := json.Marshal(reply.Result)
+	var body struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(result, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data["id"] != "5" || body.Data["name"] != "x" || body.Data["authorization"] != "Bearer token" || body.Data["language"] != "en" {
+		t.Fatalf("unexpected request %+v", body.Data)
+	}
+
+	reply = call(`{"id":"2","method":"test.forbidden"}`)
+	if reply.Type != EnvelopeError || reply.Error != "denied" || reply.Code != 2 {
+		t.Fatalf("expected the error response, got %+v", reply)
+	}
+
+	reply = call(`{"id":"3","method":"test.slow"}`)
+	if reply.Type != EnvelopeError || reply.Error != "timed out" {
+		t.Fatalf("expected a timeout, got %+v", reply)
+	}
+
+	reply = call(`{"id":"4","method":"test.missing"}`)
+	if reply.Type != EnvelopeError || reply.Error != "unknown method" {
+		t.Fatalf("expected an unknown method, got %+v", reply)
+	}
+}
@@ -0,0 +1,142 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	auth "snack-shop/internal/auth"
+	player "snack-shop/internal/player"
+	"snack-shop/pkg/events"
+	custom_log "snack-shop/pkg/logs"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// Reasons of the connections the session check closes, the others come from events.Session
+const (
+	ReasonSessionRevoked = "session_revoked"
+	ReasonSessionExpired = "session_expired"
+)
+
+// closeRequest selects connections to close by connection ID or by account, KeepSession spares
+// the connections of a session that is still valid
+type closeRequest struct {
+	Connection  string `json:"connection,omitempty"`
+	Account     string `json:"account,omitempty"`
+	KeepSession string `json:"keep_session,omitempty"`
+	Code        int    `json:"code"`
+	Reason      string `json:"reason"`
+}
+
+func (r closeRequest) matches(client *Client) bool {
+	if r.Connection != "" && client.ID != r.Connection {
+		return false
+	}
+	if r.Account != "" && client.UserID != r.Account {
+		return false
+	}
+	return r.KeepSession == "" || client.Identity.LoginSession != r.KeepSession
+}
+
+// closeConnections closes the matching connections on every instance
+func (h *Hub) closeConnections(request closeRequest) {
+	h.closeLocal(request)
+	if h.cluster == nil {
+		return
+	}
+	message, err := json.Marshal(request)
+	if err != nil {
+		custom_log.NewCustomLog("websocket_fanout_failed", err.Error(), "error")
+		return
+	}
+	h.cluster.broadcast(targetClose, "", message)
+}
+
+// closeLocal closes the matching connections on this instance
+func (h *Hub) closeLocal(request closeRequest) int {
+	if request.Connection == "" && request.Account == "" {
+		return 0
+	}
+
+	var clients []*Client
+	for _, client := range h.allClients() {
+		if request.matches(client) {
+			clients = append(clients, client)
+		}
+	}
+
+	for _, client := range clients {
+		client.close(request.Code, request.Reason)
+	}
+	return len(clients)
+}
+
+// closeInvalidatedSession is the handler of events.SessionInvalidated
+func (h *Hub) closeInvalidatedSession(session events.Session) {
+	h.closeConnections(closeRequest{
+		Account:     session.Key,
+		KeepSession: session.Keep,
+		Code:        CloseSessionInvalidated,
+		Reason:      session.Reason,
+	})
+}
+
+// StartSessionCheck closes local connections whose token expired or whose login session is no
+// longer valid, e.g. replaced by a login on an instance that missed the event. It runs every
+// interval until ctx is done.
+func StartSessionCheck(ctx context.Context, wg *sync.WaitGroup, hub *Hub, db *sqlx.DB, rdb *redis.Client, interval time.Duration) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkSessions(hub, db, rdb)
+			}
+		}
+	}()
+}
+
+func checkSessions(hub *Hub, db *sqlx.DB, rdb *redis.Client) {
+	clients := hub.allClients()
+
+	userSessions := auth.NewAuthService(db, rdb)
+	playerSessions := player.NewPlayerSessionService(db)
+
+	// Connections of the same session share one lookup
+	valid := make(map[string]bool)
+	now := time.Now()
+	for _, client := range clients {
+		identity := client.Identity
+		if !identity.ExpiresAt.IsZero() && now.After(identity.ExpiresAt) {
+			client.close(CloseSessionExpired, ReasonSessionExpired)
+			continue
+		}
+
+		ok, checked := valid[identity.LoginSession]
+		if !checked {
+			var messageID string
+			if identity.Kind == IdentityPlayer {
+				if _, err := playerSessions.CheckSession(identity.LoginSession); err != nil {
+					messageID = err.MessageID
+				}
+			} else if _, err := userSessions.CheckSession(identity.LoginSession); err != nil {
+				messageID = err.MessageID
+			}
+
+			// Only a session known to be invalid closes, a database error keeps the connection
+			ok = messageID != "invalid_session_id"
+			valid[identity.LoginSession] = ok
+		}
+		if !ok {
+			client.close(CloseSessionInvalidated, ReasonSessionRevoked)
+		}
+	}
+}
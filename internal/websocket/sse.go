@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"snack-shop/pkg/constants"
+	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
+	"snack-shop/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// An event stream gets a comment line every sseHeartbeat so proxies keep it open, and the browser
+// reconnects after sseRetry when it drops
+const (
+	sseHeartbeat = 15 * time.Second
+	sseRetry     = 3000 // milliseconds
+)
+
+// Events streams the hub as Server-Sent Events for clients that cannot upgrade to WebSocket.
+// Topics are subscribed once with ?topics=a,b and the stream carries the same envelopes as the
+// WebSocket, events of the message stream with their sequence ID as the event ID. A reconnecting
+// client sends Last-Event-ID and gets the messages after it replayed.
+func (h *WebSocketHandler) Events(c *fiber.Ctx) error {
+	identity, ok := identityFromContext(c)
+	if !ok {
+		return c.Status(http.StatusUnauthorized).JSON(response.NewResponseError(
+			utils.Translate("websocket_events_failed", nil, c),
+			constants.WebSocketEventsFailed,
+			fmt.Errorf("missing user or player context"),
+		))
+	}
+
+	var topics []string
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		if err := authorizeTopic(identity, topic); err != nil {
+			return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+				utils.Translate("websocket_events_failed", nil, c),
+				constants.WebSocketEventsFailed,
+				err,
+			))
+		}
+		topics = append(topics, topic)
+	}
+
+	// EventSource sends the header on reconnect, the query parameter is for the first connection
+	lastID := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	if lastID != "" && !sequencePattern.MatchString(lastID) {
+		return c.Status(http.StatusBadRequest).JSON(response.NewResponseError(
+			utils.Translate("websocket_events_failed", nil, c),
+			constants.WebSocketEventsFailed,
+			fmt.Errorf("invalid Last-Event-ID `%s`", lastID),
+		))
+	}
+
+	if err := h.hub.admit(c.Context(), identity.Key); err != nil {
+		logViolation(identity, "", err)
+		return c.Status(http.StatusTooManyRequests).JSON(response.NewResponseError(
+			utils.Translate("websocket_events_failed", nil, c),
+			constants.WebSocketEventsFailed,
+			err,
+		))
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// The stream writer runs after the handler returned, it must not touch c
+	client := h.hub.newClient(identity, TransportSSE, nil)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		h.streamEvents(client, topics, lastID, w)
+	})
+	return nil
+}
+
+// streamEvents registers an event stream with the hub and writes its messages until the client
+// goes away or the server closes it
+func (h *WebSocketHandler) streamEvents(client *Client, topics []string, lastID string, w *bufio.Writer) {
+	// Live messages are held from the start so they cannot overtake the replay
+	replay := lastID != "" && h.hub.cluster != nil
+	if replay {
+		client.beginReplay()
+	}
+
+	if err := h.hub.connect(client); err != nil {
+		message, _ := json.Marshal(Envelope{Type: EnvelopeClose, Code: websocket.CloseGoingAway, Error: ReasonServerShutdown})
+		writeEvent(w, message)
+		w.Flush()
+		return
+	}
+	defer h.hub.disconnect(client)
+
+	h.hub.Subscribe(client, topics)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	// Replay concurrently, the writer below drains what it queues
+	if replay {
+		go func() {
+			replayed, err := h.hub.cluster.replay(client, lastID)
+			if err != nil {
+				custom_log.NewCustomLog("websocket_replay_failed", err.Error(), "error")
+			}
+			client.endReplay(replayed)
+		}()
+	}
+
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.done:
+			client.mu.Lock()
+			code, reason := client.closeCode, client.closeReason
+			client.mu.Unlock()
+			if code != 0 {
+				message, _ := json.Marshal(Envelope{Type: EnvelopeClose, Code: code, Error: reason})
+				writeEvent(w, message)
+				w.Flush()
+			}
+			return
+
+		case message := <-client.SendChan:
+			writeEvent(w, message)
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			if err := w.Flush(); err != nil {
+				return
+			}
+			client.mu.Lock()
+			client.LastActive = time.Now()
+			client.mu.Unlock()
+		}
+	}
+}
+
+// writeEvent writes an encoded envelope as one event, with the sequence ID of the envelope as the
+// event ID so the browser sends it back as Last-Event-ID
+func writeEvent(w *bufio.Writer, message []byte) {
+	var head struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(message, &head); err != nil {
+		log.Printf("Skipping malformed event: %v", err)
+		return
+	}
+	if head.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", head.ID)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", message)
+}
@@ -0,0 +1,275 @@
+package websocket
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	custom_log "snack-shop/pkg/logs"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Messages addressed to an account are kept in a Redis stream per account, the stream entry ID is
+// the sequence ID of the message. Streams are capped at StreamMaxLen entries and expire StreamTTL
+// after the last message. Acks are kept per login session, so each device resumes from its own
+// position, and expire with the stream.
+const (
+	streamKeyPrefix = "websocket:stream:"
+	ackKeyPrefix    = "websocket:ack:"
+	replayBatch     = 200
+	replayWait      = 5 * time.Second
+)
+
+var sequencePattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+// ackScript moves the acknowledged ID forward only, a late ack of an older message must not
+// replay what the device already processed
+var ackScript = redis.NewScript(`
+local function parse(id)
+	local ms, seq = string.match(id, '^(%d+)%-?(%d*)$')
+	return tonumber(ms), tonumber(seq) or 0
+end
+local current = redis.call('GET', KEYS[1])
+if current then
+	local ms, seq = parse(current)
+	local new_ms, new_seq = parse(ARGV[1])
+	if new_ms < ms or (new_ms == ms and new_seq <= seq) then
+		redis.call('EXPIRE', KEYS[1], ARGV[2])
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return 1
+`)
+
+// ackKey is the key of the last acknowledged ID of one login session of an account
+func ackKey(identity Identity) string {
+	return ackKeyPrefix + identity.Key + ":" + identity.LoginSession
+}
+
+// Notify delivers payload to every connection of an account on every instance. Unlike Publish the
+// message is stored first and carries a sequence ID, so a client that was offline or lost it gets
+// it replayed on resume. It returns the number of connections on this instance it was queued for.
+func (h *Hub) Notify(key string, topic string, payload interface{}) (int, error) {
+	envelope := Envelope{Type: EnvelopeEvent, Topic: topic, Payload: payload}
+
+	var errStore error
+	if h.cluster != nil {
+		envelope.ID, errStore = h.cluster.store(key, envelope)
+		if errStore != nil {
+			custom_log.NewCustomLog("websocket_stream_failed", errStore.Error(), "error")
+		}
+	}
+
+	message, err := json.Marshal(envelope)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event of topic %s: %w", topic, err)
+	}
+
+	sent := h.sendLocal(key, message)
+	if h.cluster != nil {
+		h.cluster.broadcast(targetUser, key, message)
+	}
+	return sent, errStore
+}
+
+// store appends an envelope to the stream of an account and returns its sequence ID
+func (c *Cluster) store(key string, envelope Envelope) (string, error) {
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	streamKey := streamKeyPrefix + key
+	var id *redis.StringCmd
+	_, err = c.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		id = pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: streamKey,
+			MaxLen: c.options.StreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"envelope": body},
+		})
+		pipe.Expire(ctx, streamKey, c.options.StreamTTL)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store websocket message: %w", err)
+	}
+	return id.Val(), nil
+}
+
+// ack remembers the last sequence ID the login session of the client has processed
+func (c *Cluster) ack(identity Identity, id string) error {
+	err := ackScript.Run(context.Background(), c.redis, []string{ackKey(identity)},
+		id, int(c.options.StreamTTL.Seconds())).Err()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to store websocket ack: %w", err)
+	}
+	return nil
+}
+
+// replay sends the messages of the account after lastID to one connection, without lastID it
+// starts after the last message acknowledged by its login session. It returns the ID of the last
+// replayed message.
+func (c *Cluster) replay(client *Client, lastID string) (string, error) {
+	ctx := context.Background()
+	if lastID == "" {
+		acked, err := c.redis.Get(ctx, ackKey(client.Identity)).Result()
+		if err != nil && err != redis.Nil {
+			return "", fmt.Errorf("failed to read websocket ack: %w", err)
+		}
+		lastID = acked
+	}
+	if lastID == "" {
+		lastID = "0"
+	}
+
+	streamKey := streamKeyPrefix + client.UserID
+	for {
+		entries, err := c.redis.XRangeN(ctx, streamKey, "("+lastID, "+", replayBatch).Result()
+		if err != nil {
+			return lastID, fmt.Errorf("failed to read websocket stream: %w", err)
+		}
+		for _, entry := range entries {
+			body, _ := entry.Values["envelope"].(string)
+			var envelope Envelope
+			if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+				log.Printf("Skipping malformed websocket stream entry %s: %v", entry.ID, err)
+				continue
+			}
+			envelope.ID = entry.ID
+			message, err := json.Marshal(envelope)
+			if err != nil {
+				continue
+			}
+			// A replay may be longer than the queue, it waits for the writer instead of dropping
+			if !c.hub.enqueueWait(client, message, replayWait) {
+				return lastID, fmt.Errorf("replay to %s stopped at %s", client.ID, lastID)
+			}
+			lastID = entry.ID
+		}
+		if len(entries) < replayBatch {
+			return lastID, nil
+		}
+	}
+}
+
+// beginReplay holds back the live messages of the connection until endReplay, so they cannot
+// overtake the older messages of a replay
+func (c *Client) beginReplay() {
+	c.mu.Lock()
+	c.replaying = true
+	c.mu.Unlock()
+}
+
+// hold keeps a live message back while a replay runs, at most a queue worth of them, the oldest
+// is dropped beyond that
+func (c *Client) hold(message []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.replaying {
+		return false
+	}
+	if len(c.held) >= cap(c.SendChan) {
+		c.held = c.held[1:]
+		c.dropped.Add(1)
+	}
+	c.held = append(c.held, message)
+	return true
+}
+
+// endReplay queues the messages held back during a replay that ended at lastID. Messages up to
+// lastID were stored before the replay read the stream and are skipped, live messages arriving
+// meanwhile are held until every earlier one is queued.
+func (c *Client) endReplay(lastID string) {
+	for {
+		c.mu.Lock()
+		held := c.held
+		c.held = nil
+		if len(held) == 0 {
+			c.replaying = false
+		}
+		c.mu.Unlock()
+		if len(held) == 0 {
+			return
+		}
+
+		for _, message := range held {
+			if id := sequenceOf(message); id != "" && lastID != "" && compareSequence(id, lastID) <= 0 {
+				continue
+			}
+			c.hub.enqueueWait(c, message, replayWait)
+		}
+	}
+}
+
+// sequenceOf returns the sequence ID of an encoded envelope, empty for messages of Publish
+func sequenceOf(message []byte) string {
+	var head struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(message, &head); err != nil || !sequencePattern.MatchString(head.ID) {
+		return ""
+	}
+	return head.ID
+}
+
+// compareSequence orders two stream entry IDs, <milliseconds>-<sequence>
+func compareSequence(a, b string) int {
+	split := func(id string) (uint64, uint64) {
+		ms, seq, _ := strings.Cut(id, "-")
+		msValue, _ := strconv.ParseUint(ms, 10, 64)
+		seqValue, _ := strconv.ParseUint(seq, 10, 64)
+		return msValue, seqValue
+	}
+	aMs, aSeq := split(a)
+	bMs, bSeq := split(b)
+	if order := cmp.Compare(aMs, bMs); order != 0 {
+		return order
+	}
+	return cmp.Compare(aSeq, bSeq)
+}
+
+// handleAck and handleResume are the reliable delivery actions of handleClientMessage
+func (h *WebSocketHandler) handleAck(client *Client, message ClientMessage) {
+	if !sequencePattern.MatchString(message.ID) {
+		client.sendEnvelope(Envelope{Type: EnvelopeError, Error: "invalid id"})
+		return
+	}
+	if h.hub.cluster == nil {
+		return
+	}
+	if err := h.hub.cluster.ack(client.Identity, message.ID); err != nil {
+		custom_log.NewCustomLog("websocket_ack_failed", err.Error(), "warn")
+	}
+}
+
+func (h *WebSocketHandler) handleResume(client *Client, message ClientMessage) {
+	if message.LastID != "" && !sequencePattern.MatchString(message.LastID) {
+		client.sendEnvelope(Envelope{Type: EnvelopeError, Error: "invalid last_id"})
+		return
+	}
+	if h.hub.cluster == nil {
+		client.sendEnvelope(Envelope{Type: EnvelopeResumed, ID: message.LastID})
+		return
+	}
+
+	// Live messages wait behind the replay and the resumed envelope, which bypass the hold
+	client.beginReplay()
+	lastID, err := h.hub.cluster.replay(client, message.LastID)
+	if err != nil {
+		custom_log.NewCustomLog("websocket_replay_failed", err.Error(), "error")
+		client.reply(Envelope{Type: EnvelopeError, Error: "cannot replay messages"})
+	} else {
+		client.reply(Envelope{Type: EnvelopeResumed, ID: lastID})
+	}
+	client.endReplay(lastID)
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReplayHoldsLiveMessages(t *testing.T) {
+	hub := NewHub(HubOptions{})
+	client := hub.newClient(testIdentity(IdentityPlayer, 3), TransportSSE, nil)
+	client.beginReplay()
+	hub.connect(client)
+	defer hub.disconnect(client)
+
+	envelope := func(id string) []byte {
+		message, _ := json.Marshal(Envelope{Type: EnvelopeEvent, ID: id, Topic: "balance.member.3"})
+		return message
+	}
+
+	// Notified while the replay reads the stream, 2-0 is part of the replay as well
+	hub.sendLocal("member3", envelope("2-0"))
+	hub.sendLocal("member3", envelope("3-0"))
+	hub.sendLocal("member3", envelope(""))
+	if len(client.SendChan) != 0 {
+		t.Fatalf("expected the live messages to be held, got %d queued", len(client.SendChan))
+	}
+
+	for _, id := range []string{"1-0", "2-0"} {
+		hub.enqueueWait(client, envelope(id), replayWait)
+	}
+	client.endReplay("2-0")
+	hub.sendLocal("member3", envelope("4-0"))
+
+	var got []string
+	for len(client.SendChan) > 0 {
+		got = append(got, sequenceOf(<-client.SendChan))
+	}
+	want := []string{"1-0", "2-0", "3-0", "", "4-0"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestCompareSequence(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1760781234567-0", "1760781234567-0", 0},
+		{"1760781234567-1", "1760781234567-0", 1},
+		{"1760781234567-10", "1760781234567-9", 1},
+		{"999-5", "1000-0", -1},
+		{"0", "1-0", -1},
+		{"5", "5-0", 0},
+	}
+	for _, tt := range tests {
+		if got := compareSequence(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareSequence(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
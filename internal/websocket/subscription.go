@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// handleClientMessage applies a control message of the client and answers with an envelope
+func (h *WebSocketHandler) handleClientMessage(client *Client, msg []byte) {
+	var message ClientMessage
+	if err := json.Unmarshal(msg, &message); err != nil {
+		client.sendEnvelope(Envelope{Type: EnvelopeError, Error: "invalid message"})
+		return
+	}
+	if message.Method != "" {
+		h.handleCall(client, message)
+		return
+	}
+
+	switch message.Action {
+	case ActionSubscribe:
+		accepted := make([]string, 0, len(message.Topics))
+		for _, topic := range message.Topics {
+			if err := authorizeTopic(client.Identity, topic); err != nil {
+				client.sendEnvelope(Envelope{Type: EnvelopeError, Topic: topic, Error: err.Error()})
+				continue
+			}
+			accepted = append(accepted, topic)
+		}
+		h.hub.Subscribe(client, accepted)
+		client.sendEnvelope(Envelope{Type: EnvelopeSubscribed, Topics: accepted})
+	case ActionUnsubscribe:
+		h.hub.Unsubscribe(client, message.Topics)
+		client.sendEnvelope(Envelope{Type: EnvelopeUnsubscribed, Topics: message.Topics})
+	case ActionAck:
+		h.handleAck(client, message)
+	case ActionResume:
+		h.handleResume(client, message)
+	default:
+		client.sendEnvelope(Envelope{Type: EnvelopeError, Error: fmt.Sprintf("unknown action `%s`", message.Action)})
+	}
+}
+
+// Publish delivers payload to every connection subscribed to topic, directly or by wildcard, on
+// every instance. It returns the number of connections on this instance it was queued for.
+func (h *Hub) Publish(topic string, payload interface{}) int {
+	message, err := json.Marshal(Envelope{Type: EnvelopeEvent, Topic: topic, Payload: payload})
+	if err != nil {
+		log.Printf("Error marshaling event of topic %s: %v", topic, err)
+		return 0
+	}
+
+	sent := h.publishLocal(topic, message)
+	if h.cluster != nil {
+		h.cluster.broadcast(targetTopic, topic, message)
+	}
+	return sent
+}
+
+// send queues a message for the writer of the connection, see Hub.enqueue
+func (c *Client) send(message []byte) bool {
+	return c.hub.enqueue(c, message)
+}
+
+func (c *Client) sendEnvelope(envelope Envelope) {
+	message, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Error marshaling %s envelope: %v", envelope.Type, err)
+		return
+	}
+	c.send(message)
+}
@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Topics are dot separated names such as "user.updated" or "balance.member.42". A subscription may
+// use "*" for a whole segment, e.g. "balance.member.*" receives the balance of every player.
+var topicPattern = regexp.MustCompile(`^([a-z0-9_-]+|\*)$`)
+
+const maxTopicLength = 128
+
+// TopicRule authorizes subscriptions to the topics matching Pattern. Authorize gets the segments
+// of the requested topic, wildcards included, so it can compare an id segment with the identity.
+type TopicRule struct {
+	Pattern   string
+	Authorize func(identity Identity, segments []string) bool
+}
+
+var (
+	topicRules      []TopicRule
+	topicRulesMutex = &sync.RWMutex{}
+)
+
+func init() {
+	// Account changes are for admin users only
+	RegisterTopic("user.*", usersOnly)
+
+	// Admin users follow balances here, a player gets its own balance through its message stream
+	RegisterTopic("balance.member.*", usersOnly)
+
+	// Presence changes of users and players, e.g. presence.user12, for the admin dashboard
+	RegisterTopic("presence.*", usersOnly)
+}
+
+// RegisterTopic adds the rule of a topic family, the first matching rule decides. Topics without
+// a rule cannot be subscribed.
+func RegisterTopic(pattern string, authorize func(identity Identity, segments []string) bool) {
+	topicRulesMutex.Lock()
+	defer topicRulesMutex.Unlock()
+	topicRules = append(topicRules, TopicRule{Pattern: pattern, Authorize: authorize})
+}
+
+func usersOnly(identity Identity, _ []string) bool {
+	return identity.Kind == IdentityUser
+}
+
+// authorizeTopic checks that topic is well formed and that identity may subscribe to it
+func authorizeTopic(identity Identity, topic string) error {
+	segments, err := splitTopic(topic)
+	if err != nil {
+		return err
+	}
+
+	topicRulesMutex.RLock()
+	defer topicRulesMutex.RUnlock()
+	for _, rule := range topicRules {
+		if !matchSegments(strings.Split(rule.Pattern, "."), segments) {
+			continue
+		}
+		if !rule.Authorize(identity, segments) {
+			return fmt.Errorf("not allowed to subscribe to `%s`", topic)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown topic `%s`", topic)
+}
+
+func splitTopic(topic string) ([]string, error) {
+	if topic == "" || len(topic) > maxTopicLength {
+		return nil, fmt.Errorf("invalid topic `%s`", topic)
+	}
+	segments := strings.Split(topic, ".")
+	for _, segment := range segments {
+		if !topicPattern.MatchString(segment) {
+			return nil, fmt.Errorf("invalid topic `%s`", topic)
+		}
+	}
+	return segments, nil
+}
+
+// matchTopic reports whether a published topic is delivered to a subscription
+func matchTopic(subscription string, topic string) bool {
+	if subscription == topic {
+		return true
+	}
+	return matchSegments(strings.Split(subscription, "."), strings.Split(topic, "."))
+}
+
+// matchSegments compares segment by segment, "*" in the pattern matches any one segment
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
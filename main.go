@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
 	configs "snack-shop/config"
 	database "snack-shop/config/database"
+	notifier "snack-shop/config/notifier"
 	redis "snack-shop/config/redis"
+	storage "snack-shop/config/storage"
 	"snack-shop/handler"
+	env "snack-shop/pkg/utils"
 	routers "snack-shop/routers"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -23,7 +32,45 @@ func main() {
 	// Initialize redis client
 	rdb := redis.NewRedisClient()
 
-	handler.NewFrontService(app, db_pool, rdb)
+	// Initialize file storage
+	store := storage.NewStorage()
 
-	app.Listen(fmt.Sprintf("%s:%d", app_configs.AppHost, app_configs.AppPort))
+	// Initialize notifier for emails and SMS
+	n := notifier.NewNotifier()
+
+	services := handler.NewFrontService(app, db_pool, rdb, store, n)
+
+	// SIGINT and SIGTERM start the graceful shutdown, a second signal kills the process
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errListen := make(chan error, 1)
+	go func() {
+		errListen <- app.Listen(fmt.Sprintf("%s:%d", app_configs.AppHost, app_configs.AppPort))
+	}()
+
+	select {
+	case err := <-errListen:
+		log.Printf("Server stopped: %v", err)
+	case <-signals.Done():
+		log.Println("Shutting down")
+	}
+	stop()
+
+	// Requests, sockets and background work get SHUTDOWN_TIMEOUT seconds to finish, the database and
+	// Redis are closed last since they are used until then
+	timeout := time.Duration(env.GetenvInt("SHUTDOWN_TIMEOUT", 30)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := services.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown incomplete: %v", err)
+	}
+	if err := db_pool.Close(); err != nil {
+		log.Printf("Failed to close the database: %v", err)
+	}
+	if err := rdb.Close(); err != nil {
+		log.Printf("Failed to close Redis: %v", err)
+	}
+	log.Println("Shutdown complete")
 }
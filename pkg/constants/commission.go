@@ -0,0 +1,24 @@
+package constants
+
+const (
+	CommissionRateShowSuccess       = 18000
+	CommissionRateShowFailed        = 18001
+	CommissionRateCreateSuccess     = 18002
+	CommissionRateCreateFailed      = 18003
+	CommissionTurnoverShowSuccess   = 18004
+	CommissionTurnoverShowFailed    = 18005
+	CommissionTurnoverCreateSuccess = 18006
+	CommissionTurnoverCreateFailed  = 18007
+	CommissionCalculateSuccess      = 18008
+	CommissionCalculateFailed       = 18009
+	CommissionPayoutShowSuccess     = 18010
+	CommissionPayoutShowFailed      = 18011
+	CommissionPayoutShowOneSuccess  = 18012
+	CommissionPayoutShowOneFailed   = 18013
+	CommissionPayoutCreateSuccess   = 18014
+	CommissionPayoutCreateFailed    = 18015
+	CommissionPayoutApproveSuccess  = 18016
+	CommissionPayoutApproveFailed   = 18017
+	CommissionPayoutPaySuccess      = 18018
+	CommissionPayoutPayFailed       = 18019
+)
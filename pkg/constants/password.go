@@ -0,0 +1,7 @@
+package constants
+
+const (
+	PasswordChangeRequired = 19000
+	PasswordChangeSuccess  = 19001
+	PasswordChangeFailed   = 19002
+)
@@ -0,0 +1,9 @@
+package constants
+
+const (
+	PhotoUploadSuccess = 15000
+	PhotoUploadFailed  = 15001
+	PhotoShowSuccess   = 15002
+	PhotoShowFailed    = 15003
+	FileServeFailed    = 15005
+)
@@ -0,0 +1,18 @@
+package constants
+
+const (
+	PlayerCreateSuccess        = 17000
+	PlayerCreateFailed         = 17001
+	PlayerDeleteSuccess        = 17002
+	PlayerDeleteFailed         = 17003
+	PlayerShowSuccess          = 17004
+	PlayerShowFailed           = 17005
+	PlayerShowOneSuccess       = 17006
+	PlayerShowOneFailed        = 17007
+	PlayerUpdateSuccess        = 17008
+	PlayerUpdateFailed         = 17009
+	PlayerSuspendSuccess       = 17010
+	PlayerSuspendFailed        = 17011
+	PlayerPasswordResetSuccess = 17012
+	PlayerPasswordResetFailed  = 17013
+)
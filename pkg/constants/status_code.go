@@ -8,4 +8,6 @@ const (
 	Login_invalid             = 3302
 	Login_failed              = 3303
 	Login_success             = 3304
+	AccountSuspended          = 3305
+	AccountInactive           = 3306
 )
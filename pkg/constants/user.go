@@ -21,4 +21,8 @@ const (
 	UserGetUserBasicInfoFailed   = 14017
 	UserGetLoginSessionSuccess   = 14018
 	UserGetLoginSessionFailed    = 14019
+	UserChangeStatusSuccess      = 14020
+	UserChangeStatusFailed       = 14021
+	UserStatusHistorySuccess     = 14022
+	UserStatusHistoryFailed      = 14023
 )
@@ -0,0 +1,9 @@
+package constants
+
+const (
+	VerificationSendSuccess    = 16000
+	VerificationSendFailed     = 16001
+	VerificationConfirmSuccess = 16002
+	VerificationConfirmFailed  = 16003
+	ContactNotVerified         = 16005
+)
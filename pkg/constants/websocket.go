@@ -0,0 +1,16 @@
+package constants
+
+const (
+	WebSocketPresenceSuccess = 20000
+	WebSocketPresenceFailed  = 20001
+
+	WebSocketConnectionsSuccess = 20002
+	WebSocketConnectionsFailed  = 20003
+	WebSocketKickSuccess        = 20004
+	WebSocketKickFailed         = 20005
+	WebSocketEventsFailed       = 20006
+	WebSocketRPCFailed          = 20009
+
+	PresenceSuccess = 20007
+	PresenceFailed  = 20008
+)
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	custom_log "snack-shop/pkg/logs"
+)
+
+// Domain events are named like the hub topics they are forwarded to
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+
+	SessionInvalidated = "session.invalidated"
+)
+
+// Machine-readable reasons of SessionInvalidated, live connections are closed with them
+const (
+	ReasonAccountDeleted   = "account_deleted"
+	ReasonAccountSuspended = "account_suspended"
+	ReasonAccountInactive  = "account_inactive"
+	ReasonPasswordChanged  = "password_changed"
+	ReasonSessionReplaced  = "session_replaced"
+)
+
+// Session is the payload of SessionInvalidated. Key is the connection key of the account, user<id>
+// or member<id>, and Keep the login session that stays valid, empty when none does.
+type Session struct {
+	Key    string
+	Reason string
+	Keep   string
+}
+
+// Event is a committed domain change, Payload is in the shape the API returns for the entity
+type Event struct {
+	Name    string
+	Payload interface{}
+}
+
+type Handler func(event Event)
+
+var (
+	handlers      []Handler
+	handlersMutex = &sync.RWMutex{}
+)
+
+// Subscribe registers a handler for every emitted event
+func Subscribe(handler Handler) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	handlers = append(handlers, handler)
+}
+
+// Emit hands an event to the handlers, it is called after the transaction of the change committed.
+// A failing handler is logged and does not affect the caller or the other handlers.
+func Emit(name string, payload interface{}) {
+	handlersMutex.RLock()
+	subscribed := make([]Handler, len(handlers))
+	copy(subscribed, handlers)
+	handlersMutex.RUnlock()
+
+	event := Event{Name: name, Payload: payload}
+	for _, handler := range subscribed {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					custom_log.NewCustomLog("event_handler_failed", fmt.Sprintf("%s: %v", name, r), "error")
+				}
+			}()
+			handler(event)
+		}()
+	}
+}
@@ -31,6 +31,31 @@ func NewResponseError(message string, statusCode int, err error) ErrorResponse {
 	}
 }
 
+type ErrorResponseWithData struct {
+	Success    bool              `json:"success"`
+	Message    string            `json:"message"`
+	StatusCode int               `json:"status_code"`
+	Data       ErrorDataWithData `json:"data"`
+}
+type ErrorDataWithData struct {
+	Error   string      `json:"error"`
+	Current interface{} `json:"current"`
+}
+
+// NewResponseErrorWithData returns an error together with the current state of the resource,
+// e.g. on a 412 so the client can merge its changes without another request
+func NewResponseErrorWithData(message string, statusCode int, err error, current interface{}) ErrorResponseWithData {
+	return ErrorResponseWithData{
+		Success:    false,
+		Message:    message,
+		StatusCode: statusCode,
+		Data: ErrorDataWithData{
+			Error:   err.Error(),
+			Current: current,
+		},
+	}
+}
+
 // add switch other variant
 func NewError(err error) Error {
 	e := Error{}
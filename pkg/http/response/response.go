@@ -37,3 +37,33 @@ func NewResponseWithPaging(message string, statusCode int, data interface{}, pag
 		Total:      total,
 	}
 }
+
+type ResponseWithCursor struct {
+	Success    bool        `json:"success"`
+	Message    string      `json:"message"`
+	StatusCode int         `json:"status_code"`
+	Data       interface{} `json:"data"`
+	PerPage    int         `json:"per_page"`
+	NextCursor *string     `json:"next_cursor"`
+	PrevCursor *string     `json:"prev_cursor"`
+	Total      *int        `json:"total,omitempty"`
+}
+
+// NewResponseWithCursor is the paging response of cursor mode, a missing neighbour page is null
+func NewResponseWithCursor(message string, statusCode int, data interface{}, perpage int, nextCursor string, prevCursor string, total *int) ResponseWithCursor {
+	response := ResponseWithCursor{
+		Success:    true,
+		Message:    message,
+		StatusCode: statusCode,
+		Data:       data,
+		PerPage:    perpage,
+		Total:      total,
+	}
+	if nextCursor != "" {
+		response.NextCursor = &nextCursor
+	}
+	if prevCursor != "" {
+		response.PrevCursor = &prevCursor
+	}
+	return response
+}
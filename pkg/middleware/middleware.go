@@ -9,7 +9,9 @@ import (
 	"time"
 
 	auth "snack-shop/internal/auth"
+	player "snack-shop/internal/player"
 	response "snack-shop/pkg/http/response"
+	custom_log "snack-shop/pkg/logs"
 	types "snack-shop/pkg/model"
 	utils "snack-shop/pkg/utils"
 
@@ -20,6 +22,9 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// playerPaths are the only routes a player token may reach, everything else is for admin users
+var playerPaths = []string{"/websocket", "/api/v1/events"}
+
 func NewJwtMinddleWare(app *fiber.App, db_pool *sqlx.DB, redis *redis.Client) {
 	errs := godotenv.Load()
 	if errs != nil {
@@ -133,6 +138,10 @@ func NewJwtMinddleWare(app *fiber.App, db_pool *sqlx.DB, redis *redis.Client) {
 		// 	log.Printf("  %s: %v\n", k, v)
 		// }
 
+		// Player tokens carry player_id instead of a user
+		if _, isPlayer := uclaim["player_id"]; isPlayer {
+			return handlePlayerContext(c, uclaim, db_pool)
+		}
 		return handleUserContext(c, uclaim, db_pool, redis)
 	})
 }
@@ -178,6 +187,9 @@ func handleUserContext(c *fiber.Ctx, uclaim jwt.MapClaims, db *sqlx.DB, redis *r
 		Exp:          time.Unix(int64(exp), 0),
 		UserAgent:    c.Get("User-Agent", "unknown"),
 		Ip:           c.IP(),
+
+		// WebSocket connections of the same account share this key
+		KeyAliasForWebsocket: fmt.Sprintf("user%d", sessionData.UserID),
 	}
 
 	// Save to Fiber context for controllers to use
@@ -186,3 +198,65 @@ func handleUserContext(c *fiber.Ctx, uclaim jwt.MapClaims, db *sqlx.DB, redis *r
 
 	return c.Next()
 }
+
+func handlePlayerContext(c *fiber.Ctx, uclaim jwt.MapClaims, db *sqlx.DB) error {
+	allowed := false
+	for _, prefix := range playerPaths {
+		if strings.HasPrefix(c.Path(), prefix) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		errMsg := utils.Translate("player_access_denied", nil, c)
+		return c.Status(http.StatusForbidden).JSON(response.NewResponseError(
+			errMsg, -403, fmt.Errorf("players cannot access this resource"),
+		))
+	}
+
+	loginSession, ok := uclaim["login_session"].(string)
+	if !ok || loginSession == "" {
+		errMsg := utils.Translate("login_session_missing", nil, c)
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			errMsg, -500, fmt.Errorf("missing or invalid 'login_session' in claims"),
+		))
+	}
+
+	exp, ok := uclaim["exp"].(float64)
+	if !ok {
+		errMsg := utils.Translate("exp_missing", nil, c)
+		return c.Status(http.StatusUnprocessableEntity).JSON(response.NewResponseError(
+			errMsg, -500, fmt.Errorf("missing or invalid 'exp' in claims"),
+		))
+	}
+
+	sv := player.NewPlayerSessionService(db)
+	sessionData, errResp := sv.CheckSession(loginSession)
+	if errResp != nil {
+		errMsg := utils.Translate("login_session_invalid", nil, c)
+		return c.Status(http.StatusUnprocessableEntity).JSON(
+			response.NewResponseError(errMsg, -500, errResp.Err),
+		)
+	}
+
+	if err := sv.TouchLastAccess(sessionData.PlayerID); err != nil {
+		custom_log.NewCustomLog("player_last_access_failed", err.Error(), "warn")
+	}
+
+	pCtx := types.PlayerContext{
+		PlayerID:     float64(sessionData.PlayerID),
+		PlayerUuid:   sessionData.PlayerUUID,
+		UserName:     sessionData.UserName,
+		LoginSession: sessionData.LoginSession,
+		Exp:          time.Unix(int64(exp), 0),
+		UserAgent:    c.Get("User-Agent", "unknown"),
+		Ip:           c.IP(),
+
+		KeyAliasForWebsocket: fmt.Sprintf("member%d", sessionData.PlayerID),
+	}
+
+	c.Locals("PlayerContext", pCtx)
+	c.Locals("PlayerSessionData", sessionData)
+
+	return c.Next()
+}
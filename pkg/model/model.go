@@ -25,8 +25,15 @@ type UserSession struct {
 	RoleID       int64  `db:"role_id" json:"role_id"`
 	LoginSession string `db:"login_session" json:"login_session"`
 }
+type PlayerSession struct {
+	PlayerID     int64  `db:"id" json:"player_id"`
+	PlayerUUID   string `db:"player_uuid" json:"player_uuid"`
+	UserName     string `db:"user_name" json:"user_name"`
+	LoginSession string `db:"login_session" json:"login_session"`
+}
 type PlayerContext struct {
 	PlayerID     float64   `json:"player_id"`
+	PlayerUuid   string    `json:"player_uuid"`
 	UserName     string    `json:"user_name"`
 	LoginSession string    `json:"login_session"`
 	Exp          time.Time `json:"exp"`
@@ -34,18 +41,40 @@ type PlayerContext struct {
 	Ip           string    `json:"ip"`
 	MembershipId float64   `json:"membership_id"`
 	RoleID       int       `json:"role_id"`
+
+	KeyAliasForWebsocket string `json:"-"`
 }
 
+// Paging is offset based by default. With mode=cursor the page is selected by an opaque cursor
+// instead and the total count is only computed when with_total=true.
 type Paging struct {
-	Page    int `json:"page" query:"page" validate:"required,min=1"`
-	Perpage int `json:"per_page" query:"per_page" validate:"required,min=1"`
+	Page      int    `json:"page" query:"page" validate:"required_unless=Mode cursor,min=0"`
+	Perpage   int    `json:"per_page" query:"per_page" validate:"required,min=1"`
+	Mode      string `json:"mode" query:"mode" validate:"omitempty,oneof=offset cursor"`
+	Cursor    string `json:"cursor" query:"cursor"`
+	WithTotal bool   `json:"with_total" query:"with_total"`
+}
+
+func (p Paging) IsCursor() bool {
+	return p.Mode == "cursor"
 }
+
+// CountTotal tells whether the total number of rows has to be counted, deep cursor pages skip it
+func (p Paging) CountTotal() bool {
+	return !p.IsCursor() || p.WithTotal
+}
+
 type Sort struct {
 	Property  string `json:"property" validate:"required"`
 	Direction string `json:"direction" validate:"required,oneof=asc desc"`
 }
+
+// Filter is validated against the field registry of the resource. Operator defaults to eq, filters
+// with the same Group are OR'ed together.
 type Filter struct {
 	Property string      `json:"property" validate:"required"`
+	Operator string      `json:"operator" query:"operator"`
+	Group    string      `json:"group" query:"group"`
 	Value    interface{} `json:"value" validate:"required"`
 }
 
@@ -67,6 +96,14 @@ type BroadcastResponse struct {
 	Data  json.RawMessage `json:"data"`
 }
 
+// Ids of StatusData
+const (
+	StatusActive    = 1
+	StatusInactive  = 2
+	StatusSuspended = 3
+	StatusDeleted   = 4
+)
+
 var StatusData = []Status{
 	{Id: 1, StatusName: "Active"},
 	{Id: 2, StatusName: "Inactive"},
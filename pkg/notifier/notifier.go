@@ -0,0 +1,31 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+
+	custom_log "snack-shop/pkg/logs"
+)
+
+// Notifier delivers out-of-band messages (verification links, OTP codes, ...) to a person
+type Notifier interface {
+	SendEmail(ctx context.Context, to string, subject string, body string) error
+	SendSMS(ctx context.Context, to string, message string) error
+}
+
+// LogNotifier only writes messages to the application log, it is meant for local development
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) SendEmail(ctx context.Context, to string, subject string, body string) error {
+	custom_log.NewCustomLog("notifier_email", fmt.Sprintf("to: %s | subject: %s | body: %s", to, subject, body), "info")
+	return nil
+}
+
+func (n *LogNotifier) SendSMS(ctx context.Context, to string, message string) error {
+	custom_log.NewCustomLog("notifier_sms", fmt.Sprintf("to: %s | message: %s", to, message), "info")
+	return nil
+}
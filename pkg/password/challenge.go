@@ -0,0 +1,64 @@
+package password
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ChallengePurpose marks a token that only allows changing an expired password. It carries no
+// login_session, so the JWT middleware never accepts it as a session.
+const ChallengePurpose = "password_change"
+
+// Challenge is issued by login instead of a session when the password has expired. ChangedAt pins
+// the token to the expired password, it stops working once the password has been changed.
+type Challenge struct {
+	UserUUID  uuid.UUID
+	ChangedAt int64
+	ExpiresAt time.Time
+}
+
+func SignChallenge(secret string, challenge Challenge) (string, error) {
+	claims := jwt.MapClaims{
+		"purpose":    ChallengePurpose,
+		"user_uuid":  challenge.UserUUID.String(),
+		"changed_at": challenge.ChangedAt,
+		"exp":        challenge.ExpiresAt.Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+func ParseChallenge(secret string, token string) (*Challenge, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid {
+		return nil, fmt.Errorf("invalid or expired password change token")
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != ChallengePurpose {
+		return nil, fmt.Errorf("invalid password change token")
+	}
+	user_uuid_str, _ := claims["user_uuid"].(string)
+	user_uuid, err := uuid.Parse(user_uuid_str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password change token")
+	}
+	changed_at, ok := claims["changed_at"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid password change token")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, fmt.Errorf("invalid password change token")
+	}
+
+	return &Challenge{
+		UserUUID:  user_uuid,
+		ChangedAt: int64(changed_at),
+		ExpiresAt: exp.Time,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package password
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestParseChallenge(t *testing.T) {
+	const secret = "secret"
+	challenge := Challenge{
+		UserUUID:  uuid.New(),
+		ChangedAt: 1700000000,
+		ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	token, err := SignChallenge(secret, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseChallenge(secret, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.UserUUID != challenge.UserUUID || parsed.ChangedAt != challenge.ChangedAt || !parsed.ExpiresAt.Equal(challenge.ExpiresAt) {
+		t.Fatalf("expected %+v, got %+v", challenge, parsed)
+	}
+}
+
+func TestParseChallengeRejects(t *testing.T) {
+	const secret = "secret"
+	user_uuid := uuid.New().String()
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	expiresAt := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{
+			name: "wrong purpose",
+			token: sign(jwt.SigningMethodHS256, jwt.MapClaims{
+				"purpose": "email_verification", "user_uuid": user_uuid, "changed_at": 1, "exp": expiresAt,
+			}),
+		},
+		{
+			name: "expired",
+			token: sign(jwt.SigningMethodHS256, jwt.MapClaims{
+				"purpose": ChallengePurpose, "user_uuid": user_uuid, "changed_at": 1, "exp": time.Now().Add(-time.Minute).Unix(),
+			}),
+		},
+		{
+			name: "without expiry",
+			token: sign(jwt.SigningMethodHS256, jwt.MapClaims{
+				"purpose": ChallengePurpose, "user_uuid": user_uuid, "changed_at": 1,
+			}),
+		},
+		{
+			name: "wrong alg",
+			token: sign(jwt.SigningMethodHS512, jwt.MapClaims{
+				"purpose": ChallengePurpose, "user_uuid": user_uuid, "changed_at": 1, "exp": expiresAt,
+			}),
+		},
+		{
+			name: "session token",
+			token: sign(jwt.SigningMethodHS256, jwt.MapClaims{
+				"user_uuid": user_uuid, "user_id": 1, "username": "alice", "role_id": 1, "login_session": uuid.New().String(), "exp": expiresAt,
+			}),
+		},
+		{
+			name: "wrong secret",
+			token: func() string {
+				token, _ := SignChallenge("other", Challenge{UserUUID: uuid.New(), ChangedAt: 1, ExpiresAt: time.Now().Add(time.Hour)})
+				return token
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if challenge, err := ParseChallenge(secret, tt.token); err == nil {
+				t.Fatalf("expected the token to be refused, got %+v", challenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CommonList is the set of common and breached passwords loaded from a local file, one password
+// per line. Matching ignores case, lines starting with # are comments.
+type CommonList struct {
+	passwords map[string]struct{}
+}
+
+func LoadCommonList(path string) (*CommonList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open common password list: %w", err)
+	}
+	defer file.Close()
+
+	list := &CommonList{passwords: make(map[string]struct{})}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list.passwords[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read common password list: %w", err)
+	}
+	return list, nil
+}
+
+func (l *CommonList) Contains(password string) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.passwords[strings.ToLower(password)]
+	return ok
+}
+
+func (l *CommonList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.passwords)
+}
@@ -0,0 +1,75 @@
+package password
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Hash is the HMAC of a previous password kept in tbl_users_password_history, the user id is part
+// of the message so equal passwords of different users don't share a hash
+func Hash(secret string, userID uint64, password string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d|%s", userID, password)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsReused reports whether password is one of the last n passwords of the user
+func IsReused(db sqlx.Queryer, secret string, userID uint64, password string, n int) (bool, error) {
+	if n <= 0 {
+		return false, nil
+	}
+
+	var hashes []string
+	query := `
+		SELECT password_hash
+		FROM tbl_users_password_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+	if err := sqlx.Select(db, &hashes, query, userID, n); err != nil {
+		return false, fmt.Errorf("failed to query password history: %w", err)
+	}
+
+	hash := Hash(secret, userID, password)
+	for _, previous := range hashes {
+		if hmac.Equal([]byte(previous), []byte(hash)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Remember adds the new password of a user to the history and drops entries older than the last
+// keep ones. At least the current password is kept so a stricter policy has something to compare.
+func Remember(tx *sqlx.Tx, secret string, userID uint64, password string, keep int, now time.Time) error {
+	if keep < 1 {
+		keep = 1
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO tbl_users_password_history (user_id, password_hash, created_at)
+		VALUES ($1, $2, $3)`,
+		userID, Hash(secret, userID, password), now)
+	if err != nil {
+		return fmt.Errorf("failed to insert password history: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM tbl_users_password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM tbl_users_password_history
+			WHERE user_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		)`,
+		userID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package password
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Policy is the password policy of a role, see the password_* columns of tbl_roles.
+// History and MaxAgeDays of 0 disable the check, the max age is enforced by login.
+type Policy struct {
+	RoleId        int  `db:"role_id"`
+	MinLength     int  `db:"password_min_length"`
+	RequireUpper  bool `db:"password_require_upper"`
+	RequireLower  bool `db:"password_require_lower"`
+	RequireDigit  bool `db:"password_require_digit"`
+	RequireSymbol bool `db:"password_require_symbol"`
+	RejectCommon  bool `db:"password_reject_common"`
+	History       int  `db:"password_history"`
+	MaxAgeDays    int  `db:"password_max_age_days"`
+}
+
+// PolicyError lists every rule a password breaks, so the user can fix them at once
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+func LoadPolicy(db sqlx.Queryer, roleID int) (*Policy, error) {
+	var policy Policy
+	query := `
+		SELECT
+			id AS role_id,
+			password_min_length,
+			password_require_upper,
+			password_require_lower,
+			password_require_digit,
+			password_require_symbol,
+			password_reject_common,
+			password_history,
+			password_max_age_days
+		FROM tbl_roles
+		WHERE id = $1 AND deleted_at IS NULL`
+	err := sqlx.Get(db, &policy, query, roleID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("role `%d` not found", roleID)
+		}
+		return nil, fmt.Errorf("failed to query password policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// Check validates the content of a new password, reuse is checked separately with IsReused
+func (p *Policy) Check(password string, userName string, common *CommonList) error {
+	var violations []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if p.RejectCommon {
+		if userName != "" && strings.EqualFold(password, userName) {
+			violations = append(violations, "must not be the user name")
+		} else if common.Contains(password) {
+			violations = append(violations, "is too common")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
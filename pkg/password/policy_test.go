@@ -0,0 +1,65 @@
+package password
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	common := &CommonList{passwords: map[string]struct{}{"password1!": {}}}
+	strict := Policy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true, RejectCommon: true}
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		password   string
+		userName   string
+		violations []string
+	}{
+		{name: "valid", policy: strict, password: "Snack-shop7", userName: "alice"},
+		{name: "no rules", policy: Policy{}, password: "a"},
+		{name: "too short", policy: Policy{MinLength: 8}, password: "Ab1!", violations: []string{"must be at least 8 characters"}},
+		{name: "length counts characters", policy: Policy{MinLength: 4}, password: "ពាក្យ"},
+		{name: "missing upper", policy: Policy{RequireUpper: true}, password: "abc", violations: []string{"must contain an uppercase letter"}},
+		{name: "missing lower", policy: Policy{RequireLower: true}, password: "ABC", violations: []string{"must contain a lowercase letter"}},
+		{name: "missing digit", policy: Policy{RequireDigit: true}, password: "abc", violations: []string{"must contain a digit"}},
+		{name: "missing symbol", policy: Policy{RequireSymbol: true}, password: "abc1", violations: []string{"must contain a symbol"}},
+		{
+			name:     "every class missing",
+			policy:   strict,
+			password: "     ",
+			violations: []string{
+				"must be at least 8 characters",
+				"must contain an uppercase letter",
+				"must contain a lowercase letter",
+				"must contain a digit",
+				"must contain a symbol",
+			},
+		},
+		{name: "common", policy: strict, password: "Password1!", violations: []string{"is too common"}},
+		{name: "common allowed", policy: Policy{}, password: "Password1!"},
+		{name: "user name", policy: strict, password: "Alice-Shop1", userName: "alice-shop1", violations: []string{"must not be the user name"}},
+		{name: "user name allowed", policy: Policy{}, password: "alice", userName: "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password, tt.userName, common)
+			if len(tt.violations) == 0 {
+				if err != nil {
+					t.Fatalf("expected the password to pass, got %v", err)
+				}
+				return
+			}
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected a PolicyError, got %v", err)
+			}
+			if !reflect.DeepEqual(policyErr.Violations, tt.violations) {
+				t.Fatalf("expected %q, got %q", tt.violations, policyErr.Violations)
+			}
+		})
+	}
+}
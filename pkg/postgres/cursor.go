@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CursorKey is one column of a keyset. Column is the SQL expression used in WHERE and ORDER BY,
+// Field is the `db` tag of the struct field the value is read from when the cursor is built.
+type CursorKey struct {
+	Column string
+	Field  string
+	Desc   bool
+}
+
+// CursorPage is the paging state of a keyset page, the cursors are empty when there is no such page
+type CursorPage struct {
+	NextCursor string
+	PrevCursor string
+}
+
+type cursorPayload struct {
+	Sort     string   `json:"s"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b"`
+}
+
+// Cursor is a decoded and verified cursor
+type Cursor struct {
+	Values   []string
+	Backward bool
+}
+
+// BuildKeysetOrder builds the ORDER BY clause of a keyset page. A backward page is read in the
+// reversed order and flipped back by KeysetPage.
+func BuildKeysetOrder(keys []CursorKey, backward bool) string {
+	clauses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		desc := key.Desc != backward
+		if desc {
+			clauses = append(clauses, key.Column+" DESC")
+		} else {
+			clauses = append(clauses, key.Column+" ASC")
+		}
+	}
+	return " ORDER BY " + strings.Join(clauses, ", ")
+}
+
+// BuildKeysetFilter builds the condition selecting the rows after (or before) the cursor, e.g.
+// `(a > $1) OR (a = $1 AND b < $2)`. Parameters are numbered from paramIndex.
+func BuildKeysetFilter(keys []CursorKey, cursor *Cursor, paramIndex int) (string, []interface{}) {
+	if cursor == nil {
+		return "", nil
+	}
+
+	var ors []string
+	args := make([]interface{}, 0, len(keys))
+	for i, key := range keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s = $%d", keys[j].Column, paramIndex+j))
+		}
+		operator := ">"
+		if key.Desc != cursor.Backward {
+			operator = "<"
+		}
+		ands = append(ands, fmt.Sprintf("%s %s $%d", key.Column, operator, paramIndex+i))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		args = append(args, cursor.Values[i])
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// KeysetPage trims a result that was selected with LIMIT perPage+1, restores the requested order of a
+// backward page and builds the cursors of the neighbouring pages
+func KeysetPage[T any](rows []T, perPage int, keys []CursorKey, cursor *Cursor) ([]T, *CursorPage, error) {
+	more := len(rows) > perPage
+	if more {
+		rows = rows[:perPage]
+	}
+
+	backward := cursor != nil && cursor.Backward
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := &CursorPage{}
+	if len(rows) == 0 {
+		return rows, page, nil
+	}
+
+	hasNext := more || backward
+	hasPrev := (backward && more) || (!backward && cursor != nil)
+
+	if hasNext {
+		values, err := cursorValues(rows[len(rows)-1], keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.NextCursor = EncodeCursor(keys, values, false)
+	}
+	if hasPrev {
+		values, err := cursorValues(rows[0], keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		page.PrevCursor = EncodeCursor(keys, values, true)
+	}
+	return rows, page, nil
+}
+
+// EncodeCursor returns an opaque token signed with CURSOR_SECRET_KEY. The sort is part of the
+// signed payload so a cursor cannot be replayed against another order.
+func EncodeCursor(keys []CursorKey, values []string, backward bool) string {
+	payload, _ := json.Marshal(cursorPayload{Sort: cursorSort(keys), Values: values, Backward: backward})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + cursorSignature(encoded)
+}
+
+// DecodeCursor verifies a token built by EncodeCursor for the same keys
+func DecodeCursor(token string, keys []CursorKey) (*Cursor, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(cursorSignature(encoded))) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if payload.Sort != cursorSort(keys) || len(payload.Values) != len(keys) {
+		return nil, fmt.Errorf("cursor does not match the requested sort")
+	}
+
+	return &Cursor{Values: payload.Values, Backward: payload.Backward}, nil
+}
+
+func cursorSort(keys []CursorKey) string {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.Desc {
+			parts = append(parts, key.Column+" desc")
+		} else {
+			parts = append(parts, key.Column+" asc")
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func cursorSignature(encoded string) string {
+	secret := os.Getenv("CURSOR_SECRET_KEY")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET_KEY")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// cursorValues reads the keyset values from the struct fields tagged with the keys' `db` names.
+// Values are kept as text, PostgreSQL casts them to the column type when they are compared.
+func cursorValues(row interface{}, keys []CursorKey) ([]string, error) {
+	val := reflect.Indirect(reflect.ValueOf(row))
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cursor row must be a struct")
+	}
+
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		field, ok := fieldByDbTag(val, key.Field)
+		if !ok {
+			return nil, fmt.Errorf("cursor field `%s` not found", key.Field)
+		}
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return nil, fmt.Errorf("cursor field `%s` is null", key.Field)
+			}
+			field = field.Elem()
+		}
+
+		switch v := field.Interface().(type) {
+		case time.Time:
+			// Timestamps are stored without time zone, keep the wall clock only
+			values = append(values, v.Format("2006-01-02T15:04:05.999999999"))
+		case fmt.Stringer:
+			values = append(values, v.String())
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	return values, nil
+}
+
+func fieldByDbTag(val reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < val.NumField(); i++ {
+		if strings.Split(val.Type().Field(i).Tag.Get("db"), ",")[0] == name {
+			return val.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,307 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	types "snack-shop/pkg/model"
+)
+
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldInt
+	FieldBool
+	FieldDecimal
+	FieldUUID
+	FieldTime
+)
+
+const (
+	OpEq      = "eq"
+	OpNe      = "ne"
+	OpGt      = "gt"
+	OpGte     = "gte"
+	OpLt      = "lt"
+	OpLte     = "lte"
+	OpIn      = "in"
+	OpIlike   = "ilike"
+	OpIsNull  = "is_null"
+	OpBetween = "between"
+)
+
+// Default operator sets, is_null is only accepted on Nullable fields
+var (
+	OpsString   = []string{OpEq, OpNe, OpIn, OpIlike, OpIsNull}
+	OpsNumber   = []string{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpBetween, OpIsNull}
+	OpsTime     = []string{OpEq, OpGt, OpGte, OpLt, OpLte, OpBetween, OpIsNull}
+	OpsBool     = []string{OpEq, OpNe, OpIsNull}
+	OpsIdentity = []string{OpEq, OpNe, OpIn}
+)
+
+var comparisons = map[string]string{
+	OpEq:  "=",
+	OpNe:  "!=",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+// Field describes one public field of a resource. Column is only ever taken from the registry,
+// never from the request. Key is the `db` tag the value is read from when a cursor is built.
+type Field struct {
+	Column    string
+	Type      FieldType
+	Operators []string
+	Sortable  bool
+	Nullable  bool
+	Key       string
+}
+
+// FieldRegistry maps the public field names of a resource to their columns
+type FieldRegistry map[string]Field
+
+func (r FieldRegistry) lookup(name string) (Field, error) {
+	field, ok := r[name]
+	if !ok {
+		return Field{}, fmt.Errorf("unknown field `%s`", name)
+	}
+	return field, nil
+}
+
+// BuildSort builds the ORDER BY clause, defaultOrder is used when no sort is requested
+func (r FieldRegistry) BuildSort(sorts []types.Sort, defaultOrder string) (string, error) {
+	if len(sorts) == 0 {
+		return " ORDER BY " + defaultOrder, nil
+	}
+
+	clauses := make([]string, 0, len(sorts))
+	for _, sort := range sorts {
+		field, err := r.lookup(sort.Property)
+		if err != nil {
+			return "", err
+		}
+		if !field.Sortable {
+			return "", fmt.Errorf("field `%s` is not sortable", sort.Property)
+		}
+		direction, err := sortDirection(sort.Direction)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, field.Column+" "+direction)
+	}
+	return " ORDER BY " + strings.Join(clauses, ", "), nil
+}
+
+// CursorKeys maps the requested sorts to keyset columns. A key is read back from the row to build the
+// next cursor, so only sortable NOT NULL fields with a Key can be used. The tiebreaker is always
+// appended so the order is total.
+func (r FieldRegistry) CursorKeys(sorts []types.Sort, tiebreaker CursorKey) ([]CursorKey, error) {
+	keys := make([]CursorKey, 0, len(sorts)+1)
+	for _, sort := range sorts {
+		field, err := r.lookup(sort.Property)
+		if err != nil {
+			return nil, err
+		}
+		if !field.Sortable || field.Nullable || field.Key == "" {
+			return nil, fmt.Errorf("cannot use cursor paging with sort field `%s`", sort.Property)
+		}
+		direction, err := sortDirection(sort.Direction)
+		if err != nil {
+			return nil, err
+		}
+		if field.Column == tiebreaker.Column {
+			continue
+		}
+		keys = append(keys, CursorKey{Column: field.Column, Field: field.Key, Desc: direction == "DESC"})
+	}
+	return append(keys, tiebreaker), nil
+}
+
+// BuildFilter builds the WHERE condition of the filters with parameters numbered from paramIndex.
+// Filters sharing a group are OR'ed together, everything else is AND'ed.
+func (r FieldRegistry) BuildFilter(filters []types.Filter, paramIndex int) (string, []interface{}, error) {
+	var conditions []string
+	var params []interface{}
+	groups := map[string]int{}
+
+	for _, filter := range filters {
+		name, operator := filter.Property, filter.Operator
+		// The older `field__gte` form is still accepted
+		if before, after, ok := strings.Cut(name, "__"); ok && operator == "" {
+			name, operator = before, after
+		}
+		if operator == "" {
+			operator = OpEq
+		}
+
+		field, err := r.lookup(name)
+		if err != nil {
+			return "", nil, err
+		}
+		condition, args, err := field.condition(name, operator, filter.Value, paramIndex+len(params))
+		if err != nil {
+			return "", nil, err
+		}
+		params = append(params, args...)
+
+		if filter.Group == "" {
+			conditions = append(conditions, condition)
+			continue
+		}
+		if i, ok := groups[filter.Group]; ok {
+			conditions[i] = conditions[i] + " OR " + condition
+		} else {
+			groups[filter.Group] = len(conditions)
+			conditions = append(conditions, condition)
+		}
+	}
+
+	for i := range conditions {
+		conditions[i] = "(" + conditions[i] + ")"
+	}
+	return strings.Join(conditions, " AND "), params, nil
+}
+
+func (f Field) allows(operator string) bool {
+	if operator == OpIsNull && !f.Nullable {
+		return false
+	}
+	for _, op := range f.Operators {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Field) condition(name string, operator string, value interface{}, paramIndex int) (string, []interface{}, error) {
+	if !f.allows(operator) {
+		return "", nil, fmt.Errorf("operator `%s` is not allowed on field `%s`", operator, name)
+	}
+	raw := strings.TrimSpace(fmt.Sprint(value))
+	if value == nil || raw == "" {
+		return "", nil, fmt.Errorf("missing value for field `%s`", name)
+	}
+
+	switch operator {
+	case OpIsNull:
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("field `%s`: is_null expects true or false", name)
+		}
+		if isNull {
+			return f.Column + " IS NULL", nil, nil
+		}
+		return f.Column + " IS NOT NULL", nil, nil
+
+	case OpIn:
+		parts := strings.Split(raw, ",")
+		args := make([]interface{}, 0, len(parts))
+		placeholders := make([]string, 0, len(parts))
+		for i, part := range parts {
+			v, err := f.parse(name, part, false)
+			if err != nil {
+				return "", nil, err
+			}
+			args = append(args, v)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", paramIndex+i))
+		}
+		return fmt.Sprintf("%s IN (%s)", f.Column, strings.Join(placeholders, ", ")), args, nil
+
+	case OpBetween:
+		from, to, ok := strings.Cut(raw, ",")
+		if !ok {
+			return "", nil, fmt.Errorf("field `%s`: between expects two comma separated values", name)
+		}
+		start, err := f.parse(name, from, false)
+		if err != nil {
+			return "", nil, err
+		}
+		end, err := f.parse(name, to, true)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s BETWEEN $%d AND $%d", f.Column, paramIndex, paramIndex+1), []interface{}{start, end}, nil
+
+	case OpIlike:
+		// A substring match, wildcards in the value are matched literally
+		return fmt.Sprintf("%s ILIKE $%d", f.Column, paramIndex), []interface{}{"%" + escapeLike(raw) + "%"}, nil
+	}
+
+	v, err := f.parse(name, raw, operator == OpLte)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%s %s $%d", f.Column, comparisons[operator], paramIndex), []interface{}{v}, nil
+}
+
+// escapeLike makes value match literally in a LIKE pattern, \ is the default escape character
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// parse converts a query string value to the field type. A date only upper bound covers the whole day.
+func (f Field) parse(name string, raw string, upperBound bool) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	invalid := func(expected string) error {
+		return fmt.Errorf("field `%s`: `%s` is not a valid %s", name, raw, expected)
+	}
+
+	switch f.Type {
+	case FieldInt:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, invalid("integer")
+		}
+		return v, nil
+	case FieldBool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, invalid("boolean")
+		}
+		return v, nil
+	case FieldDecimal:
+		v, err := decimal.NewFromString(raw)
+		if err != nil {
+			return nil, invalid("decimal")
+		}
+		return v, nil
+	case FieldUUID:
+		v, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, invalid("uuid")
+		}
+		return v, nil
+	case FieldTime:
+		if v, err := time.Parse("2006-01-02", raw); err == nil {
+			if upperBound {
+				v = v.Add(24*time.Hour - time.Nanosecond)
+			}
+			return v, nil
+		}
+		v, err := time.Parse("2006-01-02T15:04:05", raw)
+		if err != nil {
+			return nil, invalid("date")
+		}
+		return v, nil
+	}
+	return raw, nil
+}
+
+func sortDirection(direction string) (string, error) {
+	switch strings.ToLower(direction) {
+	case "", "asc":
+		return "ASC", nil
+	case "desc":
+		return "DESC", nil
+	}
+	return "", fmt.Errorf("invalid sort direction `%s`", direction)
+}
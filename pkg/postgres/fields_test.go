@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"testing"
+
+	types "snack-shop/pkg/model"
+)
+
+func TestBuildFilterIlike(t *testing.T) {
+	fields := FieldRegistry{
+		"user_name": {Column: "u.user_name", Type: FieldString, Operators: OpsString},
+	}
+
+	tests := []struct {
+		value   string
+		pattern string
+	}{
+		{value: "john", pattern: "%john%"},
+		{value: "100%", pattern: `%100\%%`},
+		{value: "john_doe", pattern: `%john\_doe%`},
+		{value: `a\b`, pattern: `%a\\b%`},
+		{value: "%", pattern: `%\%%`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			where, args, err := fields.BuildFilter([]types.Filter{{Property: "user_name", Operator: OpIlike, Value: tt.value}}, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if where != "(u.user_name ILIKE $3)" {
+				t.Fatalf("unexpected condition %s", where)
+			}
+			if len(args) != 1 || args[0] != tt.pattern {
+				t.Fatalf("expected pattern %s, got %v", tt.pattern, args)
+			}
+		})
+	}
+}
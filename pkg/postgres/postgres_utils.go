@@ -3,14 +3,11 @@ package postgres
 import (
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-
-	types "snack-shop/pkg/model"
 )
 
 // CountRow counts the number of rows returned by a query
@@ -70,107 +67,6 @@ func ToTimeFormat(v interface{}) (map[string]interface{}, error) {
 	return result, nil
 }
 
-// BuildSQLSort builds ORDER BY clause from Sort objects
-func BuildSQLSort(sorts []types.Sort) string {
-	if len(sorts) == 0 {
-		return " ORDER BY id" // Default order
-	}
-
-	var orderClauses []string
-	for _, sort := range sorts {
-		orderClauses = append(orderClauses, fmt.Sprintf("%s %s", sort.Property, sort.Direction))
-	}
-
-	return " ORDER BY " + strings.Join(orderClauses, ", ")
-}
-
-func BuildSQLFilter(req []types.Filter) (string, []interface{}) {
-	var sqlFilters []string
-	var params []interface{}
-	paramIndex := 1
-
-	for _, filter := range req {
-		if filter.Property == "" || filter.Value == nil {
-			continue
-		}
-
-		property := filter.Property
-		operator := "="
-
-		// ✅ Support operators: __gte, __lte, __gt, __lt, __ne
-		if strings.Contains(property, "__") {
-			parts := strings.Split(property, "__")
-			property = parts[0]
-			switch parts[1] {
-			case "gte":
-				operator = ">="
-			case "lte":
-				operator = "<="
-			case "gt":
-				operator = ">"
-			case "lt":
-				operator = "<"
-			case "ne":
-				operator = "!="
-			}
-		}
-
-		// ✅ Handle BETWEEN for slice values
-		switch v := filter.Value.(type) {
-		case []interface{}:
-			if len(v) == 2 {
-				// Try to convert date strings to time.Time
-				startStr, ok1 := v[0].(string)
-				endStr, ok2 := v[1].(string)
-				if ok1 && ok2 {
-					if startTime, err := time.Parse("2006-01-02", startStr); err == nil {
-						if endTime, err := time.Parse("2006-01-02", endStr); err == nil {
-							v[0] = startTime
-							v[1] = endTime.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-						}
-					}
-				}
-
-				sqlFilters = append(sqlFilters, fmt.Sprintf("%s BETWEEN $%d AND $%d", property, paramIndex, paramIndex+1))
-				params = append(params, v[0], v[1])
-				paramIndex += 2
-				continue
-			}
-		}
-
-		// ✅ Auto-convert types for single values
-		switch val := filter.Value.(type) {
-		case string:
-			// Try parse date
-			if t, err := time.Parse("2006-01-02", val); err == nil {
-				filter.Value = t
-			} else if intValue, err := strconv.Atoi(val); err == nil {
-				filter.Value = intValue
-			} else if boolValue, err := strconv.ParseBool(val); err == nil {
-				filter.Value = boolValue
-			}
-		}
-
-		// Build SQL by final type
-		switch val := filter.Value.(type) {
-		case int, bool, time.Time:
-			sqlFilters = append(sqlFilters, fmt.Sprintf("%s %s $%d", property, operator, paramIndex))
-			params = append(params, val)
-		case string:
-			if strings.Contains(val, "%") {
-				sqlFilters = append(sqlFilters, fmt.Sprintf("%s LIKE $%d", property, paramIndex))
-			} else {
-				sqlFilters = append(sqlFilters, fmt.Sprintf("%s %s $%d", property, operator, paramIndex))
-			}
-			params = append(params, val)
-		}
-
-		paramIndex++
-	}
-
-	return strings.Join(sqlFilters, " AND "), params
-}
-
 // GetIdByUuid returns the ID for a given UUID
 func GetIdByUuid(space_name string, uuid_field_name string, uuid_str string, db *sqlx.Tx) (*int, error) {
 	var id int
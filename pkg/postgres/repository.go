@@ -0,0 +1,612 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	types "snack-shop/pkg/model"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrNoActor  = errors.New("missing user context")
+)
+
+// Audit actions passed to Table.Audit
+const (
+	AuditInsert  = "insert"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// Table describes the table behind a Repository. The columns come from the `db` tags of the model,
+// the `repo` tag adds options:
+//
+//	pk          serial primary key, filled from RETURNING on insert
+//	uuid        public identifier, generated on insert when empty
+//	readonly    selected but never written, use `expr` to select it from a join
+//	noupdate    written on insert, updated only when named in Update's columns
+//	noselect    never selected (e.g. password)
+//	created_by, created_at, updated_by, updated_at, deleted_by, deleted_at
+//	            filled by the repository, deleted_at enables soft delete
+type Table struct {
+	Name         string
+	Alias        string
+	Joins        string
+	Fields       FieldRegistry
+	Search       *Search
+	DefaultOrder string
+	// Audit runs after the transaction that changed the row has been committed, detail is empty
+	// for the generic actions
+	Audit func(ctx context.Context, action string, actorID int, row interface{}, detail string)
+}
+
+// ListOptions is the request of a paged list
+type ListOptions struct {
+	Paging  types.Paging
+	Sorts   []types.Sort
+	Filters []types.Filter
+	Query   string
+}
+
+// Page is one page of a list, Total is only set when the paging asks for it
+type Page[T any] struct {
+	Rows   []T
+	Total  int
+	Cursor *CursorPage
+}
+
+// Repository implements list, get, insert, update, soft delete and restore for a model
+type Repository[T any] struct {
+	db      *sqlx.DB
+	table   Table
+	userCtx *types.UserContext
+	model   *model
+}
+
+// Model holds the columns of T read from its tags. Repositories are created per request, so the
+// model is built once in a package level var, e.g. var playerModel = postgres.MustModel[Player](),
+// and a model with missing tags stops the app at start up.
+type Model[T any] struct {
+	model *model
+}
+
+// MustModel reads the tags of T and panics if it has no `repo:"pk"` or `repo:"uuid"` field
+func MustModel[T any]() Model[T] {
+	m, err := modelOf(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		panic(err)
+	}
+	return Model[T]{model: m}
+}
+
+// Repository returns a repository of the model for table
+func (m Model[T]) Repository(db *sqlx.DB, table Table, userCtx *types.UserContext) *Repository[T] {
+	return &Repository[T]{
+		db:      db,
+		table:   table,
+		userCtx: userCtx,
+		model:   m.model,
+	}
+}
+
+type txKey struct{}
+
+type txState struct {
+	tx    *sqlx.Tx
+	after []func()
+}
+
+type queryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Transaction runs fn in a transaction. Repository calls made with the ctx passed to fn join the
+// transaction and their audit hooks run once it has been committed. Nested calls reuse the outer one.
+func (r *Repository[T]) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return Transaction(ctx, r.db, fn)
+}
+
+func Transaction(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return fn(ctx)
+	}
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	state := &txState{tx: tx}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+
+	for _, after := range state.after {
+		after()
+	}
+	return nil
+}
+
+func (r *Repository[T]) queryer(ctx context.Context) queryer {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
+	}
+	return r.db
+}
+
+// Audit queues an audit entry for a module specific action, it is written once the transaction of
+// ctx has been committed
+func (r *Repository[T]) Audit(ctx context.Context, action string, actorID int, row *T, detail string) {
+	if r.table.Audit == nil {
+		return
+	}
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		r.table.Audit(ctx, action, actorID, row, detail)
+		return
+	}
+	state.after = append(state.after, func() {
+		r.table.Audit(ctx, action, actorID, row, detail)
+	})
+}
+
+// Exec runs a module specific statement in the transaction of ctx, ErrNotFound when no row matched
+func (r *Repository[T]) Exec(ctx context.Context, query string, args ...interface{}) error {
+	return r.exec(ctx, query, args...)
+}
+
+// Select runs a module specific query in the transaction of ctx and scans all rows into dest
+func (r *Repository[T]) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return r.queryer(ctx).SelectContext(ctx, dest, query, args...)
+}
+
+// SelectOne runs a module specific query in the transaction of ctx and scans one row into dest,
+// ErrNotFound when there is none
+func (r *Repository[T]) SelectOne(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if err := r.queryer(ctx).GetContext(ctx, dest, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// GetForUpdate returns a non deleted row and locks it until the transaction of ctx ends
+func (r *Repository[T]) GetForUpdate(ctx context.Context, id uuid.UUID) (*T, error) {
+	return r.get(ctx, id, false, true)
+}
+
+// List returns one page of the non deleted rows, offset or cursor based like types.Paging asks
+func (r *Repository[T]) List(ctx context.Context, opts ListOptions) (*Page[T], error) {
+	where, args, err := r.table.Fields.BuildFilter(opts.Filters, 1)
+	if err != nil {
+		return nil, err
+	}
+	conditions := []string{}
+	if deletedAt := r.model.roles["deleted_at"]; deletedAt != nil {
+		conditions = append(conditions, r.column(deletedAt.name)+" IS NULL")
+	}
+	if where != "" {
+		conditions = append(conditions, where)
+	}
+
+	var rank string
+	if opts.Query != "" && r.table.Search != nil {
+		search, searchRank, searchArgs := r.table.Search.Build(opts.Query, len(args)+1)
+		conditions = append(conditions, search)
+		args = append(args, searchArgs...)
+		rank = searchRank
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	from := fmt.Sprintf(" FROM %s %s %s", r.table.Name, r.table.Alias, r.table.Joins)
+
+	paging := opts.Paging
+	pageWhereClause := whereClause
+	pageArgs := append([]interface{}{}, args...)
+
+	var orderBy, limit string
+	var keys []CursorKey
+	var cursor *Cursor
+	if paging.IsCursor() {
+		// A rank cannot be used as a keyset, in cursor mode a search only filters
+		keys, err = r.table.Fields.CursorKeys(opts.Sorts, CursorKey{Column: r.table.Alias + "." + r.model.pk.name, Field: r.model.pk.name})
+		if err != nil {
+			return nil, err
+		}
+		if paging.Cursor != "" {
+			if cursor, err = DecodeCursor(paging.Cursor, keys); err != nil {
+				return nil, err
+			}
+		}
+		keyset, keysetArgs := BuildKeysetFilter(keys, cursor, len(pageArgs)+1)
+		if keyset != "" {
+			if pageWhereClause == "" {
+				pageWhereClause = " WHERE " + keyset
+			} else {
+				pageWhereClause += " AND " + keyset
+			}
+			pageArgs = append(pageArgs, keysetArgs...)
+		}
+		orderBy = BuildKeysetOrder(keys, cursor != nil && cursor.Backward)
+		limit = fmt.Sprintf(" LIMIT %d", paging.Perpage+1)
+	} else {
+		defaultOrder := r.table.DefaultOrder
+		if defaultOrder == "" {
+			defaultOrder = r.column(r.model.pk.name)
+		}
+		if rank != "" {
+			defaultOrder = rank + " DESC, " + defaultOrder
+		}
+		if orderBy, err = r.table.Fields.BuildSort(opts.Sorts, defaultOrder); err != nil {
+			return nil, err
+		}
+		limit = fmt.Sprintf(" LIMIT %d OFFSET %d", paging.Perpage, (paging.Page-1)*paging.Perpage)
+	}
+
+	page := &Page[T]{}
+	query := "SELECT " + r.selectList() + from + pageWhereClause + orderBy + limit
+	if err := r.queryer(ctx).SelectContext(ctx, &page.Rows, query, pageArgs...); err != nil {
+		return nil, fmt.Errorf("cannot select %s: %w", r.table.Name, err)
+	}
+
+	if paging.IsCursor() {
+		if page.Rows, page.Cursor, err = KeysetPage(page.Rows, paging.Perpage, keys, cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	if paging.CountTotal() {
+		if err := r.queryer(ctx).GetContext(ctx, &page.Total, "SELECT COUNT(*)"+from+whereClause, args...); err != nil {
+			return nil, fmt.Errorf("cannot count %s: %w", r.table.Name, err)
+		}
+	}
+	return page, nil
+}
+
+// Get returns a non deleted row by its public uuid
+func (r *Repository[T]) Get(ctx context.Context, id uuid.UUID) (*T, error) {
+	return r.get(ctx, id, false, false)
+}
+
+func (r *Repository[T]) get(ctx context.Context, id uuid.UUID, deleted bool, lock bool) (*T, error) {
+	var row T
+	if err := r.queryer(ctx).GetContext(ctx, &row, r.getQuery(deleted, lock), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("cannot select %s: %w", r.table.Name, err)
+	}
+	return &row, nil
+}
+
+func (r *Repository[T]) getQuery(deleted bool, lock bool) string {
+	query := "SELECT " + r.selectList() + fmt.Sprintf(" FROM %s %s %s WHERE %s = $1", r.table.Name, r.table.Alias, r.table.Joins, r.column(r.model.uuid.name))
+	if deletedAt := r.model.roles["deleted_at"]; deletedAt != nil {
+		if deleted {
+			query += " AND " + r.column(deletedAt.name) + " IS NOT NULL"
+		} else {
+			query += " AND " + r.column(deletedAt.name) + " IS NULL"
+		}
+	}
+	if lock {
+		query += " FOR UPDATE OF " + r.table.Alias
+	}
+	return query
+}
+
+// Insert writes a new row, the primary key, uuid and created_* columns are filled in on row
+func (r *Repository[T]) Insert(ctx context.Context, row *T) error {
+	return r.Transaction(ctx, func(ctx context.Context) error {
+		actorID, now, err := r.Actor(ctx)
+		if err != nil {
+			return err
+		}
+
+		val := reflect.ValueOf(row).Elem()
+		if id := val.FieldByIndex(r.model.uuid.index); id.Interface().(uuid.UUID) == uuid.Nil {
+			id.Set(reflect.ValueOf(uuid.Must(uuid.NewV7())))
+		}
+		r.setRole(val, "created_by", actorID)
+		r.setRole(val, "created_at", now)
+
+		query, args := r.insertQuery(val)
+		if err := r.queryer(ctx).GetContext(ctx, val.FieldByIndex(r.model.pk.index).Addr().Interface(), query, args...); err != nil {
+			return fmt.Errorf("cannot insert %s: %w", r.table.Name, err)
+		}
+
+		r.Audit(ctx, AuditInsert, actorID, row, "")
+		return nil
+	})
+}
+
+func (r *Repository[T]) insertQuery(val reflect.Value) (string, []interface{}) {
+	var columns, placeholders []string
+	var args []interface{}
+	for _, c := range r.model.columns {
+		if c.pk || c.readonly || (c.role != "" && c.role != "created_by" && c.role != "created_at") {
+			continue
+		}
+		args = append(args, val.FieldByIndex(c.index).Interface())
+		columns = append(columns, quote(c.name))
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
+		r.table.Name, strings.Join(columns, ", "), strings.Join(placeholders, ", "), quote(r.model.pk.name))
+	return query, args
+}
+
+// Update writes the given columns of row (all updatable columns when none are given) and fills
+// the updated_* columns
+func (r *Repository[T]) Update(ctx context.Context, id uuid.UUID, row *T, columns ...string) error {
+	return r.Transaction(ctx, func(ctx context.Context) error {
+		actorID, now, err := r.Actor(ctx)
+		if err != nil {
+			return err
+		}
+
+		val := reflect.ValueOf(row).Elem()
+		r.setRole(val, "updated_by", actorID)
+		r.setRole(val, "updated_at", now)
+
+		query, args := r.updateQuery(val, id, columns)
+		if err := r.exec(ctx, query, args...); err != nil {
+			return err
+		}
+
+		updated, err := r.get(ctx, id, false, false)
+		if err != nil {
+			return err
+		}
+		*row = *updated
+
+		r.Audit(ctx, AuditUpdate, actorID, row, "")
+		return nil
+	})
+}
+
+func (r *Repository[T]) updateQuery(val reflect.Value, id uuid.UUID, columns []string) (string, []interface{}) {
+	only := map[string]bool{}
+	for _, column := range columns {
+		only[column] = true
+	}
+
+	var sets []string
+	var args []interface{}
+	for _, c := range r.model.columns {
+		switch {
+		case c.role == "updated_by" || c.role == "updated_at":
+		case c.pk || c.uuid || c.readonly || c.role != "":
+			continue
+		case len(only) > 0:
+			if !only[c.name] {
+				continue
+			}
+		case c.noupdate:
+			continue
+		}
+		args = append(args, val.FieldByIndex(c.index).Interface())
+		sets = append(sets, fmt.Sprintf("%s = $%d", quote(c.name), len(args)))
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s = $%d", r.table.Name, strings.Join(sets, ", "), quote(r.model.uuid.name), len(args))
+	if deletedAt := r.model.roles["deleted_at"]; deletedAt != nil {
+		query += " AND " + quote(deletedAt.name) + " IS NULL"
+	}
+	return query, args
+}
+
+// SoftDelete marks the row as deleted, it disappears from List and Get
+func (r *Repository[T]) SoftDelete(ctx context.Context, id uuid.UUID) (*T, error) {
+	return r.setDeleted(ctx, id, true)
+}
+
+// Restore brings back a soft deleted row
+func (r *Repository[T]) Restore(ctx context.Context, id uuid.UUID) (*T, error) {
+	return r.setDeleted(ctx, id, false)
+}
+
+func (r *Repository[T]) setDeleted(ctx context.Context, id uuid.UUID, deleted bool) (*T, error) {
+	if r.model.roles["deleted_at"] == nil || r.model.roles["deleted_by"] == nil {
+		return nil, fmt.Errorf("%s does not support soft delete", r.table.Name)
+	}
+
+	var row *T
+	err := r.Transaction(ctx, func(ctx context.Context) error {
+		actorID, now, err := r.Actor(ctx)
+		if err != nil {
+			return err
+		}
+		if row, err = r.get(ctx, id, !deleted, true); err != nil {
+			return err
+		}
+
+		deletedBy, deletedAt, action := interface{}(actorID), interface{}(now), AuditDelete
+		if !deleted {
+			deletedBy, deletedAt, action = nil, nil, AuditRestore
+		}
+		if err := r.exec(ctx, r.deleteQuery(), deletedBy, deletedAt, id); err != nil {
+			return err
+		}
+
+		r.Audit(ctx, action, actorID, row, "")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// deleteQuery sets the deleted_* columns, $1 is the actor, $2 the time and $3 the uuid
+func (r *Repository[T]) deleteQuery() string {
+	return fmt.Sprintf("UPDATE %s SET %s = $1, %s = $2 WHERE %s = $3", r.table.Name,
+		quote(r.model.roles["deleted_by"].name), quote(r.model.roles["deleted_at"].name), quote(r.model.uuid.name))
+}
+
+func (r *Repository[T]) exec(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.queryer(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("cannot update %s: %w", r.table.Name, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Actor resolves the id of the logged in user and the local time stamped on the row, it has to
+// run inside Transaction
+func (r *Repository[T]) Actor(ctx context.Context) (int, time.Time, error) {
+	if r.userCtx == nil || r.userCtx.UserUuid == "" {
+		return 0, time.Time{}, ErrNoActor
+	}
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("actor must be resolved inside a transaction")
+	}
+	id, err := GetIdByUuid("tbl_users", "user_uuid", r.userCtx.UserUuid, state.tx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	location, err := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to load location: %w", err)
+	}
+	return *id, time.Now().In(location), nil
+}
+
+func (r *Repository[T]) setRole(val reflect.Value, role string, value interface{}) {
+	c := r.model.roles[role]
+	if c == nil {
+		return
+	}
+	field := val.FieldByIndex(c.index)
+	v := reflect.ValueOf(value)
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(v.Convert(field.Type().Elem()))
+		field.Set(ptr)
+		return
+	}
+	field.Set(v.Convert(field.Type()))
+}
+
+func (r *Repository[T]) column(name string) string {
+	return r.table.Alias + "." + quote(name)
+}
+
+func (r *Repository[T]) selectList() string {
+	list := make([]string, 0, len(r.model.columns))
+	for _, c := range r.model.columns {
+		if c.noselect {
+			continue
+		}
+		if c.expr != "" {
+			list = append(list, c.expr+" AS "+quote(c.name))
+		} else {
+			list = append(list, r.column(c.name))
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// quote protects column names that are keywords, like "order"
+func quote(name string) string {
+	return `"` + name + `"`
+}
+
+type modelColumn struct {
+	name     string
+	expr     string
+	index    []int
+	pk       bool
+	uuid     bool
+	readonly bool
+	noupdate bool
+	noselect bool
+	role     string
+}
+
+type model struct {
+	columns []*modelColumn
+	pk      *modelColumn
+	uuid    *modelColumn
+	roles   map[string]*modelColumn
+}
+
+var models sync.Map
+
+func modelOf(t reflect.Type) (*model, error) {
+	if m, ok := models.Load(t); ok {
+		return m.(*model), nil
+	}
+
+	m := &model{roles: map[string]*modelColumn{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("db"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		c := &modelColumn{name: name, expr: f.Tag.Get("expr"), index: f.Index}
+		for _, option := range strings.Split(f.Tag.Get("repo"), ",") {
+			switch option {
+			case "pk":
+				c.pk = true
+				m.pk = c
+			case "uuid":
+				c.uuid = true
+				m.uuid = c
+			case "readonly":
+				c.readonly = true
+			case "noupdate":
+				c.noupdate = true
+			case "noselect":
+				c.noselect = true
+			case "created_by", "created_at", "updated_by", "updated_at", "deleted_by", "deleted_at":
+				c.role = option
+				m.roles[option] = c
+			}
+		}
+		m.columns = append(m.columns, c)
+	}
+
+	if m.pk == nil || m.uuid == nil {
+		return nil, fmt.Errorf("postgres: model %s needs a `repo:\"pk\"` and a `repo:\"uuid\"` field", t.Name())
+	}
+
+	models.Store(t, m)
+	return m, nil
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testRow struct {
+	ID         int        `db:"id" repo:"pk"`
+	Uuid       uuid.UUID  `db:"row_uuid" repo:"uuid"`
+	Name       string     `db:"name"`
+	Order      int        `db:"order"`
+	Code       string     `db:"code" repo:"noupdate"`
+	Secret     string     `db:"secret" repo:"noselect"`
+	OwnerName  string     `db:"owner_name" repo:"readonly" expr:"o.name"`
+	CreatedBy  int        `db:"created_by" repo:"created_by"`
+	CreatedAt  time.Time  `db:"created_at" repo:"created_at"`
+	UpdatedBy  *int       `db:"updated_by" repo:"updated_by"`
+	UpdatedAt  *time.Time `db:"updated_at" repo:"updated_at"`
+	RemovedBy  *int       `db:"removed_by" repo:"deleted_by"`
+	RemovedAt  *time.Time `db:"removed_at" repo:"deleted_at"`
+	Ignored    string     `db:"-"`
+	NotAColumn string
+}
+
+type plainRow struct {
+	ID   int       `db:"id" repo:"pk"`
+	Uuid uuid.UUID `db:"uuid" repo:"uuid"`
+	Name string    `db:"name"`
+}
+
+func testRepository[T any]() *Repository[T] {
+	return MustModel[T]().Repository(nil, Table{Name: "tbl_rows", Alias: "r", Joins: "LEFT JOIN tbl_owners o ON o.id = r.owner_id"}, nil)
+}
+
+func TestModelOf(t *testing.T) {
+	m, err := modelOf(reflect.TypeOf(testRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.columns) != 13 {
+		t.Fatalf("expected 13 columns, got %d", len(m.columns))
+	}
+	if m.pk.name != "id" || m.uuid.name != "row_uuid" {
+		t.Fatalf("unexpected keys %s %s", m.pk.name, m.uuid.name)
+	}
+	roles := map[string]string{
+		"created_by": "created_by", "created_at": "created_at", "updated_by": "updated_by",
+		"updated_at": "updated_at", "deleted_by": "removed_by", "deleted_at": "removed_at",
+	}
+	for role, name := range roles {
+		if c := m.roles[role]; c == nil || c.name != name {
+			t.Fatalf("expected role %s on %s, got %+v", role, name, c)
+		}
+	}
+
+	tests := []struct {
+		name string
+		row  interface{}
+	}{
+		{name: "missing pk", row: struct {
+			Uuid uuid.UUID `db:"uuid" repo:"uuid"`
+		}{}},
+		{name: "missing uuid", row: struct {
+			ID int `db:"id" repo:"pk"`
+		}{}},
+		{name: "untagged keys", row: struct {
+			ID   int       `db:"id"`
+			Uuid uuid.UUID `db:"uuid"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := modelOf(reflect.TypeOf(tt.row)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestMustModelPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected MustModel to panic")
+		}
+	}()
+	MustModel[struct {
+		Name string `db:"name"`
+	}]()
+}
+
+func TestSelectQuery(t *testing.T) {
+	r := testRepository[testRow]()
+	want := `SELECT r."id", r."row_uuid", r."name", r."order", r."code", o.name AS "owner_name", r."created_by", r."created_at", ` +
+		`r."updated_by", r."updated_at", r."removed_by", r."removed_at" ` +
+		`FROM tbl_rows r LEFT JOIN tbl_owners o ON o.id = r.owner_id WHERE r."row_uuid" = $1`
+
+	if got := r.getQuery(false, false); got != want+` AND r."removed_at" IS NULL` {
+		t.Fatalf("unexpected query %s", got)
+	}
+	if got := r.getQuery(true, true); got != want+` AND r."removed_at" IS NOT NULL FOR UPDATE OF r` {
+		t.Fatalf("unexpected query %s", got)
+	}
+	if got := testRepository[plainRow]().getQuery(false, false); strings.Contains(got, "IS NULL") {
+		t.Fatalf("expected no soft delete condition, got %s", got)
+	}
+}
+
+func TestInsertQuery(t *testing.T) {
+	r := testRepository[testRow]()
+	row := testRow{Name: "name", Order: 2, Code: "code", Secret: "secret", CreatedBy: 7}
+	query, args := r.insertQuery(reflect.ValueOf(&row).Elem())
+
+	want := `INSERT INTO tbl_rows ("row_uuid", "name", "order", "code", "secret", "created_by", "created_at") ` +
+		`VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING "id"`
+	if query != want {
+		t.Fatalf("unexpected query %s", query)
+	}
+	if len(args) != 7 || args[1] != "name" || args[4] != "secret" || args[5] != 7 {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestUpdateQuery(t *testing.T) {
+	r := testRepository[testRow]()
+	id := uuid.New()
+	row := testRow{Name: "name", Order: 2, Code: "code", Secret: "secret"}
+	val := reflect.ValueOf(&row).Elem()
+
+	tests := []struct {
+		name    string
+		columns []string
+		want    string
+		args    int
+	}{
+		{
+			name: "updatable columns",
+			want: `UPDATE tbl_rows SET "name" = $1, "order" = $2, "secret" = $3, "updated_by" = $4, "updated_at" = $5 ` +
+				`WHERE "row_uuid" = $6 AND "removed_at" IS NULL`,
+			args: 6,
+		},
+		{
+			name:    "named columns",
+			columns: []string{"code", "owner_name", "created_by", "removed_at"},
+			want:    `UPDATE tbl_rows SET "code" = $1, "updated_by" = $2, "updated_at" = $3 WHERE "row_uuid" = $4 AND "removed_at" IS NULL`,
+			args:    4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := r.updateQuery(val, id, tt.columns)
+			if query != tt.want {
+				t.Fatalf("unexpected query %s", query)
+			}
+			if len(args) != tt.args || args[len(args)-1] != id {
+				t.Fatalf("unexpected args %v", args)
+			}
+		})
+	}
+
+	query, _ := testRepository[plainRow]().updateQuery(reflect.ValueOf(&plainRow{}).Elem(), id, nil)
+	if query != `UPDATE tbl_rows SET "name" = $1 WHERE "uuid" = $2` {
+		t.Fatalf("unexpected query %s", query)
+	}
+}
+
+func TestDeleteQuery(t *testing.T) {
+	r := testRepository[testRow]()
+	want := `UPDATE tbl_rows SET "removed_by" = $1, "removed_at" = $2 WHERE "row_uuid" = $3`
+	if got := r.deleteQuery(); got != want {
+		t.Fatalf("unexpected query %s", got)
+	}
+}
@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"fmt"
+)
+
+// Search is a ranked search over a full text document and a trigram indexed text column. Both are
+// expected to be generated columns with a GIN index, see the *_search migration.
+type Search struct {
+	Document string
+	Text     string
+}
+
+// Build returns the condition matching q and the rank expression to order by, parameters are
+// numbered from paramIndex. A row matches on any word (full text), on a similar word (trigram) or
+// on a substring, which is what finds partial phone numbers and emails.
+func (s Search) Build(q string, paramIndex int) (string, string, []interface{}) {
+	condition := fmt.Sprintf(
+		"(%s @@ websearch_to_tsquery('simple', $%d) OR $%d <%% %s OR %s ILIKE $%d)",
+		s.Document, paramIndex, paramIndex, s.Text, s.Text, paramIndex+1)
+	rank := fmt.Sprintf(
+		"ts_rank(%s, websearch_to_tsquery('simple', $%d)) + word_similarity($%d, %s)",
+		s.Document, paramIndex, paramIndex, s.Text)
+
+	return condition, rank, []interface{}{q, "%" + escapeLike(q) + "%"}
+}
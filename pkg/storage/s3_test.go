@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testS3(t *testing.T, endpoint string, pathStyle bool) *S3Storage {
+	t.Helper()
+	s, err := NewS3Storage(S3Config{
+		Endpoint:     endpoint,
+		Bucket:       "photos",
+		AccessKey:    "AKIDEXAMPLE",
+		SecretKey:    "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		UsePathStyle: pathStyle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestS3Sign(t *testing.T) {
+	s := testS3(t, "http://127.0.0.1:9000", true)
+	header := http.Header{}
+	header.Set("Content-Type", "image/png")
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	req, err := s.newRequest(context.Background(), http.MethodPut, "users/a b/photo.png", header, []byte("hello"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := req.URL.EscapedPath(); path != "/photos/users/a%20b/photo.png" {
+		t.Fatalf("unexpected path %s", path)
+	}
+
+	// Computed independently from the Signature V4 specification
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20261018/us-east-1/s3/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, " +
+		"Signature=f5ac3d250839a6207f1b6a9a9309ba4b0ca5974ad354f8a302a09b0b846c3e1a"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("unexpected authorization\n got %s\nwant %s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected payload hash %s", got)
+	}
+}
+
+func TestS3VirtualHostedStyle(t *testing.T) {
+	s := testS3(t, "https://s3.ap-southeast-1.amazonaws.com", false)
+	req, err := s.newRequest(context.Background(), http.MethodGet, "users/photo.png", nil, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Host != "photos.s3.ap-southeast-1.amazonaws.com" || req.URL.Path != "/users/photo.png" {
+		t.Fatalf("unexpected url %s", req.URL)
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date,") {
+		t.Fatalf("expected no content type to be signed, got %s", req.Header.Get("Authorization"))
+	}
+
+	if _, err := s.newRequest(context.Background(), http.MethodGet, "../secret", nil, nil, time.Now()); err == nil {
+		t.Fatal("expected an invalid key to be refused")
+	}
+}
+
+func TestS3Operations(t *testing.T) {
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/photos/")
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[key] = string(body)
+		case http.MethodHead, http.MethodGet:
+			body, ok := objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, body)
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	s := testS3(t, server.URL, true)
+	ctx := context.Background()
+	if err := s.Put(ctx, "users/photo.png", strings.NewReader("data"), 4, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := s.Exists(ctx, "users/photo.png"); err != nil || !exists {
+		t.Fatalf("expected the object to exist, got %v %v", exists, err)
+	}
+
+	body, obj, err := s.Get(ctx, "users/photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "data" || obj.ContentType != "image/png" {
+		t.Fatalf("unexpected object %q %+v", data, obj)
+	}
+
+	if err := s.Delete(ctx, "users/photo.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Get(ctx, "users/photo.png"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
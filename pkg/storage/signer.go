@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLSigner builds and verifies expiring HMAC-signed URLs for stored files
+type URLSigner struct {
+	secret   []byte
+	basePath string
+	ttl      time.Duration
+}
+
+func NewURLSigner(secret string, basePath string, ttl time.Duration) *URLSigner {
+	return &URLSigner{
+		secret:   []byte(secret),
+		basePath: strings.TrimSuffix(basePath, "/"),
+		ttl:      ttl,
+	}
+}
+
+// SignedURL returns a relative URL that grants read access to key until the signer TTL elapses
+func (s *URLSigner) SignedURL(key string) string {
+	expires := time.Now().Add(s.ttl).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.signature(key, expires))
+	return fmt.Sprintf("%s/%s?%s", s.basePath, key, query.Encode())
+}
+
+// Verify checks the expiry and signature query values of a signed URL
+func (s *URLSigner) Verify(key string, expires string, signature string) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry")
+	}
+	if time.Now().Unix() > exp {
+		return fmt.Errorf("signed url has expired")
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(key, exp))) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+func (s *URLSigner) signature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TTL returns how long generated URLs stay valid
+func (s *URLSigner) TTL() time.Duration {
+	return s.ttl
+}
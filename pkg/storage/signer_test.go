@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner("secret", "/files/", time.Hour)
+	signed := signer.SignedURL("users/photo.png")
+	if !strings.HasPrefix(signed, "/files/users/photo.png?") {
+		t.Fatalf("unexpected url %s", signed)
+	}
+
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, signature := parsed.Query().Get("expires"), parsed.Query().Get("signature")
+	if err := signer.Verify("users/photo.png", expires, signature); err != nil {
+		t.Fatalf("expected the url to verify: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		signer    *URLSigner
+		key       string
+		expires   string
+		signature string
+	}{
+		{name: "other key", signer: signer, key: "users/other.png", expires: expires, signature: signature},
+		{name: "longer expiry", signer: signer, key: "users/photo.png", expires: strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10), signature: signature},
+		{name: "other secret", signer: NewURLSigner("other", "/files", time.Hour), key: "users/photo.png", expires: expires, signature: signature},
+		{name: "invalid expiry", signer: signer, key: "users/photo.png", expires: "soon", signature: signature},
+		{name: "expired", signer: signer, key: "users/photo.png", expires: "1", signature: signer.signature("users/photo.png", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.signer.Verify(tt.key, tt.expires, tt.signature); err == nil {
+				t.Fatal("expected the url to be refused")
+			}
+		})
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []string{"users/photo.png", "players/1/thumb_64.png"} {
+		if err := ValidateKey(key); err != nil {
+			t.Fatalf("expected %s to be valid: %v", key, err)
+		}
+	}
+	for _, key := range []string{"", "/etc/passwd", "users/../secret", "users//photo.png", "users/./photo.png", `users\photo.png`} {
+		if err := ValidateKey(key); err == nil {
+			t.Fatalf("expected %q to be refused", key)
+		}
+	}
+}
@@ -6,17 +6,23 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"golang.org/x/text/language"
+
+	env "snack-shop/pkg/utils"
 )
 
 func New() *fiber.App {
-	f := fiber.New(fiber.Config{})
+	f := fiber.New(fiber.Config{
+		// Must stay above PHOTO_MAX_UPLOAD_SIZE plus the multipart overhead
+		BodyLimit: env.GetenvInt("HTTP_BODY_LIMIT", 4*1024*1024),
+	})
 
 	f.Use(logger.New())
 
 	f.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, HEAD, PUT, PATCH, POST, DELETE",
+		AllowOrigins:  "*",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, If-Match, Last-Event-ID",
+		AllowMethods:  "GET, HEAD, PUT, PATCH, POST, DELETE",
+		ExposeHeaders: "ETag",
 	})).Use(
 		fiberi18n.New(&fiberi18n.Config{
 			RootPath: "pkg/translates/localize/i18n",